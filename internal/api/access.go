@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+var (
+	errInvalidToken      = errors.New("invalid token")
+	errInsufficientScope = errors.New("insufficient scope")
+	errInternal          = errors.New("Something went wrong")
+)
+
+// rateLimitError is returned by authenticate when the caller has used up
+// their plan's requests for now
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e rateLimitError) Error() string {
+	return "rate limit exceeded"
+}
+
+// authenticate resolves who is calling from the bearer token, a JWT or a
+// personal API key, and makes sure they may act with scope. An empty scope
+// restricts the endpoint to first-party sessions, third-party clients and
+// API keys can never reach it.
+func (cfg *APIConfig) authenticate(r *http.Request, scope auth.Scope) (auth.AccessToken, error) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.AccessToken{}, err
+	}
+
+	var accessToken auth.AccessToken
+	if auth.IsAPIKey(tokenString) {
+		accessToken, err = cfg.authenticateAPIKey(r.Context(), tokenString)
+	} else {
+		accessToken, err = auth.ParseAccessToken(tokenString, cfg.JWTTokenSecret)
+	}
+	if err != nil {
+		if errors.Is(err, errInternal) {
+			return auth.AccessToken{}, err
+		}
+		return auth.AccessToken{}, errInvalidToken
+	}
+
+	if scope == "" {
+		if !accessToken.IsFirstParty() {
+			return auth.AccessToken{}, errInsufficientScope
+		}
+	} else if !accessToken.HasScope(scope) {
+		return auth.AccessToken{}, errInsufficientScope
+	}
+
+	// tokens of a deleted account are still signed and unexpired, restoring
+	// the account by logging in makes them valid again
+	active, err := cfg.DB.IsUserActive(r.Context(), accessToken.UserID)
+	if err != nil {
+		log.Printf("looking up account %s: %v", accessToken.UserID, err)
+		return auth.AccessToken{}, errInternal
+	}
+	if !active {
+		return auth.AccessToken{}, errInvalidToken
+	}
+
+	if err := cfg.checkRateLimit(r.Context(), accessToken.UserID); err != nil {
+		return auth.AccessToken{}, err
+	}
+	return accessToken, nil
+}
+
+// checkRateLimit counts a request against the user's plan, all of a user's
+// tokens and API keys share one limit. Without a RateLimiter nothing is
+// limited.
+func (cfg *APIConfig) checkRateLimit(ctx context.Context, userID uuid.UUID) error {
+	if cfg.RateLimiter == nil {
+		return nil
+	}
+	entitlements, err := cfg.entitlements(ctx, userID)
+	if err != nil {
+		log.Printf("looking up entitlements of %s: %v", userID, err)
+		return errInternal
+	}
+	if ok, retryAfter := cfg.RateLimiter.Allow(userID.String(), entitlements.RequestsPerMinute()); !ok {
+		return rateLimitError{retryAfter: retryAfter}
+	}
+	return nil
+}
+
+func (cfg *APIConfig) authenticateAPIKey(ctx context.Context, key string) (auth.AccessToken, error) {
+	prefix, err := auth.ParseAPIKey(key)
+	if err != nil {
+		return auth.AccessToken{}, err
+	}
+	apiKey, err := cfg.DB.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return auth.AccessToken{}, errInvalidToken
+		}
+		log.Printf("looking up API key %s: %v", prefix, err)
+		return auth.AccessToken{}, errInternal
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(key)), []byte(apiKey.KeyHash)) != 1 {
+		return auth.AccessToken{}, errInvalidToken
+	}
+	scopes, err := auth.ParseScopes(strings.Join(apiKey.Scopes, " "))
+	if err != nil {
+		return auth.AccessToken{}, err
+	}
+
+	// last use is informational, don't fail the request over it
+	if err := cfg.DB.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		log.Printf("recording use of API key %s: %v", prefix, err)
+	}
+	return auth.AccessToken{
+		UserID:   apiKey.UserID,
+		APIKeyID: apiKey.ID,
+		Scopes:   scopes,
+	}, nil
+}
+
+// respondWithAuthError maps an authenticate error to a response, 401 when we
+// don't know who is calling, 403 when they lack the scope and 429 when they
+// are rate limited
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	var rateLimitErr rateLimitError
+	if errors.As(err, &rateLimitErr) {
+		seconds := int(math.Ceil(rateLimitErr.retryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+		utils.RespondWithError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if errors.Is(err, errInsufficientScope) {
+		utils.RespondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if errors.Is(err, errInternal) {
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+// DefaultAccountDeletionGracePeriod is how long a deleted account can still
+// be restored by logging in before it gets purged for good
+const DefaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+func (cfg *APIConfig) accountDeletionGracePeriod() time.Duration {
+	if cfg.AccountDeletionGracePeriod <= 0 {
+		return DefaultAccountDeletionGracePeriod
+	}
+	return cfg.AccountDeletionGracePeriod
+}
+
+func (cfg *APIConfig) DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := accessToken.UserID
+
+	type requestBody struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	type responseBody struct {
+		DeletedAt time.Time `json:"deleted_at"`
+		PurgeAt   time.Time `json:"purge_at"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if !cfg.confirmCurrentPassword(w, r, userID, params.CurrentPassword) {
+		return
+	}
+
+	deletedUser, err := cfg.DB.SoftDeleteUser(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// sign the user out everywhere, a login within the grace period restores
+	// the account
+	err = cfg.DB.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{
+		UUID:  userID,
+		Valid: true,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, responseBody{
+		DeletedAt: deletedUser.DeletedAt.Time,
+		PurgeAt:   deletedUser.DeletedAt.Time.Add(cfg.accountDeletionGracePeriod()),
+	})
+}
+
+// exportedSession describes a refresh token without disclosing the token
+// itself
+type exportedSession struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type userExport struct {
+	ExportedAt   time.Time              `json:"exported_at"`
+	Profile      userResponse           `json:"profile"`
+	Subscription *database.Subscription `json:"subscription"`
+	Chirps       []database.Chirp       `json:"chirps"`
+	Drafts       []database.Draft       `json:"drafts"`
+	Sessions     []exportedSession      `json:"sessions"`
+}
+
+// ExportCurrentUser streams everything we store about the authenticated user,
+// as a ZIP archive by default or as a single JSON document with ?format=json
+func (cfg *APIConfig) ExportCurrentUser(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := accessToken.UserID
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "json" {
+		utils.RespondWithError(w, http.StatusBadRequest, "format must be one of: zip, json")
+		return
+	}
+
+	export, err := cfg.buildUserExport(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	filename := fmt.Sprintf("chirpstack-export-%s.%s", userID, format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(export); err != nil {
+			log.Printf("export for user %s: %v", userID, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+	if err := writeUserExportZip(w, export); err != nil {
+		// headers are already out, all we can do is cut the archive short
+		log.Printf("export for user %s: %v", userID, err)
+	}
+}
+
+func (cfg *APIConfig) buildUserExport(ctx context.Context, userID uuid.UUID) (userExport, error) {
+	user, err := cfg.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return userExport{}, err
+	}
+	nullUserID := uuid.NullUUID{UUID: userID, Valid: true}
+	chirps, err := cfg.DB.GetChirpsByAuthorID(ctx, database.GetChirpsByAuthorIDParams{
+		UserID:   nullUserID,
+		ViewerID: nullUserID,
+	})
+	if err != nil {
+		return userExport{}, err
+	}
+	scheduled, err := cfg.DB.ListScheduledChirpsByAuthor(ctx, nullUserID)
+	if err != nil {
+		return userExport{}, err
+	}
+	chirps = append(chirps, scheduled...)
+	drafts, err := cfg.DB.ListDraftsByUser(ctx, userID)
+	if err != nil {
+		return userExport{}, err
+	}
+	refreshTokens, err := cfg.DB.GetRefreshTokensByUserID(ctx, nullUserID)
+	if err != nil {
+		return userExport{}, err
+	}
+	profile, err := newUserResponse(ctx, cfg.DB, user)
+	if err != nil {
+		return userExport{}, err
+	}
+
+	export := userExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    profile,
+		Chirps:     chirps,
+		Drafts:     drafts,
+		Sessions:   make([]exportedSession, 0, len(refreshTokens)),
+	}
+	subscription, err := cfg.DB.GetSubscriptionByUserID(ctx, userID)
+	if err == nil {
+		export.Subscription = &subscription
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return userExport{}, err
+	}
+	if export.Chirps == nil {
+		export.Chirps = []database.Chirp{}
+	}
+	if export.Drafts == nil {
+		export.Drafts = []database.Draft{}
+	}
+	for _, refreshToken := range refreshTokens {
+		session := exportedSession{
+			CreatedAt: refreshToken.CreatedAt,
+			ExpiresAt: refreshToken.ExpiresAt,
+		}
+		if refreshToken.RevokedAt.Valid {
+			session.RevokedAt = &refreshToken.RevokedAt.Time
+		}
+		export.Sessions = append(export.Sessions, session)
+	}
+	return export, nil
+}
+
+func writeUserExportZip(w io.Writer, export userExport) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", export.Profile},
+		{"subscription.json", export.Subscription},
+		{"chirps.json", export.Chirps},
+		{"drafts.json", export.Drafts},
+		{"sessions.json", export.Sessions},
+	}
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// RunAccountPurger hard-deletes accounts whose grace period is over, every
+// interval until ctx is done. Chirps and refresh tokens go with them through
+// the ON DELETE CASCADE foreign keys.
+func (cfg *APIConfig) RunAccountPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deletedBefore := time.Now().UTC().Add(-cfg.accountDeletionGracePeriod())
+		purged, err := cfg.DB.PurgeDeletedUsers(ctx, deletedBefore)
+		if err != nil {
+			log.Printf("account purger: %v", err)
+		} else if purged > 0 {
+			log.Printf("account purger: purged %d account(s)", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
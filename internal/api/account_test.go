@@ -0,0 +1,235 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+func TestWriteUserExportZip(t *testing.T) {
+	userID := uuid.New()
+	revokedAt := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	export := userExport{
+		ExportedAt: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+		Profile: userResponse{
+			User: database.User{
+				ID:             userID,
+				Email:          "me@example.com",
+				HashedPassword: "super-secret-hash",
+				DeletedAt:      sql.NullTime{},
+			},
+			IsChirpyRed: true,
+		},
+		Chirps: []database.Chirp{
+			{ID: uuid.New(), Body: "hello", UserID: uuid.NullUUID{UUID: userID, Valid: true}},
+		},
+		Sessions: []exportedSession{
+			{CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), RevokedAt: &revokedAt},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeUserExportZip(&buf, export); err != nil {
+		t.Fatalf("writeUserExportZip() unexpected error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() unexpected error = %v", err)
+	}
+
+	contents := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Open(%s) unexpected error = %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll(%s) unexpected error = %v", f.Name, err)
+		}
+		contents[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"profile.json", "subscription.json", "chirps.json", "drafts.json", "sessions.json"} {
+		if _, ok := contents[name]; !ok {
+			t.Errorf("archive is missing %s", name)
+		}
+	}
+	if !strings.Contains(contents["profile.json"], "me@example.com") {
+		t.Errorf("profile.json = %s, want the user's email", contents["profile.json"])
+	}
+	if !strings.Contains(contents["profile.json"], `"is_chirpy_red": true`) {
+		t.Errorf("profile.json = %s, want the derived is_chirpy_red", contents["profile.json"])
+	}
+	if strings.Contains(contents["profile.json"], "super-secret-hash") {
+		t.Errorf("profile.json leaks the password hash")
+	}
+
+	var chirps []database.Chirp
+	if err := json.Unmarshal([]byte(contents["chirps.json"]), &chirps); err != nil {
+		t.Fatalf("chirps.json unmarshal error = %v", err)
+	}
+	if len(chirps) != 1 || chirps[0].Body != "hello" {
+		t.Errorf("chirps.json = %s, want the exported chirp", contents["chirps.json"])
+	}
+
+	var sessions []exportedSession
+	if err := json.Unmarshal([]byte(contents["sessions.json"]), &sessions); err != nil {
+		t.Fatalf("sessions.json unmarshal error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].RevokedAt == nil || !sessions[0].RevokedAt.Equal(revokedAt) {
+		t.Errorf("sessions.json = %s, want the revoked session", contents["sessions.json"])
+	}
+}
+
+func TestAPIConfig_DeleteCurrentUser_RequiresCurrentPassword(t *testing.T) {
+	cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+		"GetUserByID": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{args[0], time.Now(), time.Now(), "me@example.com", "hash", "", "", "", "", nil}}, nil
+		},
+	})
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	req := httptest.NewRequest("DELETE", "/api/users/me", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	cfg.DeleteCurrentUser(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAPIConfig_DeleteCurrentUser_WithoutPassword(t *testing.T) {
+	cfg, db := testAPIConfig(t, map[string]fakeQuery{
+		"GetUserByID": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{args[0], time.Now(), time.Now(), "me@example.com", noPassword, "", "", "", "", nil}}, nil
+		},
+		"SoftDeleteUser": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{args[0], time.Now(), time.Now(), "me@example.com", noPassword, "", "", "", "", time.Now()}}, nil
+		},
+		"RevokeUserRefreshTokens": func([]driver.Value) ([][]driver.Value, error) {
+			return nil, nil
+		},
+	})
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	// signed up through a provider, there's no password to confirm
+	req := httptest.NewRequest("DELETE", "/api/users/me", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	cfg.DeleteCurrentUser(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	if want := []string{"IsUserActive", "GetUserByID", "SoftDeleteUser", "RevokeUserRefreshTokens"}; !reflect.DeepEqual(db.called(), want) {
+		t.Errorf("queries = %v, want %v", db.called(), want)
+	}
+}
+
+func TestAPIConfig_ExportCurrentUser_InvalidFormat(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/users/me/export?format=xml", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	cfg.ExportCurrentUser(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAPIConfig_DeletedAccountTokens(t *testing.T) {
+	userID := uuid.New()
+	cfg, db := testAPIConfig(t, map[string]fakeQuery{
+		"IsUserActive": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{args[0] != userID.String()}}, nil
+		},
+	})
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	// the token is still signed and unexpired, but its account is deleted
+	req := httptest.NewRequest("GET", "/api/users/me/export?format=xml", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.ExportCurrentUser(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if got := db.called(); !reflect.DeepEqual(got, []string{"IsUserActive"}) {
+		t.Errorf("queries = %v, want only IsUserActive", got)
+	}
+}
+
+func TestAPIConfig_AccountDeletionGracePeriod(t *testing.T) {
+	cfg := &APIConfig{}
+	if got := cfg.accountDeletionGracePeriod(); got != DefaultAccountDeletionGracePeriod {
+		t.Errorf("accountDeletionGracePeriod() = %v, want default %v", got, DefaultAccountDeletionGracePeriod)
+	}
+	cfg.AccountDeletionGracePeriod = time.Hour
+	if got := cfg.accountDeletionGracePeriod(); got != time.Hour {
+		t.Errorf("accountDeletionGracePeriod() = %v, want %v", got, time.Hour)
+	}
+}
+
+func TestAPIConfig_RunAccountPurger(t *testing.T) {
+	// the purger stops after its first pass
+	ctx, cancel := context.WithCancel(t.Context())
+	var deletedBefore driver.Value
+	cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+		"PurgeDeletedUsers": func(args []driver.Value) ([][]driver.Value, error) {
+			deletedBefore = args[0]
+			cancel()
+			return nil, nil
+		},
+	})
+	cfg.AccountDeletionGracePeriod = time.Hour
+	cfg.RunAccountPurger(ctx, time.Hour)
+
+	got, ok := deletedBefore.(time.Time)
+	if !ok {
+		t.Fatalf("PurgeDeletedUsers deleted_before = %#v, want a time", deletedBefore)
+	}
+	// deleted_at has no time zone, so the cutoff must be in UTC too
+	if got.Location() != time.UTC {
+		t.Errorf("PurgeDeletedUsers deleted_before = %v, want it in UTC", got)
+	}
+	if want := time.Now().Add(-time.Hour); got.Sub(want).Abs() > time.Minute {
+		t.Errorf("PurgeDeletedUsers deleted_before = %v, want about %v", got, want)
+	}
+}
@@ -1,12 +1,25 @@
 package api
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 
+	"github.com/maniac-en/chirpstack/internal/auth"
 	"github.com/maniac-en/chirpstack/internal/utils"
 )
 
+// authorizeAdmin checks for "Authorization: ApiKey <ADMIN_KEY>". Without an
+// ADMIN_KEY configured the protected admin endpoints are disabled.
+func (cfg *APIConfig) authorizeAdmin(r *http.Request) error {
+	adminAPIKey, err := auth.GetAPIKey(r.Header)
+	if err != nil || cfg.AdminAPIKey == "" ||
+		subtle.ConstantTimeCompare([]byte(adminAPIKey), []byte(cfg.AdminAPIKey)) != 1 {
+		return fmt.Errorf("missing/invalid API key")
+	}
+	return nil
+}
+
 func (cfg *APIConfig) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
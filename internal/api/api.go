@@ -2,14 +2,32 @@
 package api
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"sync/atomic"
+	"time"
 
 	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/gateway"
+	"github.com/maniac-en/chirpstack/internal/media"
+	"github.com/maniac-en/chirpstack/internal/oidc"
+	"github.com/maniac-en/chirpstack/internal/preview"
+	"github.com/maniac-en/chirpstack/internal/ratelimit"
+	"github.com/maniac-en/chirpstack/internal/stream"
+	"github.com/maniac-en/chirpstack/internal/webhooks"
 )
 
+// pgUniqueViolation is the postgres error code raised when a UNIQUE
+// constraint is violated
+const pgUniqueViolation = "23505"
+
+// pgForeignKeyViolation is the postgres error code raised when a row
+// references one that doesn't exist
+const pgForeignKeyViolation = "23503"
+
 type Platform string
 
 const (
@@ -39,11 +57,23 @@ func ParsePlatform(s string) (Platform, error) {
 }
 
 type APIConfig struct {
-	fileserverHits atomic.Int32
-	DB             *database.Queries
-	Platform       Platform
-	JWTTokenSecret string
-	PolkaAPIKey    string
+	fileserverHits             atomic.Int32
+	DB                         *database.Queries
+	DBConn                     *sql.DB
+	Platform                   Platform
+	JWTTokenSecret             string
+	AdminAPIKey                string
+	Webhooks                   *webhooks.Registry
+	AccountDeletionGracePeriod time.Duration
+	OIDCProviders              map[string]*oidc.Provider
+	RateLimiter                *ratelimit.Limiter
+	EventRelay                 *events.Relay
+	StreamHub                  *stream.Hub
+	Gateway                    *gateway.Gateway
+	Media                      media.BlobStore
+	LinkPreviews               *preview.Pool
+	MaxChirpLength             int
+	mutedWords                 mutedWordCache
 }
 
 func (cfg *APIConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"net/mail"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/maniac-en/chirpstack/internal/auth"
@@ -17,11 +18,6 @@ func (cfg *APIConfig) LoginUser(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 		Email    string `json:"email"`
 	}
-	type responseBody struct {
-		database.User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
 	defer r.Body.Close()
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -48,6 +44,12 @@ func (cfg *APIConfig) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// accounts without a password sign in through their provider
+	if !hasPassword(storedUserInfo) {
+		utils.RespondWithError(w, http.StatusUnauthorized, auth.ErrIncorrectEmailOrPassword)
+		return
+	}
+
 	// validate user's password hash
 	err = auth.CheckPasswordHash(params.Password, storedUserInfo.HashedPassword)
 	if err != nil {
@@ -60,8 +62,35 @@ func (cfg *APIConfig) LoginUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	cfg.respondWithSession(w, r, storedUserInfo)
+}
+
+// respondWithSession signs an authenticated user in: it restores accounts
+// still in their deletion grace period and hands out an access token and a
+// refresh token
+func (cfg *APIConfig) respondWithSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	type responseBody struct {
+		userResponse
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// logging in during the deletion grace period restores the account
+	if user.DeletedAt.Valid {
+		if time.Since(user.DeletedAt.Time) > cfg.accountDeletionGracePeriod() {
+			utils.RespondWithError(w, http.StatusUnauthorized, auth.ErrIncorrectEmailOrPassword)
+			return
+		}
+		var err error
+		user, err = cfg.DB.RestoreUser(r.Context(), user.ID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+	}
+
 	// generate an access token for user (jwt)
-	jwtToken, err := auth.MakeJWT(storedUserInfo.ID, cfg.JWTTokenSecret)
+	jwtToken, err := auth.MakeJWT(user.ID, cfg.JWTTokenSecret)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
@@ -72,7 +101,7 @@ func (cfg *APIConfig) LoginUser(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := cfg.DB.StoreRefreshToken(r.Context(), database.StoreRefreshTokenParams{
 		Token: refreshTokenString,
 		UserID: uuid.NullUUID{
-			UUID:  storedUserInfo.ID,
+			UUID:  user.ID,
 			Valid: true,
 		},
 	})
@@ -81,8 +110,14 @@ func (cfg *APIConfig) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userRes, err := newUserResponse(r.Context(), cfg.DB, user)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
 	res := responseBody{
-		User:         storedUserInfo,
+		userResponse: userRes,
 		Token:        jwtToken,
 		RefreshToken: refreshToken.Token,
 	}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+// errBlocked is returned in a transaction when one user blocked the other
+var errBlocked = errors.New("blocked")
+
+// BlockUser blocks the user in the path. Neither user sees the other's
+// chirps, notifications or mentions any more, and the follows between them
+// are removed. The blocked user isn't told.
+func (cfg *APIConfig) BlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, otherID, ok := cfg.parseUserRequest(w, r, "", "You can't block yourself")
+	if !ok {
+		return
+	}
+
+	err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+		if err := lockActiveUser(r.Context(), q, otherID); err != nil {
+			return err
+		}
+		if _, err := q.BlockUser(r.Context(), database.BlockUserParams{
+			BlockerID: userID,
+			BlockedID: otherID,
+		}); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return q.DeleteFollowsBetween(r.Context(), database.DeleteFollowsBetweenParams{
+			UserID:  userID,
+			OtherID: otherID,
+		})
+	})
+	if errors.Is(err, errUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "No user found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *APIConfig) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, otherID, ok := cfg.parseUserRequest(w, r, "", "You can't block yourself")
+	if !ok {
+		return
+	}
+
+	_, err := cfg.DB.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: userID,
+		BlockedID: otherID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *APIConfig) GetBlocks(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	blocks, err := cfg.DB.ListBlocksByUser(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if blocks == nil {
+		blocks = []database.Block{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, blocks)
+}
+
+// MuteUser mutes the user in the path: their chirps are left out of the
+// timeline and they don't notify any more, but they can still be looked
+// at. The muted user isn't told, nothing changes for them.
+func (cfg *APIConfig) MuteUser(w http.ResponseWriter, r *http.Request) {
+	userID, otherID, ok := cfg.parseUserRequest(w, r, "", "You can't mute yourself")
+	if !ok {
+		return
+	}
+
+	err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+		if err := lockActiveUser(r.Context(), q, otherID); err != nil {
+			return err
+		}
+		_, err := q.MuteUser(r.Context(), database.MuteUserParams{
+			MuterID: userID,
+			MutedID: otherID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// already muted, nothing changed
+			return nil
+		}
+		return err
+	})
+	if errors.Is(err, errUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "No user found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *APIConfig) UnmuteUser(w http.ResponseWriter, r *http.Request) {
+	userID, otherID, ok := cfg.parseUserRequest(w, r, "", "You can't mute yourself")
+	if !ok {
+		return
+	}
+
+	_, err := cfg.DB.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: userID,
+		MutedID: otherID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *APIConfig) GetMutes(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	mutes, err := cfg.DB.ListMutesByUser(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if mutes == nil {
+		mutes = []database.Mute{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, mutes)
+}
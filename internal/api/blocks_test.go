@@ -0,0 +1,166 @@
+package api
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+)
+
+func TestAPIConfig_BlockAndMuteEndpoints_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	userID := uuid.New()
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	thirdPartyToken, err := auth.MakeScopedJWT(userID, uuid.NewString(), auth.ValidScopes(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"block":   cfg.BlockUser,
+		"unblock": cfg.UnblockUser,
+		"mute":    cfg.MuteUser,
+		"unmute":  cfg.UnmuteUser,
+	}
+	tests := []struct {
+		name   string
+		token  string
+		userID string
+		want   int
+	}{
+		{name: "no token", userID: uuid.NewString(), want: http.StatusUnauthorized},
+		{name: "third-party token", token: thirdPartyToken, userID: uuid.NewString(), want: http.StatusForbidden},
+		{name: "invalid user ID", token: token, userID: "not-a-uuid", want: http.StatusBadRequest},
+		{name: "themselves", token: token, userID: userID.String(), want: http.StatusBadRequest},
+	}
+	for name, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest("POST", "/api/users/"+tt.userID+"/"+name, nil)
+				req.SetPathValue("id", tt.userID)
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				w := httptest.NewRecorder()
+				handler(w, req)
+				if w.Code != tt.want {
+					t.Errorf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body)
+				}
+			})
+		}
+	}
+
+	for name, handler := range map[string]http.HandlerFunc{"blocks": cfg.GetBlocks, "mutes": cfg.GetMutes} {
+		t.Run("list "+name+" with a third-party token", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/users/me/"+name, nil)
+			req.Header.Set("Authorization", "Bearer "+thirdPartyToken)
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_BlockUser_RemovesFollows(t *testing.T) {
+	userID := uuid.New()
+	otherID := uuid.New()
+	for _, alreadyBlocked := range []bool{false, true} {
+		var deleted []driver.Value
+		cfg, db := testAPIConfig(t, map[string]fakeQuery{
+			"GetUserByID": func(args []driver.Value) ([][]driver.Value, error) {
+				return [][]driver.Value{{args[0], time.Now(), time.Now(), "other@example.com", "", "", "", "", "", nil}}, nil
+			},
+			"LockActiveUser": func(args []driver.Value) ([][]driver.Value, error) {
+				return [][]driver.Value{{args[0]}}, nil
+			},
+			"BlockUser": func(args []driver.Value) ([][]driver.Value, error) {
+				if alreadyBlocked {
+					return nil, nil
+				}
+				return [][]driver.Value{{args[0], args[1], time.Now()}}, nil
+			},
+			"DeleteFollowsBetween": func(args []driver.Value) ([][]driver.Value, error) {
+				deleted = args
+				return nil, nil
+			},
+		})
+		token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+		if err != nil {
+			t.Fatalf("MakeJWT() unexpected error = %v", err)
+		}
+		req := httptest.NewRequest("POST", "/api/users/"+otherID.String()+"/block", nil)
+		req.SetPathValue("id", otherID.String())
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		cfg.BlockUser(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("already blocked = %v: expected status %d, got %d: %s", alreadyBlocked, http.StatusNoContent, w.Code, w.Body)
+		}
+		// both are done or neither
+		want := []string{"BEGIN", "LockActiveUser", "BlockUser", "DeleteFollowsBetween", "COMMIT"}
+		if got := db.called(); !slices.Equal(got[len(got)-len(want):], want) {
+			t.Errorf("already blocked = %v: queries = %v, want %v last", alreadyBlocked, got, want)
+		}
+		if !slices.Equal(deleted, []driver.Value{userID.String(), otherID.String()}) {
+			t.Errorf("already blocked = %v: DeleteFollowsBetween() args = %v", alreadyBlocked, deleted)
+		}
+	}
+}
+
+func TestAPIConfig_FollowBlockMute_DeletedUser(t *testing.T) {
+	userID := uuid.New()
+	otherID := uuid.New()
+	tests := []struct {
+		name    string
+		handler func(cfg *APIConfig) http.HandlerFunc
+		insert  string
+	}{
+		{name: "follow", handler: func(cfg *APIConfig) http.HandlerFunc { return cfg.FollowUser }, insert: "FollowUser"},
+		{name: "block", handler: func(cfg *APIConfig) http.HandlerFunc { return cfg.BlockUser }, insert: "BlockUser"},
+		{name: "mute", handler: func(cfg *APIConfig) http.HandlerFunc { return cfg.MuteUser }, insert: "MuteUser"},
+	}
+	for _, tt := range tests {
+		// deletedBefore is a user deleted before the request, otherwise the
+		// deletion lands between the lookup and the transaction
+		for _, deletedBefore := range []bool{true, false} {
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"GetUserByID": func(args []driver.Value) ([][]driver.Value, error) {
+					if deletedBefore {
+						return nil, nil
+					}
+					return [][]driver.Value{{args[0], time.Now(), time.Now(), "other@example.com", "", "", "", "", "", nil}}, nil
+				},
+				"LockActiveUser": func(args []driver.Value) ([][]driver.Value, error) {
+					return nil, nil
+				},
+			})
+			token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+			if err != nil {
+				t.Fatalf("MakeJWT() unexpected error = %v", err)
+			}
+			req := httptest.NewRequest("POST", "/api/users/"+otherID.String()+"/"+tt.name, nil)
+			req.SetPathValue("id", otherID.String())
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			tt.handler(cfg)(w, req)
+
+			if w.Code != http.StatusNotFound {
+				t.Errorf("%s, deleted before = %v: expected status %d, got %d: %s", tt.name, deletedBefore, http.StatusNotFound, w.Code, w.Body)
+			}
+			if slices.Contains(db.called(), tt.insert) {
+				t.Errorf("%s, deleted before = %v: queries = %v, want no %s", tt.name, deletedBefore, db.called(), tt.insert)
+			}
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultBookmarksLimit         = 20
+	MaxBookmarksLimit             = 100
+	MaxBookmarkCollectionsPerUser = 100
+	// MaxBookmarkCollectionNameLength is the longest name a collection can
+	// have, in characters
+	MaxBookmarkCollectionNameLength = 50
+)
+
+var (
+	// errBookmarkCollectionNotFound is returned in a transaction when the
+	// collection isn't one of the user's
+	errBookmarkCollectionNotFound = errors.New("bookmark collection not found")
+	// errTooManyBookmarkCollections is returned in a transaction when the
+	// user is at MaxBookmarkCollectionsPerUser
+	errTooManyBookmarkCollections = fmt.Errorf("at most %d collections allowed", MaxBookmarkCollectionsPerUser)
+)
+
+// bookmarkResponse is a bookmarked chirp, with when it was bookmarked and the
+// collection it's filed in
+type bookmarkResponse struct {
+	chirpResponse
+	BookmarkedAt time.Time     `json:"bookmarked_at"`
+	CollectionID uuid.NullUUID `json:"collection_id"`
+}
+
+// BookmarkChirp bookmarks the chirp in the path, in the collection passed or
+// unfiled. Bookmarking it again moves it to that collection. Bookmarks are
+// private, no one is told.
+func (cfg *APIConfig) BookmarkChirp(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.parseChirpRequest(w, r)
+	if !ok {
+		return
+	}
+
+	type requestBody struct {
+		CollectionID *uuid.UUID `json:"collection_id"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	// the body is optional
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &params); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+	}
+
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		var collectionID uuid.NullUUID
+		if params.CollectionID != nil {
+			_, err := q.GetBookmarkCollection(r.Context(), database.GetBookmarkCollectionParams{
+				ID:     *params.CollectionID,
+				UserID: userID,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				return errBookmarkCollectionNotFound
+			}
+			if err != nil {
+				return err
+			}
+			collectionID = uuid.NullUUID{UUID: *params.CollectionID, Valid: true}
+		}
+		return q.CreateBookmark(r.Context(), database.CreateBookmarkParams{
+			UserID:       userID,
+			ChirpID:      chirpID,
+			CollectionID: collectionID,
+		})
+	})
+	if errors.Is(err, errBookmarkCollectionNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "No bookmark collection found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// UnbookmarkChirp removes the bookmark of the chirp in the path. Unlike
+// bookmarking, the chirp needn't be visible: one hidden since by a block can
+// still be removed.
+func (cfg *APIConfig) UnbookmarkChirp(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID passed")
+		return
+	}
+	_, err = cfg.DB.DeleteBookmark(r.Context(), database.DeleteBookmarkParams{
+		UserID:  accessToken.UserID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *APIConfig) GetBookmarks(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.ListBookmarksParams{
+		UserID: accessToken.UserID,
+		Limit:  DefaultBookmarksLimit,
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxBookmarksLimit {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(MaxBookmarksLimit))
+			return
+		}
+		params.Limit = int32(limit)
+	}
+	if v := query.Get("before"); v != "" {
+		before, err := uuid.Parse(v)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid before ID passed")
+			return
+		}
+		// looked up once, the page follows it even if it's deleted meanwhile
+		cursor, err := cfg.DB.GetBookmark(r.Context(), database.GetBookmarkParams{
+			UserID:  accessToken.UserID,
+			ChirpID: before,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusBadRequest, "No bookmark found for before")
+			return
+		}
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.BeforeChirpID = uuid.NullUUID{UUID: cursor.ChirpID, Valid: true}
+	}
+	if v := query.Get("collection_id"); v != "" {
+		collectionID, err := uuid.Parse(v)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID passed")
+			return
+		}
+		// someone else's collection is as good as a missing one
+		_, err = cfg.DB.GetBookmarkCollection(r.Context(), database.GetBookmarkCollectionParams{
+			ID:     collectionID,
+			UserID: accessToken.UserID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No bookmark collection found")
+			return
+		}
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		params.CollectionID = uuid.NullUUID{UUID: collectionID, Valid: true}
+	}
+
+	rows, err := cfg.DB.ListBookmarks(r.Context(), params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if len(rows) == 0 {
+		utils.RespondWithJSON(w, http.StatusOK, []bookmarkResponse{})
+		return
+	}
+	chirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, row.Chirp)
+	}
+	chirpResponses, err := newChirpResponses(r.Context(), cfg.DB, chirps)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	bookmarks := make([]bookmarkResponse, 0, len(rows))
+	for i, row := range rows {
+		bookmarks = append(bookmarks, bookmarkResponse{
+			chirpResponse: chirpResponses[i],
+			BookmarkedAt:  row.BookmarkedAt,
+			CollectionID:  row.CollectionID,
+		})
+	}
+	utils.RespondWithJSON(w, http.StatusOK, bookmarks)
+}
+
+func (cfg *APIConfig) GetBookmarkCollections(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	collections, err := cfg.DB.ListBookmarkCollectionsByUser(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if collections == nil {
+		collections = []database.ListBookmarkCollectionsByUserRow{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, collections)
+}
+
+func (cfg *APIConfig) CreateBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	name, ok := parseBookmarkCollectionName(w, r)
+	if !ok {
+		return
+	}
+
+	var collection database.BookmarkCollection
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		// concurrent creates count one at a time
+		if err := q.LockUserForUpdate(r.Context(), accessToken.UserID); err != nil {
+			return err
+		}
+		count, err := q.CountBookmarkCollectionsByUser(r.Context(), accessToken.UserID)
+		if err != nil {
+			return err
+		}
+		if count >= MaxBookmarkCollectionsPerUser {
+			return errTooManyBookmarkCollections
+		}
+		collection, err = q.CreateBookmarkCollection(r.Context(), database.CreateBookmarkCollectionParams{
+			UserID: accessToken.UserID,
+			Name:   name,
+		})
+		return err
+	})
+	if errors.Is(err, errTooManyBookmarkCollections) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithBookmarkCollectionError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, collection)
+}
+
+func (cfg *APIConfig) UpdateBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID passed")
+		return
+	}
+	name, ok := parseBookmarkCollectionName(w, r)
+	if !ok {
+		return
+	}
+
+	collection, err := cfg.DB.RenameBookmarkCollection(r.Context(), database.RenameBookmarkCollectionParams{
+		Name:   name,
+		ID:     id,
+		UserID: accessToken.UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.RespondWithError(w, http.StatusNotFound, "No bookmark collection found")
+		return
+	}
+	if err != nil {
+		respondWithBookmarkCollectionError(w, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, collection)
+}
+
+// DeleteBookmarkCollection deletes the collection in the path, its bookmarks
+// are kept unfiled
+func (cfg *APIConfig) DeleteBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid collection ID passed")
+		return
+	}
+	deleted, err := cfg.DB.DeleteBookmarkCollection(r.Context(), database.DeleteBookmarkCollectionParams{
+		ID:     id,
+		UserID: accessToken.UserID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deleted == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "No bookmark collection found")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// parseBookmarkCollectionName reads and validates the name in the request
+// body, writing the error response itself when it returns false
+func parseBookmarkCollectionName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	type requestBody struct {
+		Name string `json:"name"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return "", false
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return "", false
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "name is required")
+		return "", false
+	}
+	if utf8.RuneCountInString(name) > MaxBookmarkCollectionNameLength {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("name must be at most %d characters", MaxBookmarkCollectionNameLength))
+		return "", false
+	}
+	return name, true
+}
+
+// respondWithBookmarkCollectionError responds 409 when the user already has
+// a collection by that name, in any case, and 500 otherwise
+func respondWithBookmarkCollectionError(w http.ResponseWriter, err error) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
+		utils.RespondWithError(w, http.StatusConflict, "A collection with that name already exists")
+		return
+	}
+	utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+func TestBookmarkResponse_JSON(t *testing.T) {
+	chirpID := uuid.New()
+	collectionID := uuid.New()
+	data, err := json.Marshal(bookmarkResponse{
+		chirpResponse: chirpResponse{Chirp: database.Chirp{ID: chirpID, Body: "saved"}},
+		BookmarkedAt:  time.Now(),
+		CollectionID:  uuid.NullUUID{UUID: collectionID, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() unexpected error = %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() unexpected error = %v", err)
+	}
+	// the chirp's fields sit next to the bookmark's, as in GET /api/chirps
+	for _, key := range []string{"id", "body", "media", "preview", "bookmarked_at", "collection_id"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("bookmark JSON is missing %q: %s", key, data)
+		}
+	}
+	if got["id"] != chirpID.String() {
+		t.Errorf("id = %v, want %v", got["id"], chirpID)
+	}
+}
+
+func TestAPIConfig_BookmarkEndpoints_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	readOnlyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), []auth.Scope{auth.ScopeChirpsRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+	profileToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), []auth.Scope{auth.ScopeProfileRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		token   string
+		id      string
+		target  string
+		body    string
+		want    int
+	}{
+		{name: "bookmark without a token", handler: cfg.BookmarkChirp, id: uuid.NewString(), want: http.StatusUnauthorized},
+		{name: "bookmark with a read-only token", handler: cfg.BookmarkChirp, token: readOnlyToken, id: uuid.NewString(), want: http.StatusForbidden},
+		{name: "bookmark an invalid chirp ID", handler: cfg.BookmarkChirp, token: token, id: "not-a-uuid", want: http.StatusBadRequest},
+		{name: "unbookmark with a read-only token", handler: cfg.UnbookmarkChirp, token: readOnlyToken, id: uuid.NewString(), want: http.StatusForbidden},
+		{name: "unbookmark an invalid chirp ID", handler: cfg.UnbookmarkChirp, token: token, id: "not-a-uuid", want: http.StatusBadRequest},
+		{name: "list without chirps:read", handler: cfg.GetBookmarks, token: profileToken, want: http.StatusForbidden},
+		{name: "list with a limit too large", handler: cfg.GetBookmarks, token: token, target: "?limit=101", want: http.StatusBadRequest},
+		{name: "list with an invalid limit", handler: cfg.GetBookmarks, token: token, target: "?limit=0", want: http.StatusBadRequest},
+		{name: "list before an invalid ID", handler: cfg.GetBookmarks, token: token, target: "?before=not-a-uuid", want: http.StatusBadRequest},
+		{name: "list an invalid collection ID", handler: cfg.GetBookmarks, token: token, target: "?collection_id=not-a-uuid", want: http.StatusBadRequest},
+		{name: "list collections without chirps:read", handler: cfg.GetBookmarkCollections, token: profileToken, want: http.StatusForbidden},
+		{name: "create a collection with a read-only token", handler: cfg.CreateBookmarkCollection, token: readOnlyToken, body: `{"name": "Recipes"}`, want: http.StatusForbidden},
+		{name: "create a collection with a blank name", handler: cfg.CreateBookmarkCollection, token: token, body: `{"name": "  "}`, want: http.StatusBadRequest},
+		{name: "create a collection with a name too long", handler: cfg.CreateBookmarkCollection, token: token, body: `{"name": "` + strings.Repeat("a", MaxBookmarkCollectionNameLength+1) + `"}`, want: http.StatusBadRequest},
+		{name: "rename an invalid collection ID", handler: cfg.UpdateBookmarkCollection, token: token, id: "not-a-uuid", body: `{"name": "Recipes"}`, want: http.StatusBadRequest},
+		{name: "rename a collection to a blank name", handler: cfg.UpdateBookmarkCollection, token: token, id: uuid.NewString(), body: `{"name": ""}`, want: http.StatusBadRequest},
+		{name: "delete a collection with a read-only token", handler: cfg.DeleteBookmarkCollection, token: readOnlyToken, id: uuid.NewString(), want: http.StatusForbidden},
+		{name: "delete an invalid collection ID", handler: cfg.DeleteBookmarkCollection, token: token, id: "not-a-uuid", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/api/bookmarks" + tt.target
+			req := httptest.NewRequest("POST", target, strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_GetBookmarks_Pagination(t *testing.T) {
+	userID := uuid.New()
+	cursorID := uuid.New()
+	cursorCreatedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		// wantArgs are those of ListBookmarks after the user ID, nil if
+		// it's not run
+		wantArgs []driver.Value
+	}{
+		{name: "first page", wantStatus: http.StatusOK, wantArgs: []driver.Value{nil, nil, nil, int64(DefaultBookmarksLimit)}},
+		{name: "next page", query: "?limit=5&before=" + cursorID.String(), wantStatus: http.StatusOK, wantArgs: []driver.Value{nil, cursorCreatedAt, cursorID.String(), int64(5)}},
+		// rather than a silently empty page
+		{name: "unknown before", query: "?before=" + uuid.NewString(), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listArgs []driver.Value
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"GetBookmark": func(args []driver.Value) ([][]driver.Value, error) {
+					if args[0] != userID.String() || args[1] != cursorID.String() {
+						return nil, nil
+					}
+					return [][]driver.Value{{args[0], args[1], cursorCreatedAt, nil}}, nil
+				},
+				"ListBookmarks": func(args []driver.Value) ([][]driver.Value, error) {
+					listArgs = args
+					return [][]driver.Value{{uuid.NewString(), time.Now(), time.Now(), "hi", uuid.NewString(), nil, "published", nil, VisibilityPublic, "{}", time.Now(), nil}}, nil
+				},
+				"ListMediaForChirps": func([]driver.Value) ([][]driver.Value, error) {
+					return nil, nil
+				},
+			})
+			token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+			if err != nil {
+				t.Fatalf("MakeJWT() unexpected error = %v", err)
+			}
+			req := httptest.NewRequest("GET", "/api/bookmarks"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.GetBookmarks(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if tt.wantArgs == nil {
+				for _, name := range db.called() {
+					if name == "ListBookmarks" {
+						t.Error("ListBookmarks was run for an unknown cursor")
+					}
+				}
+				return
+			}
+			if len(listArgs) != 5 || listArgs[0] != userID.String() {
+				t.Fatalf("ListBookmarks() args = %v", listArgs)
+			}
+			for i, want := range tt.wantArgs {
+				got := listArgs[i+1]
+				if wantTime, ok := want.(time.Time); ok {
+					if gotTime, _ := got.(time.Time); !gotTime.Equal(wantTime) {
+						t.Errorf("ListBookmarks() arg %d = %v, want %v", i+2, got, want)
+					}
+				} else if got != want {
+					t.Errorf("ListBookmarks() arg %d = %v, want %v", i+2, got, want)
+				}
+			}
+			var bookmarks []bookmarkResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &bookmarks); err != nil || len(bookmarks) != 1 {
+				t.Errorf("got %s, want one bookmark", w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_CreateBookmarkCollection(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name          string
+		collections   int64
+		wantStatus    int
+		expectedCalls []string
+	}{
+		{name: "under the cap", collections: MaxBookmarkCollectionsPerUser - 1, wantStatus: http.StatusCreated, expectedCalls: []string{"IsUserActive", "BEGIN", "LockUserForUpdate", "CountBookmarkCollectionsByUser", "CreateBookmarkCollection", "COMMIT"}},
+		{name: "at the cap", collections: MaxBookmarkCollectionsPerUser, wantStatus: http.StatusBadRequest, expectedCalls: []string{"IsUserActive", "BEGIN", "LockUserForUpdate", "CountBookmarkCollectionsByUser", "ROLLBACK"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"LockUserForUpdate": func([]driver.Value) ([][]driver.Value, error) { return nil, nil },
+				"CountBookmarkCollectionsByUser": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{{tt.collections}}, nil
+				},
+				"CreateBookmarkCollection": func(args []driver.Value) ([][]driver.Value, error) {
+					now := time.Now()
+					return [][]driver.Value{{uuid.NewString(), now, now, args[0], args[1]}}, nil
+				},
+			})
+			token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+			if err != nil {
+				t.Fatalf("MakeJWT() unexpected error = %v", err)
+			}
+			req := httptest.NewRequest("POST", "/api/bookmarks/collections", strings.NewReader(`{"name": "later"}`))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.CreateBookmarkCollection(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if got := strings.Join(db.called(), ","); got != strings.Join(tt.expectedCalls, ",") {
+				t.Errorf("queries = %s, want %s", got, strings.Join(tt.expectedCalls, ","))
+			}
+		})
+	}
+}
@@ -1,19 +1,108 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/maniac-en/chirpstack/internal/auth"
 	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
 	"github.com/maniac-en/chirpstack/internal/utils"
 )
 
+// chirpResponse is a chirp as the API returns it, with its media and the
+// preview of its first link
+type chirpResponse struct {
+	database.Chirp
+	Media   []mediaResponse      `json:"media"`
+	Preview *linkPreviewResponse `json:"preview"`
+}
+
+// newChirpResponses loads the media and link previews of chirps, keeping
+// their order
+func newChirpResponses(ctx context.Context, q *database.Queries, chirps []database.Chirp) ([]chirpResponse, error) {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	var urls []string
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+		if url, ok := previewURL(chirp.Body); ok {
+			urls = append(urls, url)
+		}
+	}
+	attachments, err := q.ListMediaForChirps(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byChirp := make(map[uuid.UUID][]mediaResponse)
+	for _, attachment := range attachments {
+		byChirp[attachment.ChirpID.UUID] = append(byChirp[attachment.ChirpID.UUID], newMediaResponse(attachment))
+	}
+	previews := make(map[string]*linkPreviewResponse)
+	if len(urls) > 0 {
+		rows, err := q.ListLinkPreviews(ctx, urls)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			previews[row.URL] = newLinkPreviewResponse(row)
+		}
+	}
+
+	responses := make([]chirpResponse, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpMedia := byChirp[chirp.ID]
+		if chirpMedia == nil {
+			chirpMedia = []mediaResponse{}
+		}
+		response := chirpResponse{Chirp: chirp, Media: chirpMedia}
+		if url, ok := previewURL(chirp.Body); ok {
+			response.Preview = previews[url]
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+func newChirpResponse(ctx context.Context, q *database.Queries, chirp database.Chirp) (chirpResponse, error) {
+	responses, err := newChirpResponses(ctx, q, []database.Chirp{chirp})
+	if err != nil {
+		return chirpResponse{}, err
+	}
+	return responses[0], nil
+}
+
+// chirpLengthError is returned for empty and overlong chirps, with the
+// length as counted by utils.ChirpLength
+type chirpLengthError struct {
+	Error     string `json:"error"`
+	Length    int    `json:"length"`
+	MaxLength int    `json:"max_length"`
+}
+
+// checkChirpBody responds with a 400 and returns false if body is blank or
+// longer than maxLength
+func checkChirpBody(w http.ResponseWriter, body string, maxLength int) bool {
+	length := utils.ChirpLength(body)
+	switch {
+	case strings.TrimSpace(body) == "":
+		utils.RespondWithJSON(w, http.StatusBadRequest, chirpLengthError{Error: "Chirp is empty", Length: length, MaxLength: maxLength})
+		return false
+	case length > maxLength:
+		utils.RespondWithJSON(w, http.StatusBadRequest, chirpLengthError{Error: "Chirp is too long", Length: length, MaxLength: maxLength})
+		return false
+	}
+	return true
+}
+
 func (cfg *APIConfig) ValidateChirpHandler(w http.ResponseWriter, r *http.Request) {
 	type requestBody struct {
 		Body string `json:"body"`
@@ -34,8 +123,8 @@ func (cfg *APIConfig) ValidateChirpHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if len(params.Body) > 140 {
-		utils.RespondWithError(w, http.StatusBadRequest, "Chirp is too long")
+	// anonymous, so only the free plan's limit applies
+	if !checkChirpBody(w, params.Body, cfg.entitlementsForPlan(PlanFree).MaxChirpLength()) {
 		return
 	}
 
@@ -50,83 +139,197 @@ func (cfg *APIConfig) ValidateChirpHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-func (cfg *APIConfig) CreateChirps(w http.ResponseWriter, r *http.Request) {
-	jwtToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
+// chirpParams is what a new chirp is made of, whether it's posted with
+// CreateChirps or published from a draft
+type chirpParams struct {
+	Body       string      `json:"body"`
+	ReplyToID  *uuid.UUID  `json:"reply_to_id"`
+	MediaIDs   []uuid.UUID `json:"media_ids"`
+	PublishAt  *time.Time  `json:"publish_at"`
+	Visibility string      `json:"visibility"`
+}
 
-	userID, err := auth.ValidateJWT(jwtToken, cfg.JWTTokenSecret)
+func (cfg *APIConfig) CreateChirps(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "invalid token")
+		respondWithAuthError(w, err)
 		return
 	}
 
-	type requestBody struct {
-		Body string `json:"body"`
-	}
 	defer r.Body.Close()
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
-	params := requestBody{}
+	params := chirpParams{}
 	if err := json.Unmarshal(data, &params); err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	if len(params.Body) > 140 {
-		utils.RespondWithError(w, http.StatusBadRequest, "Chirp is too long")
+	chirp, ok := cfg.createChirp(w, r, accessToken.UserID, params, nil)
+	if !ok {
 		return
 	}
+	utils.RespondWithJSON(w, http.StatusCreated, chirp)
+}
+
+// createChirp validates and creates a chirp of userID's, running inTx (if
+// not nil) in the same transaction before the chirp is created. When the
+// chirp is refused or can't be created it responds with the error and
+// returns false.
+func (cfg *APIConfig) createChirp(w http.ResponseWriter, r *http.Request, userID uuid.UUID, params chirpParams, inTx func(q *database.Queries) error) (chirpResponse, bool) {
+	visibility, err := parseVisibility(params.Visibility)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return chirpResponse{}, false
+	}
+
+	// a chirp with publish_at stays scheduled, and out of every timeline,
+	// until RunChirpPublisher publishes it
+	status := ChirpStatusPublished
+	var publishAt sql.NullTime
+	if params.PublishAt != nil {
+		if !checkPublishAt(w, *params.PublishAt) {
+			return chirpResponse{}, false
+		}
+		status = ChirpStatusScheduled
+		publishAt = sql.NullTime{Time: params.PublishAt.UTC(), Valid: true}
+	}
+
+	entitlements, err := cfg.entitlements(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return chirpResponse{}, false
+	}
+	if !checkChirpBody(w, params.Body, entitlements.MaxChirpLength()) {
+		return chirpResponse{}, false
+	}
+	if len(params.MediaIDs) > MaxMediaPerChirp {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("a chirp can have at most %d media_ids", MaxMediaPerChirp))
+		return chirpResponse{}, false
+	}
+
+	var replyToID uuid.NullUUID
+	if params.ReplyToID != nil {
+		// chirps the user can't see can't be replied to
+		parent, err := cfg.DB.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+			ID:       *params.ReplyToID,
+			ViewerID: uuid.NullUUID{UUID: userID, Valid: true},
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				utils.RespondWithError(w, http.StatusBadRequest, "reply_to_id must be an existing chirp")
+				return chirpResponse{}, false
+			}
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return chirpResponse{}, false
+		}
+		replyToID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
 
 	if cleanedChirp, cleaned := utils.RemoveProfanity(params.Body); cleaned {
 		params.Body = cleanedChirp
 	}
+	mentionedIDs, err := cfg.mentionedUserIDs(r.Context(), userID, params.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return chirpResponse{}, false
+	}
 
-	chirp, err := cfg.DB.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body: params.Body,
-		UserID: uuid.NullUUID{
-			UUID:  userID,
-			Valid: true,
-		},
+	var chirp chirpResponse
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		if inTx != nil {
+			if err := inTx(q); err != nil {
+				return err
+			}
+		}
+		var err error
+		chirp.Chirp, err = q.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body: params.Body,
+			UserID: uuid.NullUUID{
+				UUID:  userID,
+				Valid: true,
+			},
+			ReplyToID:    replyToID,
+			Status:       status,
+			PublishAt:    publishAt,
+			Visibility:   visibility,
+			MentionedIds: mentionedIDs,
+		})
+		if err != nil {
+			return err
+		}
+		chirp.Media, err = attachMedia(r.Context(), q, userID, chirp.ID, params.MediaIDs)
+		if err != nil {
+			return err
+		}
+		if status == ChirpStatusScheduled {
+			// the publisher records the event once it's out
+			return nil
+		}
+		return events.Record(r.Context(), q, events.ChirpCreated, userID, chirp)
 	})
-	if err != nil {
+	switch {
+	case errors.Is(err, errInvalidMedia):
+		utils.RespondWithError(w, http.StatusBadRequest, "media_ids must be your own uploads not yet attached to a chirp")
+		return chirpResponse{}, false
+	case errors.Is(err, errDraftNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "No draft found")
+		return chirpResponse{}, false
+	case err != nil:
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
-		return
+		return chirpResponse{}, false
 	}
-	utils.RespondWithJSON(w, http.StatusCreated, chirp)
+	return chirp, true
 }
 
+// GetChirps lists the chirps the caller may see, all of them or an
+// author's
 func (cfg *APIConfig) GetChirps(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.authenticateViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
 	// check for optional author_id param
 	authorID := r.URL.Query().Get("author_id")
 	defer r.Body.Close()
 	var chirps []database.Chirp
-	var err error
 	if authorID != "" {
 		authorUUID, err := uuid.Parse(authorID)
 		if err != nil {
 			utils.RespondWithError(w, http.StatusNoContent, "invalid author id")
 			return
 		}
-		chirps, err = cfg.DB.GetChirpsByAuthorID(r.Context(), uuid.NullUUID{
-			UUID:  authorUUID,
-			Valid: true,
+		chirps, err = cfg.DB.GetChirpsByAuthorID(r.Context(), database.GetChirpsByAuthorIDParams{
+			UserID: uuid.NullUUID{
+				UUID:  authorUUID,
+				Valid: true,
+			},
+			ViewerID: viewerID,
 		})
 		if err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 			return
 		}
 	} else {
-		chirps, err = cfg.DB.GetChirps(r.Context())
+		chirps, err = cfg.DB.GetChirps(r.Context(), viewerID)
 		if err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 			return
 		}
+		if viewerID.Valid {
+			// like muted users, muted words only hide chirps from the
+			// timeline, not when they're asked for
+			chirps, err = cfg.hideMutedWords(r.Context(), viewerID.UUID, chirps)
+			if err != nil {
+				utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+				return
+			}
+		}
 	}
 	if len(chirps) > 0 {
 		// check for sort param
@@ -134,13 +337,24 @@ func (cfg *APIConfig) GetChirps(w http.ResponseWriter, r *http.Request) {
 		if sortOrder == "desc" {
 			sort.Slice(chirps, func(i, j int) bool { return chirps[i].CreatedAt.After(chirps[j].CreatedAt) })
 		}
-		utils.RespondWithJSON(w, http.StatusOK, chirps)
+		responses, err := newChirpResponses(r.Context(), cfg.DB, chirps)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, responses)
 	} else {
-		utils.RespondWithJSON(w, http.StatusOK, []database.Chirp{})
+		utils.RespondWithJSON(w, http.StatusOK, []chirpResponse{})
 	}
 }
 
 func (cfg *APIConfig) GetChirpByID(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := cfg.authenticateViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
 	chirpID := r.PathValue("id")
 	if chirpID == "" {
 		utils.RespondWithError(w, http.StatusBadRequest, "No chirp ID passed")
@@ -152,7 +366,11 @@ func (cfg *APIConfig) GetChirpByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chirp, err := cfg.DB.GetChirpByID(r.Context(), chirpUUID)
+	// chirps the caller can't see don't exist as far as they know
+	chirp, err := cfg.DB.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       chirpUUID,
+		ViewerID: viewerID,
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			utils.RespondWithError(w, http.StatusNotFound, "No chirp found")
@@ -161,23 +379,120 @@ func (cfg *APIConfig) GetChirpByID(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusOK, chirp)
+	response, err := newChirpResponse(r.Context(), cfg.DB, chirp)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
 }
 
-func (cfg *APIConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
-	// check for jwt existence, else return 403
-	jwtToken, err := auth.GetBearerToken(r.Header)
+// UpdateChirp edits the body of one of the caller's chirps, a Chirpy Red
+// feature
+func (cfg *APIConfig) UpdateChirp(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := accessToken.UserID
+
+	chirpUUID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID passed")
+		return
+	}
+
+	type requestBody struct {
+		Body string `json:"body"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	entitlements, err := cfg.entitlements(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if !entitlements.CanEditChirps() {
+		utils.RespondWithError(w, http.StatusForbidden, "editing chirps requires Chirpy Red")
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       chirpUUID,
+		ViewerID: uuid.NullUUID{UUID: userID, Valid: true},
+	})
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No chirp found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if chirp.UserID.UUID != userID {
 		utils.RespondWithError(w, http.StatusForbidden, "operation not allowed")
 		return
 	}
 
-	// validate jwt, else return 403
-	userID, err := auth.ValidateJWT(jwtToken, cfg.JWTTokenSecret)
+	if !checkChirpBody(w, params.Body, entitlements.MaxChirpLength()) {
+		return
+	}
+	if cleanedChirp, cleaned := utils.RemoveProfanity(params.Body); cleaned {
+		params.Body = cleanedChirp
+	}
+	// an edit can mention, and so show the chirp to, other users
+	mentionedIDs, err := cfg.mentionedUserIDs(r.Context(), userID, params.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	var response chirpResponse
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		updated, err := q.UpdateChirp(r.Context(), database.UpdateChirpParams{
+			Body:         params.Body,
+			MentionedIds: mentionedIDs,
+			ID:           chirp.ID,
+		})
+		if err != nil {
+			return err
+		}
+		response, err = newChirpResponse(r.Context(), q, updated)
+		if err != nil {
+			return err
+		}
+		return events.Record(r.Context(), q, events.ChirpUpdated, userID, response)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No chirp found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *APIConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
+	// check for a valid token allowed to write chirps, else return 403
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusForbidden, "operation not allowed")
 		return
 	}
+	userID := accessToken.UserID
 
 	// check for chirp's existence, else return 404
 	chirpID := r.PathValue("id")
@@ -190,7 +505,10 @@ func (cfg *APIConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Invalid chirp ID passed")
 		return
 	}
-	chirp, err := cfg.DB.GetChirpByID(r.Context(), chirpUUID)
+	chirp, err := cfg.DB.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       chirpUUID,
+		ViewerID: uuid.NullUUID{UUID: userID, Valid: true},
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			utils.RespondWithError(w, http.StatusNotFound, "No chirp found")
@@ -206,11 +524,15 @@ func (cfg *APIConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.DB.DeleteChirpByID(r.Context(), chirp.ID)
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		if err := q.DeleteChirpByID(r.Context(), chirp.ID); err != nil {
+			return err
+		}
+		return events.Record(r.Context(), q, events.ChirpDeleted, userID, chirp)
+	})
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 	utils.RespondWithJSON(w, http.StatusNoContent, nil)
 }
-
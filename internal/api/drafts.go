@@ -0,0 +1,305 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+const (
+	MaxDraftsPerUser = 100
+	// MaxDraftSize is how many bytes of body a draft can store. It only
+	// bounds storage, the chirp length is checked on publishing.
+	MaxDraftSize = 16 << 10
+	// MaxDraftMedia is how many media_ids a draft can store
+	MaxDraftMedia = 16
+)
+
+var (
+	// errDraftNotFound is returned in the publishing transaction when the
+	// draft was deleted, or published, since it was read
+	errDraftNotFound = errors.New("draft not found")
+	// errTooManyDrafts is returned in a transaction when the user is at
+	// MaxDraftsPerUser
+	errTooManyDrafts = fmt.Errorf("at most %d drafts allowed, publish or delete one first", MaxDraftsPerUser)
+)
+
+// draftParams is what a draft holds. Only its size and visibility are
+// checked when it's saved, the chirp rules wait until the draft is
+// published, so a draft can be saved unfinished.
+type draftParams struct {
+	Body       string      `json:"body"`
+	ReplyToID  *uuid.UUID  `json:"reply_to_id"`
+	MediaIDs   []uuid.UUID `json:"media_ids"`
+	Visibility string      `json:"visibility"`
+}
+
+// readDraftParams reads the draft in the request body, responding with an
+// error and returning false if it can't
+func readDraftParams(w http.ResponseWriter, r *http.Request) (draftParams, bool) {
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return draftParams{}, false
+	}
+	params := draftParams{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return draftParams{}, false
+	}
+	if params.MediaIDs == nil {
+		params.MediaIDs = []uuid.UUID{}
+	}
+	// stored as it will be published, so it's checked now
+	params.Visibility, err = parseVisibility(params.Visibility)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return draftParams{}, false
+	}
+	return params, true
+}
+
+// checkDraftSize responds with a 400 and returns false when the draft is
+// bigger than a draft can be stored
+func checkDraftSize(w http.ResponseWriter, params draftParams) bool {
+	if len(params.Body) > MaxDraftSize {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("a draft body can be at most %d bytes", MaxDraftSize))
+		return false
+	}
+	if len(params.MediaIDs) > MaxDraftMedia {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("a draft can have at most %d media_ids", MaxDraftMedia))
+		return false
+	}
+	return true
+}
+
+func (p draftParams) replyToID() uuid.NullUUID {
+	if p.ReplyToID == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: *p.ReplyToID, Valid: true}
+}
+
+func (cfg *APIConfig) CreateDraft(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := accessToken.UserID
+
+	params, ok := readDraftParams(w, r)
+	if !ok {
+		return
+	}
+	if !checkDraftSize(w, params) {
+		return
+	}
+
+	var draft database.Draft
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		// concurrent saves count one at a time
+		if err := q.LockUserForUpdate(r.Context(), userID); err != nil {
+			return err
+		}
+		count, err := q.CountDraftsByUser(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if count >= MaxDraftsPerUser {
+			return errTooManyDrafts
+		}
+		draft, err = q.CreateDraft(r.Context(), database.CreateDraftParams{
+			UserID:     userID,
+			Body:       params.Body,
+			ReplyToID:  params.replyToID(),
+			MediaIds:   params.MediaIDs,
+			Visibility: params.Visibility,
+		})
+		return err
+	})
+	if errors.Is(err, errTooManyDrafts) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, draft)
+}
+
+// GetDrafts lists the caller's drafts, the most recently edited first
+func (cfg *APIConfig) GetDrafts(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	drafts, err := cfg.DB.ListDraftsByUser(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if drafts == nil {
+		drafts = []database.Draft{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, drafts)
+}
+
+func (cfg *APIConfig) GetDraft(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draft, ok := cfg.ownedDraft(w, r, accessToken.UserID)
+	if !ok {
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, draft)
+}
+
+// UpdateDraft replaces the contents of one of the caller's drafts
+func (cfg *APIConfig) UpdateDraft(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid draft ID passed")
+		return
+	}
+	params, ok := readDraftParams(w, r)
+	if !ok {
+		return
+	}
+	if !checkDraftSize(w, params) {
+		return
+	}
+
+	draft, err := cfg.DB.UpdateDraft(r.Context(), database.UpdateDraftParams{
+		Body:       params.Body,
+		ReplyToID:  params.replyToID(),
+		MediaIds:   params.MediaIDs,
+		Visibility: params.Visibility,
+		ID:         draftID,
+		UserID:     accessToken.UserID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No draft found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, draft)
+}
+
+func (cfg *APIConfig) DeleteDraft(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid draft ID passed")
+		return
+	}
+	deleted, err := cfg.DB.DeleteDraft(r.Context(), database.DeleteDraftParams{
+		ID:     draftID,
+		UserID: accessToken.UserID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deleted == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "No draft found")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// PublishDraft turns one of the caller's drafts into a chirp, checked like
+// any chirp passed to CreateChirps. The draft is deleted in the transaction
+// that creates the chirp, so it's published at most once.
+func (cfg *APIConfig) PublishDraft(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := accessToken.UserID
+
+	draft, ok := cfg.ownedDraft(w, r, userID)
+	if !ok {
+		return
+	}
+	params := chirpParams{
+		Body:       draft.Body,
+		MediaIDs:   draft.MediaIds,
+		Visibility: draft.Visibility,
+	}
+	if draft.ReplyToID.Valid {
+		params.ReplyToID = &draft.ReplyToID.UUID
+	}
+
+	chirp, ok := cfg.createChirp(w, r, userID, params, func(q *database.Queries) error {
+		deleted, err := q.DeleteDraft(r.Context(), database.DeleteDraftParams{
+			ID:     draft.ID,
+			UserID: userID,
+		})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return errDraftNotFound
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, chirp)
+}
+
+// ownedDraft looks up the draft in the path, responding with 400 or 404 when
+// it isn't one of userID's
+func (cfg *APIConfig) ownedDraft(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Draft, bool) {
+	draftID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid draft ID passed")
+		return database.Draft{}, false
+	}
+	draft, err := cfg.DB.GetDraft(r.Context(), database.GetDraftParams{
+		ID:     draftID,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No draft found")
+			return database.Draft{}, false
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return database.Draft{}, false
+	}
+	return draft, true
+}
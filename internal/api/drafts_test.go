@@ -0,0 +1,257 @@
+package api
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+)
+
+func TestAPIConfig_DraftEndpoints_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	readOnlyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), []auth.Scope{auth.ScopeChirpsRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+	profileToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), []auth.Scope{auth.ScopeProfileRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		method         string
+		id             string
+		token          string
+		expectedStatus int
+	}{
+		{name: "create without a token", handler: cfg.CreateDraft, method: "POST", expectedStatus: http.StatusUnauthorized},
+		{name: "create without chirps:write", handler: cfg.CreateDraft, method: "POST", token: readOnlyToken, expectedStatus: http.StatusForbidden},
+		{name: "list without a token", handler: cfg.GetDrafts, method: "GET", expectedStatus: http.StatusUnauthorized},
+		{name: "list without chirps:read", handler: cfg.GetDrafts, method: "GET", token: profileToken, expectedStatus: http.StatusForbidden},
+		{name: "get with an invalid id", handler: cfg.GetDraft, method: "GET", id: "nope", token: token, expectedStatus: http.StatusBadRequest},
+		{name: "update without chirps:write", handler: cfg.UpdateDraft, method: "PUT", id: uuid.NewString(), token: readOnlyToken, expectedStatus: http.StatusForbidden},
+		{name: "update with an invalid id", handler: cfg.UpdateDraft, method: "PUT", id: "nope", token: token, expectedStatus: http.StatusBadRequest},
+		{name: "delete with an invalid id", handler: cfg.DeleteDraft, method: "DELETE", id: "nope", token: token, expectedStatus: http.StatusBadRequest},
+		{name: "publish without a token", handler: cfg.PublishDraft, method: "POST", id: uuid.NewString(), expectedStatus: http.StatusUnauthorized},
+		{name: "publish without chirps:write", handler: cfg.PublishDraft, method: "POST", id: uuid.NewString(), token: readOnlyToken, expectedStatus: http.StatusForbidden},
+		{name: "publish with an invalid id", handler: cfg.PublishDraft, method: "POST", id: "nope", token: token, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/drafts", strings.NewReader(`{"body": "not done yet"}`))
+			req.SetPathValue("id", tt.id)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_SaveDraft_Limits(t *testing.T) {
+	maxLength := EntitlementsForPlan(PlanRedPlus).MaxChirpLength()
+	mediaIDs := func(n int) string {
+		ids := make([]string, n)
+		for i := range ids {
+			ids[i] = `"` + uuid.NewString() + `"`
+		}
+		return "[" + strings.Join(ids, ",") + "]"
+	}
+	created := []string{"IsUserActive", "BEGIN", "LockUserForUpdate", "CountDraftsByUser", "CreateDraft", "COMMIT"}
+
+	tests := []struct {
+		name           string
+		handler        func(cfg *APIConfig) http.HandlerFunc
+		body           string
+		drafts         int64
+		expectedStatus int
+		expectedCalls  []string
+	}{
+		{
+			// drafts may be unfinished, only their size is checked
+			name:           "create an empty draft",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.CreateDraft },
+			body:           `{"body": ""}`,
+			expectedStatus: http.StatusCreated,
+			expectedCalls:  created,
+		},
+		{
+			// the chirp rules wait until it's published
+			name:           "create a draft too long to publish",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.CreateDraft },
+			body:           `{"body": "` + strings.Repeat("a", maxLength+1) + `"}`,
+			expectedStatus: http.StatusCreated,
+			expectedCalls:  created,
+		},
+		{
+			name:           "create a draft with more media than a chirp",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.CreateDraft },
+			body:           `{"body": "pics", "media_ids": ` + mediaIDs(MaxMediaPerChirp+1) + `}`,
+			expectedStatus: http.StatusCreated,
+			expectedCalls:  created,
+		},
+		{
+			name:           "create a draft too big to store",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.CreateDraft },
+			body:           `{"body": "` + strings.Repeat("a", MaxDraftSize+1) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"IsUserActive"},
+		},
+		{
+			name:           "create a draft with too many media to store",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.CreateDraft },
+			body:           `{"body": "pics", "media_ids": ` + mediaIDs(MaxDraftMedia+1) + `}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"IsUserActive"},
+		},
+		{
+			name:           "create a draft over the cap",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.CreateDraft },
+			body:           `{"body": "one more"}`,
+			drafts:         MaxDraftsPerUser,
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"IsUserActive", "BEGIN", "LockUserForUpdate", "CountDraftsByUser", "ROLLBACK"},
+		},
+		{
+			name:           "create a draft with an invalid visibility",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.CreateDraft },
+			body:           `{"body": "secret", "visibility": "friends"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"IsUserActive"},
+		},
+		{
+			name:           "update a draft to be too big to store",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.UpdateDraft },
+			body:           `{"body": "` + strings.Repeat("a", MaxDraftSize+1) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"IsUserActive"},
+		},
+		{
+			name:           "update a draft with too many media to store",
+			handler:        func(cfg *APIConfig) http.HandlerFunc { return cfg.UpdateDraft },
+			body:           `{"body": "pics", "media_ids": ` + mediaIDs(MaxDraftMedia+1) + `}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  []string{"IsUserActive"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"LockUserForUpdate": func([]driver.Value) ([][]driver.Value, error) { return nil, nil },
+				"CountDraftsByUser": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{{tt.drafts}}, nil
+				},
+				"CreateDraft": func(args []driver.Value) ([][]driver.Value, error) {
+					now := time.Now()
+					return [][]driver.Value{{uuid.NewString(), now, now, args[0], args[1], args[2], args[3], args[4]}}, nil
+				},
+			})
+			token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+			if err != nil {
+				t.Fatalf("MakeJWT() unexpected error = %v", err)
+			}
+
+			req := httptest.NewRequest("POST", "/api/drafts", strings.NewReader(tt.body))
+			req.SetPathValue("id", uuid.NewString())
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			tt.handler(cfg)(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+			if got := strings.Join(db.called(), ","); got != strings.Join(tt.expectedCalls, ",") {
+				t.Errorf("queries = %s, want %s", got, strings.Join(tt.expectedCalls, ","))
+			}
+		})
+	}
+}
+
+func TestAPIConfig_PublishDraft_KeepsVisibility(t *testing.T) {
+	userID, draftID := uuid.New(), uuid.New()
+	var visibility driver.Value
+	cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+		"GetDraft": func([]driver.Value) ([][]driver.Value, error) {
+			now := time.Now()
+			return [][]driver.Value{{draftID.String(), now, now, userID.String(), "for my followers", nil, "{}", VisibilityFollowers}}, nil
+		},
+		"GetActivePlanByUserID": func([]driver.Value) ([][]driver.Value, error) { return nil, nil },
+		"DeleteDraft": func([]driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{}}, nil
+		},
+		"CreateChirp": func(args []driver.Value) ([][]driver.Value, error) {
+			visibility = args[5]
+			now := time.Now()
+			return [][]driver.Value{{uuid.NewString(), now, now, args[0], args[1], args[2], args[3], args[4], args[5], "{}"}}, nil
+		},
+		"CreateDomainEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			now := time.Now()
+			return [][]driver.Value{{uuid.NewString(), now, args[0], args[1], args[2], "pending", int64(0), now, "", nil, "{}"}}, nil
+		},
+	})
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/drafts/"+draftID.String()+"/publish", nil)
+	req.SetPathValue("id", draftID.String())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.PublishDraft(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	if visibility != VisibilityFollowers {
+		t.Errorf("CreateChirp visibility = %v, want %q", visibility, VisibilityFollowers)
+	}
+}
+
+func TestAPIConfig_PublishDraft_ChecksChirpRules(t *testing.T) {
+	userID, draftID := uuid.New(), uuid.New()
+	body := strings.Repeat("a", EntitlementsForPlan(PlanFree).MaxChirpLength()+1)
+	cfg, db := testAPIConfig(t, map[string]fakeQuery{
+		"GetDraft": func([]driver.Value) ([][]driver.Value, error) {
+			now := time.Now()
+			return [][]driver.Value{{draftID.String(), now, now, userID.String(), body, nil, "{}", VisibilityPublic}}, nil
+		},
+		"GetActivePlanByUserID": func([]driver.Value) ([][]driver.Value, error) { return nil, nil },
+	})
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	// saved fine, but too long for a free user's chirp
+	req := httptest.NewRequest("POST", "/api/drafts/"+draftID.String()+"/publish", nil)
+	req.SetPathValue("id", draftID.String())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.PublishDraft(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+	}
+	for _, name := range db.called() {
+		if name == "DeleteDraft" || name == "CreateChirp" {
+			t.Errorf("queries = %v, want the draft kept and no chirp", db.called())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// PlanFree is the plan of users without a Chirpy Red subscription. It can't
+// be bought, so it isn't one of ValidPlans.
+const PlanFree Plan = "free"
+
+// Entitlements are the limits and features a user's plan unlocks. Handlers
+// check them through cfg.entitlements instead of looking at subscriptions.
+type Entitlements interface {
+	Plan() Plan
+	MaxChirpLength() int
+	CanEditChirps() bool
+	MaxAPIKeys() int
+	RequestsPerMinute() int
+}
+
+type planEntitlements struct {
+	plan              Plan
+	maxChirpLength    int
+	canEditChirps     bool
+	maxAPIKeys        int
+	requestsPerMinute int
+}
+
+func (e planEntitlements) Plan() Plan             { return e.plan }
+func (e planEntitlements) MaxChirpLength() int    { return e.maxChirpLength }
+func (e planEntitlements) CanEditChirps() bool    { return e.canEditChirps }
+func (e planEntitlements) MaxAPIKeys() int        { return e.maxAPIKeys }
+func (e planEntitlements) RequestsPerMinute() int { return e.requestsPerMinute }
+
+var planEntitlementsByPlan = map[Plan]planEntitlements{
+	PlanFree: {
+		plan:              PlanFree,
+		maxChirpLength:    140,
+		maxAPIKeys:        20,
+		requestsPerMinute: 60,
+	},
+	PlanRed: {
+		plan:              PlanRed,
+		maxChirpLength:    280,
+		canEditChirps:     true,
+		maxAPIKeys:        50,
+		requestsPerMinute: 300,
+	},
+	PlanRedPlus: {
+		plan:              PlanRedPlus,
+		maxChirpLength:    1000,
+		canEditChirps:     true,
+		maxAPIKeys:        100,
+		requestsPerMinute: 1200,
+	},
+}
+
+// EntitlementsForPlan returns what plan unlocks, unknown plans get the free
+// entitlements
+func EntitlementsForPlan(plan Plan) Entitlements {
+	if e, ok := planEntitlementsByPlan[plan]; ok {
+		return e
+	}
+	return planEntitlementsByPlan[PlanFree]
+}
+
+// entitlements looks up the entitlements of the user's current plan
+func (cfg *APIConfig) entitlements(ctx context.Context, userID uuid.UUID) (Entitlements, error) {
+	plan, err := cfg.DB.GetActivePlanByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return cfg.entitlementsForPlan(PlanFree), nil
+		}
+		return nil, err
+	}
+	return cfg.entitlementsForPlan(Plan(plan)), nil
+}
+
+// entitlementsForPlan is EntitlementsForPlan with cfg.MaxChirpLength
+// applied: it replaces the free plan's chirp length limit, and paid plans
+// allow at least as much
+func (cfg *APIConfig) entitlementsForPlan(plan Plan) Entitlements {
+	e := EntitlementsForPlan(plan)
+	if cfg.MaxChirpLength > 0 && (e.Plan() == PlanFree || e.MaxChirpLength() < cfg.MaxChirpLength) {
+		return chirpLengthOverride{Entitlements: e, maxChirpLength: cfg.MaxChirpLength}
+	}
+	return e
+}
+
+type chirpLengthOverride struct {
+	Entitlements
+	maxChirpLength int
+}
+
+func (e chirpLengthOverride) MaxChirpLength() int { return e.maxChirpLength }
+
+// entitlementsResponse is how entitlements are shown to their user
+type entitlementsResponse struct {
+	Plan              Plan `json:"plan"`
+	MaxChirpLength    int  `json:"max_chirp_length"`
+	CanEditChirps     bool `json:"can_edit_chirps"`
+	MaxAPIKeys        int  `json:"max_api_keys"`
+	RequestsPerMinute int  `json:"requests_per_minute"`
+}
+
+func newEntitlementsResponse(e Entitlements) entitlementsResponse {
+	return entitlementsResponse{
+		Plan:              e.Plan(),
+		MaxChirpLength:    e.MaxChirpLength(),
+		CanEditChirps:     e.CanEditChirps(),
+		MaxAPIKeys:        e.MaxAPIKeys(),
+		RequestsPerMinute: e.RequestsPerMinute(),
+	}
+}
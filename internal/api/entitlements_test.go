@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+)
+
+func TestEntitlementsForPlan(t *testing.T) {
+	free := EntitlementsForPlan(PlanFree)
+	if free.MaxChirpLength() != 140 || free.CanEditChirps() {
+		t.Errorf("free plan = %+v, want 140 character chirps and no editing", newEntitlementsResponse(free))
+	}
+	if got := EntitlementsForPlan("gold"); got.Plan() != PlanFree {
+		t.Errorf("EntitlementsForPlan(unknown) plan = %q, want %q", got.Plan(), PlanFree)
+	}
+
+	// every paid plan must unlock more than the one below it
+	previous := free
+	for _, plan := range ValidPlans() {
+		e := EntitlementsForPlan(plan)
+		if e.Plan() != plan {
+			t.Errorf("EntitlementsForPlan(%q) plan = %q", plan, e.Plan())
+		}
+		if !e.CanEditChirps() {
+			t.Errorf("%s plan can't edit chirps", plan)
+		}
+		if e.MaxChirpLength() <= previous.MaxChirpLength() ||
+			e.MaxAPIKeys() <= previous.MaxAPIKeys() ||
+			e.RequestsPerMinute() <= previous.RequestsPerMinute() {
+			t.Errorf("%s plan = %+v, want more than %+v", plan, newEntitlementsResponse(e), newEntitlementsResponse(previous))
+		}
+		previous = e
+	}
+}
+
+func TestRespondWithAuthError_RateLimited(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondWithAuthError(w, rateLimitError{retryAfter: 1500 * time.Millisecond})
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+}
+
+func TestAPIConfig_UpdateChirp(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	readOnlyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), []auth.Scope{auth.ScopeChirpsRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		chirpID        string
+		authHeader     string
+		expectedStatus int
+	}{
+		{
+			name:           "no token",
+			chirpID:        uuid.NewString(),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "token without chirps:write",
+			chirpID:        uuid.NewString(),
+			authHeader:     "Bearer " + readOnlyToken,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "invalid chirp ID",
+			chirpID:        "not-a-uuid",
+			authHeader:     "Bearer " + token,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/api/chirps/"+tt.chirpID, strings.NewReader(`{"body":"edited"}`))
+			req.SetPathValue("id", tt.chirpID)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			w := httptest.NewRecorder()
+			cfg.UpdateChirp(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_EntitlementsForPlan(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxChirpLength int
+		plan           Plan
+		want           int
+	}{
+		{name: "default", plan: PlanFree, want: 140},
+		{name: "lowered", maxChirpLength: 100, plan: PlanFree, want: 100},
+		{name: "raised", maxChirpLength: 500, plan: PlanFree, want: 500},
+		{name: "paid plan above it", maxChirpLength: 200, plan: PlanRed, want: 280},
+		{name: "paid plan below it", maxChirpLength: 500, plan: PlanRed, want: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &APIConfig{MaxChirpLength: tt.maxChirpLength}
+			e := cfg.entitlementsForPlan(tt.plan)
+			if e.MaxChirpLength() != tt.want || e.Plan() != tt.plan {
+				t.Errorf("entitlementsForPlan(%q) = %+v, want %d character chirps", tt.plan, newEntitlementsResponse(e), tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_ValidateChirpHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		maxChirpLength int
+		expectedStatus int
+		expectedLength int
+	}{
+		{name: "emoji count once", body: strings.Repeat("👍🏽", 140), expectedStatus: http.StatusOK},
+		{name: "too long", body: strings.Repeat("é", 141), expectedStatus: http.StatusBadRequest, expectedLength: 141},
+		{name: "urls count as 23", body: "https://example.com/" + strings.Repeat("a", 200), expectedStatus: http.StatusOK},
+		{name: "empty", body: "", expectedStatus: http.StatusBadRequest},
+		{name: "whitespace only", body: " \n\t ", expectedStatus: http.StatusBadRequest, expectedLength: 4},
+		{name: "configured limit", body: strings.Repeat("a", 50), maxChirpLength: 40, expectedStatus: http.StatusBadRequest, expectedLength: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &APIConfig{MaxChirpLength: tt.maxChirpLength}
+			data, _ := json.Marshal(map[string]string{"body": tt.body})
+			req := httptest.NewRequest("POST", "/api/validate_chirp", bytes.NewReader(data))
+			w := httptest.NewRecorder()
+			cfg.ValidateChirpHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+			if w.Code != http.StatusBadRequest {
+				return
+			}
+			var got chirpLengthError
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid error response: %v", err)
+			}
+			wantMax := 140
+			if tt.maxChirpLength > 0 {
+				wantMax = tt.maxChirpLength
+			}
+			if got.Length != tt.expectedLength || got.MaxLength != wantMax {
+				t.Errorf("error = %+v, want length %d of at most %d", got, tt.expectedLength, wantMax)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/dispatch"
+	"github.com/maniac-en/chirpstack/internal/events"
+)
+
+// withTx runs fn with queries bound to a transaction, committing if fn
+// succeeds. Events recorded through those queries are relayed right after
+// the commit.
+func (cfg *APIConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(cfg.DB.WithTx(tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if cfg.EventRelay != nil {
+		cfg.EventRelay.Wake()
+	}
+	return nil
+}
+
+// SubscribeToEvents registers the API's reactions to domain events
+func (cfg *APIConfig) SubscribeToEvents(bus *events.Bus) {
+	for _, eventType := range dispatch.ValidEventTypes() {
+		bus.Subscribe(eventType, "webhooks", cfg.enqueueWebhookDeliveries)
+	}
+	bus.Subscribe(events.ChirpCreated, "notifications", cfg.notifyChirpCreated)
+	bus.Subscribe(events.ChirpLiked, "notifications", cfg.notifyChirpLiked)
+	bus.Subscribe(events.UserFollowed, "notifications", cfg.notifyUserFollowed)
+	bus.Subscribe(events.ChirpCreated, "stream", cfg.streamChirpEvent)
+	bus.Subscribe(events.ChirpDeleted, "stream", cfg.streamChirpEvent)
+	for _, eventType := range []string{events.ChirpCreated, events.ChirpUpdated, events.ChirpDeleted} {
+		bus.Subscribe(eventType, "gateway", cfg.gatewayChirpEvent)
+	}
+	bus.Subscribe(events.ChirpCreated, "link_previews", cfg.queueLinkPreview)
+	bus.Subscribe(events.ChirpUpdated, "link_previews", cfg.queueLinkPreview)
+}
+
+// enqueueWebhookDeliveries queues the event for every webhook subscription
+// that wants it, queueing it again is a no-op
+func (cfg *APIConfig) enqueueWebhookDeliveries(ctx context.Context, event events.Event) error {
+	webhookEvent := dispatch.NewEvent(event)
+	payload, err := json.Marshal(webhookEvent)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.DB.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   webhookEvent.ID,
+		EventType: webhookEvent.Type,
+		Payload:   string(payload),
+		UserID:    event.UserID,
+	})
+	return err
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+// fakeQuery answers one sqlc query: the rows it returns, or for :exec and
+// :execrows queries one row per affected row
+type fakeQuery func(args []driver.Value) ([][]driver.Value, error)
+
+// fakeCall is a query a fakeDB ran, transactions show up as BEGIN, COMMIT
+// and ROLLBACK
+type fakeCall struct {
+	Name string
+	Args []driver.Value
+}
+
+// fakeDB is a database/sql driver answering sqlc queries by name, so
+// handlers can be tested without Postgres. Queries it has no answer for
+// fail. What the queries themselves select is covered by the tests in
+// internal/database, which need Postgres.
+type fakeDB struct {
+	mu      sync.Mutex
+	queries map[string]fakeQuery
+	calls   []fakeCall
+}
+
+var sqlcQueryName = regexp.MustCompile(`-- name: (\w+)`)
+
+// testAPIConfig returns an APIConfig backed by a fakeDB answering queries,
+// every account is active unless IsUserActive says otherwise
+func testAPIConfig(t *testing.T, queries map[string]fakeQuery) (*APIConfig, *fakeDB) {
+	t.Helper()
+	db := &fakeDB{queries: map[string]fakeQuery{
+		"IsUserActive": func([]driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{true}}, nil
+		},
+	}}
+	for name, query := range queries {
+		db.queries[name] = query
+	}
+	conn := sql.OpenDB(fakeConnector{db})
+	t.Cleanup(func() { conn.Close() })
+	return &APIConfig{
+		JWTTokenSecret: "test-secret",
+		DB:             database.New(conn),
+		DBConn:         conn,
+	}, db
+}
+
+// called lists the names of the queries run so far, in order
+func (db *fakeDB) called() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	names := make([]string, 0, len(db.calls))
+	for _, call := range db.calls {
+		names = append(names, call.Name)
+	}
+	return names
+}
+
+func (db *fakeDB) record(name string, args []driver.Value) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls = append(db.calls, fakeCall{Name: name, Args: args})
+}
+
+func (db *fakeDB) run(query string, args []driver.Value) ([][]driver.Value, error) {
+	m := sqlcQueryName.FindStringSubmatch(query)
+	if m == nil {
+		return nil, fmt.Errorf("fakedb: not a sqlc query: %q", query)
+	}
+	db.record(m[1], args)
+	db.mu.Lock()
+	answer, ok := db.queries[m[1]]
+	db.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("fakedb: unexpected query %s", m[1])
+	}
+	return answer(args)
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{c.db}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fakedb: open through a connector")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN", nil)
+	return fakeTx{c.db}, nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx fakeTx) Commit() error {
+	tx.db.record("COMMIT", nil)
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.db.record("ROLLBACK", nil)
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
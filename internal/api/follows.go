@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+func (cfg *APIConfig) FollowUser(w http.ResponseWriter, r *http.Request) {
+	followerID, followeeID, ok := cfg.parseUserRequest(w, r, auth.ScopeFollowsWrite, "You can't follow yourself")
+	if !ok {
+		return
+	}
+
+	err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+		if err := lockActiveUser(r.Context(), q, followeeID); err != nil {
+			return err
+		}
+		blocked, err := q.IsBlockedEitherWay(r.Context(), database.IsBlockedEitherWayParams{
+			UserID:  followerID,
+			OtherID: followeeID,
+		})
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return errBlocked
+		}
+		follow, err := q.FollowUser(r.Context(), database.FollowUserParams{
+			FollowerID: followerID,
+			FolloweeID: followeeID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// already following, nothing changed
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return events.Record(r.Context(), q, events.UserFollowed, followerID, follow)
+	})
+	if errors.Is(err, errUserNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "No user found")
+		return
+	}
+	if errors.Is(err, errBlocked) {
+		utils.RespondWithError(w, http.StatusForbidden, "You can't follow this user")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *APIConfig) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	followerID, followeeID, ok := cfg.parseUserRequest(w, r, auth.ScopeFollowsWrite, "You can't follow yourself")
+	if !ok {
+		return
+	}
+
+	_, err := cfg.DB.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// errUserNotFound is returned in a transaction when the other user is
+// deleted
+var errUserNotFound = errors.New("user not found")
+
+// lockActiveUser keeps userID from being deleted until the transaction
+// ends, so nothing new points at an account pending deletion
+func lockActiveUser(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	_, err := q.LockActiveUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUserNotFound
+	}
+	return err
+}
+
+// parseUserRequest authenticates the user acting on another, whose ID is in
+// the path, and resolves them. Acting on themselves is refused with
+// selfError. It writes the error response itself when it returns false.
+func (cfg *APIConfig) parseUserRequest(w http.ResponseWriter, r *http.Request, scope auth.Scope, selfError string) (uuid.UUID, uuid.UUID, bool) {
+	accessToken, err := cfg.authenticate(r, scope)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID := accessToken.UserID
+
+	otherID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID passed")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if otherID == userID {
+		utils.RespondWithError(w, http.StatusBadRequest, selfError)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	_, err = cfg.DB.GetUserByID(r.Context(), otherID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No user found")
+			return uuid.Nil, uuid.Nil, false
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, otherID, true
+}
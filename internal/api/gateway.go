@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/fanout"
+	"github.com/maniac-en/chirpstack/internal/gateway"
+	"github.com/maniac-en/chirpstack/internal/utils"
+	"github.com/maniac-en/chirpstack/internal/websocket"
+)
+
+// a # that isn't part of a word or an HTML entity starts a hashtag, longer
+// words aren't hashtags
+var hashtagRegexp = regexp.MustCompile(`(?:^|[^\w#&])#(\w{1,50})\b`)
+
+// ParseHashtags returns the lowercased hashtags in body, in order and
+// without duplicates
+func ParseHashtags(body string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagRegexp.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// LiveGateway upgrades the request to a WebSocket speaking the gateway
+// protocol. The access token is checked before upgrading, so a bad one gets
+// a plain HTTP error.
+func (cfg *APIConfig) LiveGateway(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	if cfg.Gateway == nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "live updates are not available")
+		return
+	}
+
+	// Upgrade responds itself when the handshake is invalid
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	cfg.Gateway.Serve(conn, accessToken.UserID)
+}
+
+// AuthorizeGatewayUser refuses userID's subscription to the chirps of
+// authorID when either blocked the other. Those subscribed before a block
+// are left out when chirps are published instead.
+func (cfg *APIConfig) AuthorizeGatewayUser(userID, authorID uuid.UUID) error {
+	blocked, err := cfg.DB.IsBlockedEitherWay(context.Background(), database.IsBlockedEitherWayParams{
+		UserID:  userID,
+		OtherID: authorID,
+	})
+	if err != nil {
+		log.Printf("checking blocks for a gateway subscription: %v", err)
+		return errors.New("Something went wrong")
+	}
+	if blocked {
+		return errors.New("you can't subscribe to this user")
+	}
+	return nil
+}
+
+// gatewayChirpEvent publishes a chirp event to the timelines of the author
+// and the followers who may see it, leaving out followers who muted a word
+// in a new or edited chirp. Anyone can subscribe to the author's topic and
+// hashtags, so only public chirps go to those, and not to users blocked
+// either way by the author.
+func (cfg *APIConfig) gatewayChirpEvent(ctx context.Context, event events.Event) error {
+	var chirp chirpResponse
+	if err := event.Decode(&chirp); err != nil {
+		return err
+	}
+	if !chirp.UserID.Valid {
+		return nil
+	}
+	followerIDs, err := cfg.DB.GetTimelineFollowerIDs(ctx, chirp.UserID.UUID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(chirp)
+	if err != nil {
+		return err
+	}
+
+	audience := chirpAudience(chirp.Chirp, followerIDs)
+	if event.Type != events.ChirpDeleted {
+		audience, err = cfg.withoutMutedWords(ctx, chirp.Chirp, audience)
+		if err != nil {
+			return err
+		}
+	}
+	var topics []string
+	for _, userID := range audience {
+		topics = append(topics, gateway.TimelineTopic(userID))
+	}
+	var excludedUserIDs []uuid.UUID
+	if chirp.Visibility == VisibilityPublic {
+		topics = append(topics, gateway.UserTopic(chirp.UserID.UUID))
+		for _, tag := range ParseHashtags(chirp.Body) {
+			topics = append(topics, gateway.HashtagTopic(tag))
+		}
+		excludedUserIDs, err = cfg.DB.ListUserIDsBlockedEitherWay(ctx, chirp.UserID.UUID)
+		if err != nil {
+			return err
+		}
+	}
+	return cfg.publishRealtime(ctx, fanout.Message{
+		Event:           event.Type,
+		Data:            data,
+		Topics:          topics,
+		ExcludedUserIDs: excludedUserIDs,
+	})
+}
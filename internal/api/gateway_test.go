@@ -0,0 +1,216 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/gateway"
+	"github.com/maniac-en/chirpstack/internal/websocket"
+)
+
+func TestParseHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "none", body: "hello world", want: nil},
+		{name: "start of body", body: "#go is fun", want: []string{"go"}},
+		{name: "punctuation", body: "loving (#Go), #rust!", want: []string{"go", "rust"}},
+		{name: "lowercased and deduped", body: "#Go #go #GO", want: []string{"go"}},
+		{name: "inside a word", body: "issue#42 and C#", want: nil},
+		{name: "html entity", body: "&#39;quoted&#39;", want: nil},
+		{name: "too long", body: "#" + strings.Repeat("a", 51), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseHashtags(tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseHashtags(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_LiveGateway(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	cfg.Gateway = gateway.New()
+	userID := uuid.New()
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(cfg.LiveGateway))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("Dial() unexpected error = %v", err)
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+
+	receive := func() gateway.Message {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() unexpected error = %v", err)
+		}
+		var message gateway.Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatalf("invalid message %q: %v", data, err)
+		}
+		return message
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribe","topic":"timeline"}`)); err != nil {
+		t.Fatalf("WriteMessage() unexpected error = %v", err)
+	}
+	if got := receive(); got.Type != gateway.TypeSubscribed {
+		t.Fatalf("got %+v, want the subscription confirmed", got)
+	}
+	cfg.Gateway.Publish(gateway.TimelineTopic(userID), StreamEventChirpCreated, []byte(`{"body":"hi"}`))
+	if got := receive(); got.Type != gateway.TypeEvent || got.Event != StreamEventChirpCreated || got.Topic != "timeline" {
+		t.Errorf("got %+v, want the chirp on the user's timeline", got)
+	}
+}
+
+func TestAPIConfig_LiveGateway_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	thirdPartyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), auth.ValidScopes(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		gateway        *gateway.Gateway
+		expectedStatus int
+	}{
+		{name: "no token", gateway: gateway.New(), expectedStatus: http.StatusUnauthorized},
+		{name: "invalid token", token: "nope", gateway: gateway.New(), expectedStatus: http.StatusUnauthorized},
+		{name: "third-party token", token: thirdPartyToken, gateway: gateway.New(), expectedStatus: http.StatusForbidden},
+		{name: "no gateway", token: token, expectedStatus: http.StatusServiceUnavailable},
+		{name: "not an upgrade", token: token, gateway: gateway.New(), expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Gateway = tt.gateway
+			req := httptest.NewRequest("GET", "/api/ws", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			cfg.LiveGateway(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_GatewayChirpEvent_Blocks(t *testing.T) {
+	authorID := uuid.New()
+	followerID := uuid.New()
+	blockedID := uuid.New()
+	blockerID := uuid.New()
+
+	tests := []struct {
+		name         string
+		visibility   string
+		wantExcluded string
+	}{
+		// the user topic and hashtags can be subscribed to by anyone
+		{name: "public", visibility: VisibilityPublic, wantExcluded: `{"` + blockedID.String() + `","` + blockerID.String() + `"}`},
+		// only timelines get it, and blocks already removed the follows
+		{name: "followers only", visibility: VisibilityFollowers, wantExcluded: "{}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var topics, excluded driver.Value
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"GetTimelineFollowerIDs": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{{followerID.String()}}, nil
+				},
+				"ListActiveMutedWordsByUsers": func([]driver.Value) ([][]driver.Value, error) {
+					return nil, nil
+				},
+				"ListUserIDsBlockedEitherWay": func(args []driver.Value) ([][]driver.Value, error) {
+					if args[0] != authorID.String() {
+						t.Errorf("ListUserIDsBlockedEitherWay() user = %v, want the author", args[0])
+					}
+					return [][]driver.Value{{blockedID.String()}, {blockerID.String()}}, nil
+				},
+				"CreateRealtimeMessage": func(args []driver.Value) ([][]driver.Value, error) {
+					topics, excluded = args[3], args[4]
+					return nil, nil
+				},
+			})
+			payload, err := json.Marshal(chirpResponse{Chirp: database.Chirp{
+				ID:           uuid.New(),
+				Body:         "hello #go",
+				UserID:       uuid.NullUUID{UUID: authorID, Valid: true},
+				Visibility:   tt.visibility,
+				MentionedIds: []uuid.UUID{},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = cfg.gatewayChirpEvent(t.Context(), events.Event{Type: events.ChirpCreated, UserID: authorID, Payload: payload})
+			if err != nil {
+				t.Fatalf("gatewayChirpEvent() unexpected error = %v", err)
+			}
+			if excluded != tt.wantExcluded {
+				t.Errorf("excluded users = %v, want %v", excluded, tt.wantExcluded)
+			}
+			if tt.visibility != VisibilityPublic {
+				for _, name := range db.called() {
+					if name == "ListUserIDsBlockedEitherWay" {
+						t.Error("blocks were looked up for a chirp only timelines get")
+					}
+				}
+				return
+			}
+			want := `{"` + strings.Join([]string{
+				gateway.TimelineTopic(followerID),
+				gateway.TimelineTopic(authorID),
+				gateway.UserTopic(authorID),
+				gateway.HashtagTopic("go"),
+			}, `","`) + `"}`
+			if topics != want {
+				t.Errorf("topics = %v, want %v", topics, want)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_AuthorizeGatewayUser(t *testing.T) {
+	for _, blocked := range []bool{false, true} {
+		cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+			"IsBlockedEitherWay": func([]driver.Value) ([][]driver.Value, error) {
+				return [][]driver.Value{{blocked}}, nil
+			},
+		})
+		err := cfg.AuthorizeGatewayUser(uuid.New(), uuid.New())
+		if (err != nil) != blocked {
+			t.Errorf("AuthorizeGatewayUser() with blocked = %v error = %v", blocked, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+const MaxAPIKeyNameLength = 100
+
+func (cfg *APIConfig) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type requestBody struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	type responseBody struct {
+		database.ApiKey
+		Key string `json:"key"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || utf8.RuneCountInString(params.Name) > MaxAPIKeyNameLength {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("name must be 1-%d characters", MaxAPIKeyNameLength))
+		return
+	}
+	// keys without explicit scopes can do anything a third-party app could
+	scopes := auth.ValidScopes()
+	if len(params.Scopes) > 0 {
+		scopes, err = auth.ParseScopes(strings.Join(params.Scopes, " "))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var expiresAt sql.NullTime
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			utils.RespondWithError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	entitlements, err := cfg.entitlements(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	count, err := cfg.DB.CountAPIKeysByUserID(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if count >= int64(entitlements.MaxAPIKeys()) {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("at most %d API keys allowed on the %s plan, revoke one first", entitlements.MaxAPIKeys(), entitlements.Plan()))
+		return
+	}
+
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	apiKey, err := cfg.DB.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    accessToken.UserID,
+		Name:      params.Name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashToken(key),
+		Scopes:    scopeStrings(scopes),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, responseBody{apiKey, key})
+}
+
+func (cfg *APIConfig) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	apiKeys, err := cfg.DB.GetAPIKeysByUserID(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if apiKeys == nil {
+		apiKeys = []database.ApiKey{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, apiKeys)
+}
+
+func (cfg *APIConfig) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	keyID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid key ID passed")
+		return
+	}
+
+	revoked, err := cfg.DB.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: accessToken.UserID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if revoked == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "No API key found")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+func (cfg *APIConfig) LikeChirp(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.parseChirpRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+		like, err := q.LikeChirp(r.Context(), database.LikeChirpParams{
+			UserID:  userID,
+			ChirpID: chirpID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// already liked, nothing changed
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return events.Record(r.Context(), q, events.ChirpLiked, userID, like)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (cfg *APIConfig) UnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.parseChirpRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.DB.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// parseChirpRequest authenticates the user and resolves the chirp from the
+// path, writing the error response itself when it returns false
+func (cfg *APIConfig) parseChirpRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID passed")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	// chirps the user can't see can't be liked or bookmarked
+	_, err = cfg.DB.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       chirpID,
+		ViewerID: uuid.NullUUID{UUID: accessToken.UserID, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No chirp found")
+			return uuid.Nil, uuid.Nil, false
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return accessToken.UserID, chirpID, true
+}
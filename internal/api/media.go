@@ -0,0 +1,339 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/media"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+const (
+	// MaxMediaPerChirp is how many uploads one chirp can carry
+	MaxMediaPerChirp = 4
+	// UnattachedMediaRetention is how long an upload waits to be attached
+	// to a chirp before it's deleted
+	UnattachedMediaRetention = 24 * time.Hour
+	// mediaJanitorBatchSize is how many attachments the janitor deletes
+	// per run
+	mediaJanitorBatchSize = 100
+)
+
+// errInvalidMedia is returned when a chirp's media_ids aren't all the
+// user's own unattached uploads
+var errInvalidMedia = errors.New("invalid media")
+
+// mediaResponse is an attachment as the API returns it, its blobs are
+// served through URL and ThumbnailURL
+type mediaResponse struct {
+	ID           uuid.UUID `json:"id"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+}
+
+func newMediaResponse(attachment database.MediaAttachment) mediaResponse {
+	url := "/api/media/" + attachment.ID.String()
+	return mediaResponse{
+		ID:           attachment.ID,
+		ContentType:  attachment.ContentType,
+		Size:         attachment.Size,
+		Width:        attachment.Width,
+		Height:       attachment.Height,
+		URL:          url,
+		ThumbnailURL: url + "/thumbnail",
+	}
+}
+
+// attachMedia attaches the user's uploads to a new chirp, in the order
+// given, or returns errInvalidMedia
+func attachMedia(ctx context.Context, q *database.Queries, userID uuid.UUID, chirpID uuid.UUID, mediaIDs []uuid.UUID) ([]mediaResponse, error) {
+	responses := []mediaResponse{}
+	if len(mediaIDs) == 0 {
+		return responses, nil
+	}
+	attachments, err := q.AttachMediaToChirp(ctx, database.AttachMediaToChirpParams{
+		ChirpID: uuid.NullUUID{UUID: chirpID, Valid: true},
+		Ids:     mediaIDs,
+		UserID:  uuid.NullUUID{UUID: userID, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) != len(mediaIDs) {
+		return nil, errInvalidMedia
+	}
+	slices.SortFunc(attachments, func(a, b database.MediaAttachment) int { return int(a.Position - b.Position) })
+	for _, attachment := range attachments {
+		responses = append(responses, newMediaResponse(attachment))
+	}
+	return responses, nil
+}
+
+// UploadMedia stores an image sent as the "file" field of a multipart form.
+// It's attached to a chirp by passing its ID in media_ids when creating
+// the chirp.
+func (cfg *APIConfig) UploadMedia(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	if cfg.Media == nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "media uploads are not available")
+		return
+	}
+
+	// room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxSize+64<<10)
+	defer r.Body.Close()
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "expected a multipart/form-data upload")
+		return
+	}
+	var data []byte
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				utils.RespondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("files must be at most %d bytes", media.MaxSize))
+				return
+			}
+			utils.RespondWithError(w, http.StatusBadRequest, "expected the image in a form field named file")
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		data, err = io.ReadAll(io.LimitReader(part, media.MaxSize+1))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				utils.RespondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("files must be at most %d bytes", media.MaxSize))
+				return
+			}
+			utils.RespondWithError(w, http.StatusBadRequest, "invalid upload")
+			return
+		}
+		break
+	}
+
+	image, err := media.Process(data)
+	switch {
+	case errors.Is(err, media.ErrTooLarge):
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("files must be at most %d bytes", media.MaxSize))
+		return
+	case errors.Is(err, media.ErrUnsupportedType):
+		utils.RespondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	case errors.Is(err, media.ErrTooManyPixels), errors.Is(err, media.ErrInvalidImage):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	id := uuid.New()
+	blobKey, thumbnailKey := id.String()+"/original", id.String()+"/thumbnail"
+	if err := cfg.Media.Put(r.Context(), blobKey, image.Data, image.ContentType); err != nil {
+		log.Printf("storing media %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if err := cfg.Media.Put(r.Context(), thumbnailKey, image.Thumbnail, image.ThumbnailContentType); err != nil {
+		log.Printf("storing media %s: %v", id, err)
+		cfg.deleteBlobs(r.Context(), blobKey)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	attachment, err := cfg.DB.CreateMediaAttachment(r.Context(), database.CreateMediaAttachmentParams{
+		ID:                   id,
+		UserID:               uuid.NullUUID{UUID: accessToken.UserID, Valid: true},
+		ContentType:          image.ContentType,
+		Size:                 int64(len(image.Data)),
+		Width:                int32(image.Width),
+		Height:               int32(image.Height),
+		BlobKey:              blobKey,
+		ThumbnailKey:         thumbnailKey,
+		ThumbnailContentType: image.ThumbnailContentType,
+	})
+	if err != nil {
+		cfg.deleteBlobs(r.Context(), blobKey, thumbnailKey)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, newMediaResponse(attachment))
+}
+
+func (cfg *APIConfig) GetMedia(w http.ResponseWriter, r *http.Request) {
+	cfg.serveMedia(w, r, false)
+}
+
+func (cfg *APIConfig) GetMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	cfg.serveMedia(w, r, true)
+}
+
+// serveMedia sends an attachment's image or thumbnail to those who can see
+// its chirp, and to its uploader. Blobs never change, so they can be cached
+// for good, but only by the viewer as who may see them depends on who asks.
+func (cfg *APIConfig) serveMedia(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	if cfg.Media == nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "media is not available")
+		return
+	}
+	viewerID, err := cfg.authenticateViewer(r)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid media ID passed")
+		return
+	}
+	attachment, err := cfg.DB.GetMediaAttachment(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No media found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	visible, err := cfg.canViewMedia(r.Context(), viewerID, attachment)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if !visible {
+		// the same answer as for media that doesn't exist, so IDs of
+		// hidden media can't be probed
+		utils.RespondWithError(w, http.StatusNotFound, "No media found")
+		return
+	}
+
+	key, contentType := attachment.BlobKey, attachment.ContentType
+	if thumbnail {
+		key, contentType = attachment.ThumbnailKey, attachment.ThumbnailContentType
+	}
+	blob, err := cfg.Media.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, media.ErrNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "No media found")
+			return
+		}
+		log.Printf("reading media %s: %v", id, err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	if !thumbnail {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, blob)
+}
+
+// canViewMedia reports whether viewerID may see attachment. Uploaders always
+// see their own, whether attached, scheduled or not yet used. Anyone else
+// needs to be able to see its published chirp, as GetChirpByID decides.
+func (cfg *APIConfig) canViewMedia(ctx context.Context, viewerID uuid.NullUUID, attachment database.MediaAttachment) (bool, error) {
+	if attachment.AttachedAt.Valid && !attachment.ChirpID.Valid {
+		// its chirp was deleted, the janitor removes it soon
+		return false, nil
+	}
+	if viewerID.Valid && attachment.UserID.Valid && attachment.UserID.UUID == viewerID.UUID {
+		return true, nil
+	}
+	if !attachment.ChirpID.Valid {
+		return false, nil
+	}
+	_, err := cfg.DB.GetChirpByID(ctx, database.GetChirpByIDParams{
+		ID:       attachment.ChirpID.UUID,
+		ViewerID: viewerID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RunMediaJanitor deletes uploads never attached to a chirp and those whose
+// chirp was deleted, blobs first, every interval until ctx is done
+func (cfg *APIConfig) RunMediaJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if cfg.Media != nil {
+			deleted, err := cfg.deleteOrphanedMedia(ctx)
+			if err != nil {
+				log.Printf("media janitor: %v", err)
+			} else if deleted > 0 {
+				log.Printf("media janitor: deleted %d attachment(s)", deleted)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *APIConfig) deleteOrphanedMedia(ctx context.Context) (int, error) {
+	attachments, err := cfg.DB.ListOrphanedMediaAttachments(ctx, database.ListOrphanedMediaAttachmentsParams{
+		CreatedAt: time.Now().UTC().Add(-UnattachedMediaRetention),
+		Limit:     mediaJanitorBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, attachment := range attachments {
+		// the row goes last, so blobs that fail to delete are retried
+		if err := cfg.Media.Delete(ctx, attachment.BlobKey); err != nil {
+			return deleted, err
+		}
+		if err := cfg.Media.Delete(ctx, attachment.ThumbnailKey); err != nil {
+			return deleted, err
+		}
+		if err := cfg.DB.DeleteMediaAttachment(ctx, attachment.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteBlobs cleans up after a failed upload, a blob it misses is only
+// wasted space
+func (cfg *APIConfig) deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := cfg.Media.Delete(ctx, key); err != nil {
+			log.Printf("deleting blob %s: %v", key, err)
+		}
+	}
+}
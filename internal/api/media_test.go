@@ -0,0 +1,310 @@
+package api
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/media"
+)
+
+// multipartUpload builds a form with data in the named field
+func multipartUpload(t *testing.T, field string, data []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, form.FormDataContentType()
+}
+
+func TestAPIConfig_UploadMedia_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	readOnlyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), []auth.Scope{auth.ScopeProfileRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	text, textType := multipartUpload(t, "file", []byte("just some text"))
+	wrongField, wrongFieldType := multipartUpload(t, "image", []byte("GIF89a"))
+	huge, hugeType := multipartUpload(t, "file", make([]byte, media.MaxSize+1))
+
+	tests := []struct {
+		name           string
+		token          string
+		store          media.BlobStore
+		body           *bytes.Buffer
+		contentType    string
+		expectedStatus int
+	}{
+		{name: "no token", store: media.FileStore{Dir: t.TempDir()}, body: text, contentType: textType, expectedStatus: http.StatusUnauthorized},
+		{name: "missing scope", token: readOnlyToken, store: media.FileStore{Dir: t.TempDir()}, body: text, contentType: textType, expectedStatus: http.StatusForbidden},
+		{name: "no blob store", token: token, body: text, contentType: textType, expectedStatus: http.StatusServiceUnavailable},
+		{name: "not multipart", token: token, store: media.FileStore{Dir: t.TempDir()}, body: bytes.NewBufferString(`{}`), contentType: "application/json", expectedStatus: http.StatusBadRequest},
+		{name: "no file field", token: token, store: media.FileStore{Dir: t.TempDir()}, body: wrongField, contentType: wrongFieldType, expectedStatus: http.StatusBadRequest},
+		{name: "not an image", token: token, store: media.FileStore{Dir: t.TempDir()}, body: text, contentType: textType, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "too large", token: token, store: media.FileStore{Dir: t.TempDir()}, body: huge, contentType: hugeType, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Media = tt.store
+			req := httptest.NewRequest("POST", "/api/media", bytes.NewReader(tt.body.Bytes()))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			cfg.UploadMedia(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_UploadMedia(t *testing.T) {
+	userID := uuid.New()
+	var stored []driver.Value
+	cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+		"CreateMediaAttachment": func(args []driver.Value) ([][]driver.Value, error) {
+			stored = args
+			return [][]driver.Value{{args[0], time.Now(), args[1], nil, nil, int64(0), args[2], args[3], args[4], args[5], args[6], args[7], args[8]}}, nil
+		},
+	})
+	store := media.FileStore{Dir: t.TempDir()}
+	cfg.Media = store
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	body, contentType := multipartUpload(t, "file", img.Bytes())
+	req := httptest.NewRequest("POST", "/api/media", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.UploadMedia(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+
+	var resp mediaResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContentType != "image/png" || resp.Width != 40 || resp.Height != 30 {
+		t.Errorf("response = %+v, want a 40x30 image/png", resp)
+	}
+	if want := "/api/media/" + resp.ID.String(); resp.URL != want || resp.ThumbnailURL != want+"/thumbnail" {
+		t.Errorf("URLs = %q, %q, want them under %q", resp.URL, resp.ThumbnailURL, want)
+	}
+	if stored[1] != userID.String() {
+		t.Errorf("CreateMediaAttachment user = %v, want %v", stored[1], userID)
+	}
+
+	// both blobs are in the store under the keys that were saved
+	for _, key := range []driver.Value{stored[6], stored[7]} {
+		blob, err := store.Get(t.Context(), key.(string))
+		if err != nil {
+			t.Fatalf("Get(%v) unexpected error = %v", key, err)
+		}
+		blob.Close()
+	}
+}
+
+func TestAPIConfig_GetMedia_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		token          string
+		store          media.BlobStore
+		expectedStatus int
+	}{
+		{name: "no blob store", id: uuid.NewString(), expectedStatus: http.StatusServiceUnavailable},
+		{name: "invalid token", id: uuid.NewString(), token: "nope", store: media.FileStore{Dir: t.TempDir()}, expectedStatus: http.StatusUnauthorized},
+		{name: "invalid id", id: "nope", store: media.FileStore{Dir: t.TempDir()}, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &APIConfig{Media: tt.store}
+			req := httptest.NewRequest("GET", "/api/media/"+tt.id, nil)
+			req.SetPathValue("id", tt.id)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			cfg.GetMedia(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_GetMedia_Visibility(t *testing.T) {
+	uploaderID := uuid.New()
+	viewerID := uuid.New()
+	chirpID := uuid.New()
+	store := media.FileStore{Dir: t.TempDir()}
+	if err := store.Put(t.Context(), "media/image.png", []byte("image"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	// attachmentRow is an upload of uploaderID, attached to chirp if it's
+	// not nil
+	attachmentRow := func(args []driver.Value, chirp any) []driver.Value {
+		var attachedAt any
+		if chirp != nil {
+			attachedAt = time.Now()
+		}
+		return []driver.Value{args[0], time.Now(), uploaderID.String(), chirp, attachedAt, int64(0), "image/png", int64(5), int64(1), int64(1), "media/image.png", "media/image.png", "image/png"}
+	}
+
+	tests := []struct {
+		name           string
+		userID         uuid.UUID
+		chirp          any
+		chirpVisible   bool
+		expectedStatus int
+	}{
+		{name: "visible chirp, anonymous", chirp: chirpID.String(), chirpVisible: true, expectedStatus: http.StatusOK},
+		{name: "hidden chirp, anonymous", chirp: chirpID.String(), expectedStatus: http.StatusNotFound},
+		{name: "hidden chirp, other user", userID: viewerID, chirp: chirpID.String(), expectedStatus: http.StatusNotFound},
+		{name: "visible chirp, other user", userID: viewerID, chirp: chirpID.String(), chirpVisible: true, expectedStatus: http.StatusOK},
+		{name: "hidden chirp, uploader", userID: uploaderID, chirp: chirpID.String(), expectedStatus: http.StatusOK},
+		{name: "unattached, uploader", userID: uploaderID, expectedStatus: http.StatusOK},
+		{name: "unattached, other user", userID: viewerID, expectedStatus: http.StatusNotFound},
+		{name: "unattached, anonymous", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var askedViewer driver.Value
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"GetMediaAttachment": func(args []driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{attachmentRow(args, tt.chirp)}, nil
+				},
+				"GetChirpByID": func(args []driver.Value) ([][]driver.Value, error) {
+					askedViewer = args[1]
+					if !tt.chirpVisible {
+						return nil, nil
+					}
+					return [][]driver.Value{{args[0], time.Now(), time.Now(), "hi", uploaderID.String(), nil, "published", nil, VisibilityPublic, "{}"}}, nil
+				},
+			})
+			cfg.Media = store
+			id := uuid.NewString()
+			req := httptest.NewRequest("GET", "/api/media/"+id, nil)
+			req.SetPathValue("id", id)
+			if tt.userID != uuid.Nil {
+				token, err := auth.MakeJWT(tt.userID, cfg.JWTTokenSecret)
+				if err != nil {
+					t.Fatalf("MakeJWT() unexpected error = %v", err)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			cfg.GetMedia(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+			if w.Code == http.StatusOK && w.Header().Get("Cache-Control") != "private, max-age=31536000, immutable" {
+				t.Errorf("Cache-Control = %q, want it private", w.Header().Get("Cache-Control"))
+			}
+
+			// the uploader and unattached uploads never need the chirp
+			asked := false
+			for _, name := range db.called() {
+				asked = asked || name == "GetChirpByID"
+			}
+			if want := tt.chirp != nil && tt.userID != uploaderID; asked != want {
+				t.Errorf("GetChirpByID called = %v, want %v", asked, want)
+			}
+			if asked {
+				var want driver.Value
+				if tt.userID != uuid.Nil {
+					want = tt.userID.String()
+				}
+				if askedViewer != want {
+					t.Errorf("GetChirpByID viewer = %v, want %v", askedViewer, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewMediaResponse(t *testing.T) {
+	id := uuid.New()
+	got := newMediaResponse(database.MediaAttachment{ID: id})
+	if got.URL != "/api/media/"+id.String() || got.ThumbnailURL != "/api/media/"+id.String()+"/thumbnail" {
+		t.Errorf("newMediaResponse() URLs = %s, %s", got.URL, got.ThumbnailURL)
+	}
+}
+
+func TestAPIConfig_DeleteOrphanedMedia(t *testing.T) {
+	var createdBefore driver.Value
+	var deletedRows []driver.Value
+	cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+		"ListOrphanedMediaAttachments": func(args []driver.Value) ([][]driver.Value, error) {
+			createdBefore = args[0]
+			return [][]driver.Value{{uuid.NewString(), time.Now(), uuid.NewString(), nil, nil, int64(0), "image/png", int64(5), int64(1), int64(1), "orphan/original", "orphan/thumbnail", "image/png"}}, nil
+		},
+		"DeleteMediaAttachment": func(args []driver.Value) ([][]driver.Value, error) {
+			deletedRows = append(deletedRows, args[0])
+			return nil, nil
+		},
+	})
+	store := media.FileStore{Dir: t.TempDir()}
+	for _, key := range []string{"orphan/original", "orphan/thumbnail"} {
+		if err := store.Put(t.Context(), key, []byte("image"), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg.Media = store
+
+	deleted, err := cfg.deleteOrphanedMedia(t.Context())
+	if err != nil || deleted != 1 || len(deletedRows) != 1 {
+		t.Fatalf("deleteOrphanedMedia() = %d, %v, deleted rows %v, want the one orphan", deleted, err, deletedRows)
+	}
+	for _, key := range []string{"orphan/original", "orphan/thumbnail"} {
+		if _, err := store.Get(t.Context(), key); !errors.Is(err, media.ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", key, err)
+		}
+	}
+
+	// created_at has no time zone and is set by NOW()
+	got, ok := createdBefore.(time.Time)
+	if !ok {
+		t.Fatalf("ListOrphanedMediaAttachments created_at = %#v, want a time", createdBefore)
+	}
+	if got.Location() != time.UTC {
+		t.Errorf("ListOrphanedMediaAttachments created_at = %v, want it in UTC", got)
+	}
+	if want := time.Now().Add(-UnattachedMediaRetention); got.Sub(want).Abs() > time.Minute {
+		t.Errorf("ListOrphanedMediaAttachments created_at = %v, want about %v", got, want)
+	}
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+const (
+	MaxMutedWordsPerUser = 100
+	// MaxMutedWordLength is the longest phrase that can be muted, in
+	// characters
+	MaxMutedWordLength = 100
+	// mutedWordCacheTTL is how long a user's matcher is used before their
+	// muted words are read again. Changes made on this instance apply at
+	// once, those made on others within the TTL.
+	mutedWordCacheTTL = time.Minute
+	// maxCachedMatchers bounds the cache, it's emptied when it fills up
+	// with matchers that are all still fresh
+	maxCachedMatchers = 10000
+)
+
+// errTooManyMutedWords is returned in a transaction when the user is at
+// MaxMutedWordsPerUser
+var errTooManyMutedWords = fmt.Errorf("at most %d muted words allowed", MaxMutedWordsPerUser)
+
+// mutedWordCache holds a compiled matcher of each user's muted words, so
+// read paths don't query or compile them for every chirp. The zero value is
+// ready to use.
+type mutedWordCache struct {
+	mu      sync.Mutex
+	entries map[uuid.UUID]mutedWordEntry
+}
+
+type mutedWordEntry struct {
+	matcher *utils.PhraseMatcher
+	// when the matcher must be rebuilt: after the TTL, or sooner when one
+	// of its phrases expires
+	expiresAt time.Time
+}
+
+func (c *mutedWordCache) get(userID uuid.UUID, now time.Time) (*utils.PhraseMatcher, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[userID]
+	if !ok || !now.Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.matcher, true
+}
+
+func (c *mutedWordCache) put(userID uuid.UUID, entry mutedWordEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[uuid.UUID]mutedWordEntry)
+	}
+	if _, ok := c.entries[userID]; !ok && len(c.entries) >= maxCachedMatchers {
+		for id, cached := range c.entries {
+			if !now.Before(cached.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= maxCachedMatchers {
+			clear(c.entries)
+		}
+	}
+	c.entries[userID] = entry
+}
+
+func (c *mutedWordCache) invalidate(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+}
+
+// mutedWordMatchers returns the matcher of each of userIDs' muted words,
+// reading those not cached in a single query
+func (cfg *APIConfig) mutedWordMatchers(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]*utils.PhraseMatcher, error) {
+	now := time.Now()
+	matchers := make(map[uuid.UUID]*utils.PhraseMatcher, len(userIDs))
+	var missing []uuid.UUID
+	for _, userID := range userIDs {
+		if _, ok := matchers[userID]; ok {
+			continue
+		}
+		matcher, ok := cfg.mutedWords.get(userID, now)
+		if !ok {
+			missing = append(missing, userID)
+		}
+		matchers[userID] = matcher
+	}
+	if len(missing) == 0 {
+		return matchers, nil
+	}
+
+	rows, err := cfg.DB.ListActiveMutedWordsByUsers(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	phrases := make(map[uuid.UUID][]string)
+	expiresAt := make(map[uuid.UUID]time.Time)
+	for _, userID := range missing {
+		expiresAt[userID] = now.Add(mutedWordCacheTTL)
+	}
+	for _, row := range rows {
+		phrases[row.UserID] = append(phrases[row.UserID], row.Phrase)
+		if row.ExpiresAt.Valid && row.ExpiresAt.Time.Before(expiresAt[row.UserID]) {
+			expiresAt[row.UserID] = row.ExpiresAt.Time
+		}
+	}
+	for _, userID := range missing {
+		matcher := utils.NewPhraseMatcher(phrases[userID])
+		cfg.mutedWords.put(userID, mutedWordEntry{matcher: matcher, expiresAt: expiresAt[userID]}, now)
+		matchers[userID] = matcher
+	}
+	return matchers, nil
+}
+
+// withoutMutedWords drops the users of userIDs who muted a word or phrase
+// in chirp. Its author always gets it.
+func (cfg *APIConfig) withoutMutedWords(ctx context.Context, chirp database.Chirp, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	matchers, err := cfg.mutedWordMatchers(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]uuid.UUID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if chirp.UserID.UUID == userID || !matchers[userID].Match(chirp.Body) {
+			kept = append(kept, userID)
+		}
+	}
+	return kept, nil
+}
+
+// hideMutedWords drops the chirps of others matching a word or phrase
+// userID muted
+func (cfg *APIConfig) hideMutedWords(ctx context.Context, userID uuid.UUID, chirps []database.Chirp) ([]database.Chirp, error) {
+	matchers, err := cfg.mutedWordMatchers(ctx, []uuid.UUID{userID})
+	if err != nil {
+		return nil, err
+	}
+	matcher := matchers[userID]
+	return slices.DeleteFunc(chirps, func(chirp database.Chirp) bool {
+		return chirp.UserID.UUID != userID && matcher.Match(chirp.Body)
+	}), nil
+}
+
+// normalizePhrase trims a phrase and collapses its whitespace, which is how
+// it's matched anyway
+func normalizePhrase(phrase string) string {
+	return strings.Join(strings.Fields(phrase), " ")
+}
+
+func (cfg *APIConfig) CreateMutedWord(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type requestBody struct {
+		Phrase    string     `json:"phrase"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	phrase := normalizePhrase(params.Phrase)
+	if phrase == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "phrase is required")
+		return
+	}
+	if utf8.RuneCountInString(phrase) > MaxMutedWordLength {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("phrase must be at most %d characters", MaxMutedWordLength))
+		return
+	}
+	var expiresAt sql.NullTime
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			utils.RespondWithError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	var mutedWord database.MutedWord
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		// concurrent mutes count one at a time
+		if err := q.LockUserForUpdate(r.Context(), accessToken.UserID); err != nil {
+			return err
+		}
+		// expired phrases would otherwise pile up, nothing else removes them
+		if err := q.DeleteExpiredMutedWordsByUser(r.Context(), accessToken.UserID); err != nil {
+			return err
+		}
+		mutedWord, err = q.CreateMutedWord(r.Context(), database.CreateMutedWordParams{
+			UserID:    accessToken.UserID,
+			Phrase:    phrase,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		// counted after muting, so a phrase muted again to change its
+		// expiry doesn't count twice
+		count, err := q.CountActiveMutedWordsByUser(r.Context(), accessToken.UserID)
+		if err != nil {
+			return err
+		}
+		if count > MaxMutedWordsPerUser {
+			return errTooManyMutedWords
+		}
+		return nil
+	})
+	if errors.Is(err, errTooManyMutedWords) {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	cfg.mutedWords.invalidate(accessToken.UserID)
+	utils.RespondWithJSON(w, http.StatusCreated, mutedWord)
+}
+
+func (cfg *APIConfig) GetMutedWords(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	mutedWords, err := cfg.DB.ListActiveMutedWordsByUser(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if mutedWords == nil {
+		mutedWords = []database.MutedWord{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, mutedWords)
+}
+
+func (cfg *APIConfig) DeleteMutedWord(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid muted word ID passed")
+		return
+	}
+	deleted, err := cfg.DB.DeleteMutedWord(r.Context(), database.DeleteMutedWordParams{
+		ID:     id,
+		UserID: accessToken.UserID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deleted == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "No muted word found")
+		return
+	}
+	cfg.mutedWords.invalidate(accessToken.UserID)
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+func TestMutedWordCache(t *testing.T) {
+	var cache mutedWordCache
+	now := time.Now()
+	userID := uuid.New()
+
+	if _, ok := cache.get(userID, now); ok {
+		t.Fatal("get() on an empty cache found a matcher")
+	}
+	matcher := utils.NewPhraseMatcher([]string{"spoiler"})
+	cache.put(userID, mutedWordEntry{matcher: matcher, expiresAt: now.Add(time.Minute)}, now)
+	if got, ok := cache.get(userID, now); !ok || got != matcher {
+		t.Errorf("get() = %v, %v, want the cached matcher", got, ok)
+	}
+	if _, ok := cache.get(userID, now.Add(time.Minute)); ok {
+		t.Error("get() after the entry expired found a matcher")
+	}
+	cache.invalidate(userID)
+	if _, ok := cache.get(userID, now); ok {
+		t.Error("get() after invalidate() found a matcher")
+	}
+
+	t.Run("bounded", func(t *testing.T) {
+		var cache mutedWordCache
+		for range maxCachedMatchers {
+			cache.put(uuid.New(), mutedWordEntry{expiresAt: now.Add(time.Minute)}, now)
+		}
+		cache.put(userID, mutedWordEntry{expiresAt: now.Add(time.Minute)}, now)
+		if len(cache.entries) > maxCachedMatchers {
+			t.Errorf("cache holds %d entries, want at most %d", len(cache.entries), maxCachedMatchers)
+		}
+		if _, ok := cache.get(userID, now); !ok {
+			t.Error("get() of the latest entry found nothing")
+		}
+	})
+}
+
+func TestAPIConfig_MutedWordFilters(t *testing.T) {
+	cfg := &APIConfig{}
+	now := time.Now()
+	viewer, author, other := uuid.New(), uuid.New(), uuid.New()
+	// cached, so nothing is read from the database
+	cfg.mutedWords.put(viewer, mutedWordEntry{matcher: utils.NewPhraseMatcher([]string{"spoiler"}), expiresAt: now.Add(time.Minute)}, now)
+	cfg.mutedWords.put(author, mutedWordEntry{matcher: utils.NewPhraseMatcher([]string{"spoiler"}), expiresAt: now.Add(time.Minute)}, now)
+	cfg.mutedWords.put(other, mutedWordEntry{matcher: utils.NewPhraseMatcher(nil), expiresAt: now.Add(time.Minute)}, now)
+
+	chirp := func(userID uuid.UUID, body string) database.Chirp {
+		return database.Chirp{ID: uuid.New(), UserID: uuid.NullUUID{UUID: userID, Valid: true}, Body: body}
+	}
+
+	t.Run("timeline", func(t *testing.T) {
+		chirps := []database.Chirp{
+			chirp(author, "Spoiler: they win"),
+			chirp(author, "no spoilers"),
+			chirp(viewer, "my own spoiler"),
+		}
+		want := []database.Chirp{chirps[1], chirps[2]}
+		got, err := cfg.hideMutedWords(t.Context(), viewer, chirps)
+		if err != nil {
+			t.Fatalf("hideMutedWords() unexpected error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("hideMutedWords() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("recipients", func(t *testing.T) {
+		got, err := cfg.withoutMutedWords(t.Context(), chirp(author, "a spoiler"), []uuid.UUID{viewer, other, author})
+		if err != nil {
+			t.Fatalf("withoutMutedWords() unexpected error = %v", err)
+		}
+		if want := []uuid.UUID{other, author}; !reflect.DeepEqual(got, want) {
+			t.Errorf("withoutMutedWords() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestAPIConfig_MutedWordEndpoints_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	thirdPartyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), auth.ValidScopes(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		token   string
+		id      string
+		body    string
+		want    int
+	}{
+		{name: "create with a third-party token", handler: cfg.CreateMutedWord, token: thirdPartyToken, body: `{"phrase": "spoiler"}`, want: http.StatusForbidden},
+		{name: "list with a third-party token", handler: cfg.GetMutedWords, token: thirdPartyToken, want: http.StatusForbidden},
+		{name: "delete with a third-party token", handler: cfg.DeleteMutedWord, token: thirdPartyToken, id: uuid.NewString(), want: http.StatusForbidden},
+		{name: "blank phrase", handler: cfg.CreateMutedWord, token: token, body: `{"phrase": "   "}`, want: http.StatusBadRequest},
+		{name: "phrase too long", handler: cfg.CreateMutedWord, token: token, body: `{"phrase": "` + strings.Repeat("a", MaxMutedWordLength+1) + `"}`, want: http.StatusBadRequest},
+		{name: "expiry in the past", handler: cfg.CreateMutedWord, token: token, body: `{"phrase": "spoiler", "expires_at": "2020-01-01T00:00:00Z"}`, want: http.StatusBadRequest},
+		{name: "invalid ID", handler: cfg.DeleteMutedWord, token: token, id: "not-a-uuid", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/users/me/muted-words", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_CreateMutedWord(t *testing.T) {
+	userID := uuid.New()
+	tests := []struct {
+		name string
+		body string
+		// countAfter is how many phrases the user has after muting
+		countAfter    int64
+		wantExpiresAt any
+		wantStatus    int
+	}{
+		{name: "no expiry", body: `{"phrase": "spoiler"}`, countAfter: 1, wantStatus: http.StatusCreated},
+		// stored in a timestamp column compared with NOW(), which is UTC
+		{name: "expiry with an offset", body: `{"phrase": "spoiler", "expires_at": "2099-01-01T05:30:00+05:30"}`, countAfter: 1, wantExpiresAt: time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC), wantStatus: http.StatusCreated},
+		// a phrase muted again replaces the row, the count stays at the cap
+		{name: "at the cap", body: `{"phrase": "spoiler"}`, countAfter: MaxMutedWordsPerUser, wantStatus: http.StatusCreated},
+		{name: "over the cap", body: `{"phrase": "spoiler"}`, countAfter: MaxMutedWordsPerUser + 1, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expiresAt driver.Value
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"LockUserForUpdate": func([]driver.Value) ([][]driver.Value, error) {
+					return nil, nil
+				},
+				"DeleteExpiredMutedWordsByUser": func([]driver.Value) ([][]driver.Value, error) {
+					return nil, nil
+				},
+				"CreateMutedWord": func(args []driver.Value) ([][]driver.Value, error) {
+					expiresAt = args[2]
+					return [][]driver.Value{{uuid.NewString(), time.Now(), args[0], args[1], args[2]}}, nil
+				},
+				"CountActiveMutedWordsByUser": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{{tt.countAfter}}, nil
+				},
+			})
+			token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+			if err != nil {
+				t.Fatalf("MakeJWT() unexpected error = %v", err)
+			}
+			req := httptest.NewRequest("POST", "/api/users/me/muted-words", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.CreateMutedWord(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if want, ok := tt.wantExpiresAt.(time.Time); ok {
+				if got, _ := expiresAt.(time.Time); !got.Equal(want) || got.Location() != time.UTC {
+					t.Errorf("expires_at = %v, want %v", expiresAt, want)
+				}
+			} else if expiresAt != tt.wantExpiresAt {
+				t.Errorf("expires_at = %v, want %v", expiresAt, tt.wantExpiresAt)
+			}
+			// over the cap the phrase is rolled back
+			want := "COMMIT"
+			if tt.wantStatus != http.StatusCreated {
+				want = "ROLLBACK"
+			}
+			if called := db.called(); called[len(called)-1] != want {
+				t.Errorf("queries = %v, want them to end with %s", called, want)
+			}
+			// the user is locked before anything is counted
+			if called := db.called(); !slices.Equal(called[:3], []string{"IsUserActive", "BEGIN", "LockUserForUpdate"}) {
+				t.Errorf("queries = %v, want LockUserForUpdate first in the transaction", called)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/utils"
+
+	"github.com/lib/pq"
+)
+
+// notification types
+const (
+	NotificationMention = "mention"
+	NotificationReply   = "reply"
+	NotificationLike    = "like"
+	NotificationFollow  = "follow"
+)
+
+const (
+	DefaultNotificationsLimit = 20
+	MaxNotificationsLimit     = 100
+	// MaxMentionsPerChirp caps how many users a single chirp can notify
+	MaxMentionsPerChirp = 10
+)
+
+// an @ that isn't part of a word or an email address starts a mention
+var mentionRegexp = regexp.MustCompile(`(?:^|[^\w@])@(\w+)`)
+
+// ParseMentions returns the lowercased handles @mentioned in body, in order
+// and without duplicates. Words that can't be handles are ignored.
+func ParseMentions(body string) []string {
+	var handles []string
+	seen := make(map[string]bool)
+	for _, match := range mentionRegexp.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(match[1])
+		if seen[handle] || !handleRegexp.MatchString(handle) {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+		if len(handles) == MaxMentionsPerChirp {
+			break
+		}
+	}
+	return handles
+}
+
+func (cfg *APIConfig) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.ListNotificationsParams{
+		UserID:     accessToken.UserID,
+		UnreadOnly: query.Get("unread") == "true",
+		Limit:      DefaultNotificationsLimit,
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxNotificationsLimit {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(MaxNotificationsLimit))
+			return
+		}
+		params.Limit = int32(limit)
+	}
+	if v := query.Get("before"); v != "" {
+		before, err := uuid.Parse(v)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid before ID passed")
+			return
+		}
+		params.Before = uuid.NullUUID{UUID: before, Valid: true}
+	}
+
+	matchers, err := cfg.mutedWordMatchers(r.Context(), []uuid.UUID{accessToken.UserID})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	matcher := matchers[accessToken.UserID]
+
+	// notifications with words muted since they arrived are left out, the
+	// pages after are read until this one is full
+	limit := params.Limit
+	notifications := []database.Notification{}
+	for {
+		rows, err := cfg.DB.ListNotifications(r.Context(), params)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		for _, row := range rows {
+			if mutedNotification(matcher, row.Type, row.ChirpBody) {
+				continue
+			}
+			notifications = append(notifications, database.Notification{
+				ID:        row.ID,
+				CreatedAt: row.CreatedAt,
+				UserID:    row.UserID,
+				ActorID:   row.ActorID,
+				Type:      row.Type,
+				ChirpID:   row.ChirpID,
+				EventID:   row.EventID,
+				ReadAt:    row.ReadAt,
+			})
+		}
+		if len(rows) < int(params.Limit) || len(notifications) == int(limit) {
+			break
+		}
+		params.Limit = limit - int32(len(notifications))
+		params.Before = uuid.NullUUID{UUID: rows[len(rows)-1].ID, Valid: true}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, notifications)
+}
+
+// mutedNotification reports whether a notification is a reply or mention
+// containing a word matcher matches. Likes are of the user's own chirps,
+// which muted words never hide.
+func mutedNotification(matcher *utils.PhraseMatcher, notificationType string, chirpBody sql.NullString) bool {
+	if notificationType != NotificationReply && notificationType != NotificationMention {
+		return false
+	}
+	return chirpBody.Valid && matcher.Match(chirpBody.String)
+}
+
+// countUnreadNotifications counts userID's unread notifications as
+// GetNotifications lists them, without those containing words muted since
+// they arrived
+func (cfg *APIConfig) countUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	matchers, err := cfg.mutedWordMatchers(ctx, []uuid.UUID{userID})
+	if err != nil {
+		return 0, err
+	}
+	matcher := matchers[userID]
+	if matcher.Empty() {
+		return cfg.DB.CountUnreadNotifications(ctx, userID)
+	}
+
+	rows, err := cfg.DB.ListUnreadNotificationChirps(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, row := range rows {
+		if !mutedNotification(matcher, row.Type, row.ChirpBody) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type unreadCountResponse struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
+func (cfg *APIConfig) GetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	count, err := cfg.countUnreadNotifications(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, unreadCountResponse{count})
+}
+
+// MarkNotificationsRead marks the listed notifications, or all of them, as
+// read and responds with what's left unread
+func (cfg *APIConfig) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type requestBody struct {
+		IDs []uuid.UUID `json:"ids"`
+		All bool        `json:"all"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	switch {
+	case params.All:
+		_, err = cfg.DB.MarkAllNotificationsRead(r.Context(), accessToken.UserID)
+	case len(params.IDs) == 0:
+		utils.RespondWithError(w, http.StatusBadRequest, "pass the ids to mark as read, or all")
+		return
+	case len(params.IDs) > MaxNotificationsLimit:
+		utils.RespondWithError(w, http.StatusBadRequest, "at most "+strconv.Itoa(MaxNotificationsLimit)+" ids allowed")
+		return
+	default:
+		_, err = cfg.DB.MarkNotificationsRead(r.Context(), database.MarkNotificationsReadParams{
+			UserID: accessToken.UserID,
+			Ids:    params.IDs,
+		})
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	count, err := cfg.countUnreadNotifications(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, unreadCountResponse{count})
+}
+
+// notifyChirpCreated notifies the author of the chirp replied to, if they
+// can see the reply, and the users mentioned. A user mentioned in their own
+// thread only gets the reply. Users who muted a word in the chirp get
+// neither.
+func (cfg *APIConfig) notifyChirpCreated(ctx context.Context, event events.Event) error {
+	var chirp database.Chirp
+	if err := event.Decode(&chirp); err != nil {
+		return err
+	}
+	if !chirp.UserID.Valid {
+		return nil
+	}
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
+	notified := map[uuid.UUID]bool{chirp.UserID.UUID: true}
+
+	var replyTo uuid.NullUUID
+	if chirp.ReplyToID.Valid {
+		// the author could see the parent when they replied
+		parent, err := cfg.DB.GetChirpByID(ctx, database.GetChirpByIDParams{
+			ID:       chirp.ReplyToID.UUID,
+			ViewerID: chirp.UserID,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		visible := false
+		if err == nil && parent.UserID.Valid && !notified[parent.UserID.UUID] {
+			visible, err = cfg.canView(ctx, parent.UserID.UUID, chirp)
+			if err != nil {
+				return err
+			}
+		}
+		if visible {
+			replyTo = parent.UserID
+		}
+	}
+
+	recipients := chirp.MentionedIds
+	if replyTo.Valid {
+		recipients = append([]uuid.UUID{replyTo.UUID}, recipients...)
+	}
+	recipients, err := cfg.withoutMutedWords(ctx, chirp, recipients)
+	if err != nil {
+		return err
+	}
+	if replyTo.Valid && slices.Contains(recipients, replyTo.UUID) {
+		if err := cfg.notify(ctx, event, replyTo.UUID, NotificationReply, chirpID); err != nil {
+			return err
+		}
+		notified[replyTo.UUID] = true
+	}
+
+	// resolved when the chirp was written, and able to see it whatever its
+	// visibility
+	for _, userID := range chirp.MentionedIds {
+		if notified[userID] || !slices.Contains(recipients, userID) {
+			continue
+		}
+		if err := cfg.notify(ctx, event, userID, NotificationMention, chirpID); err != nil {
+			return err
+		}
+		notified[userID] = true
+	}
+	return nil
+}
+
+// notifyChirpLiked notifies the author of the liked chirp
+func (cfg *APIConfig) notifyChirpLiked(ctx context.Context, event events.Event) error {
+	var like database.Like
+	if err := event.Decode(&like); err != nil {
+		return err
+	}
+	// the user could see the chirp when they liked it
+	chirp, err := cfg.DB.GetChirpByID(ctx, database.GetChirpByIDParams{
+		ID:       like.ChirpID,
+		ViewerID: uuid.NullUUID{UUID: like.UserID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// deleted since
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !chirp.UserID.Valid || chirp.UserID.UUID == like.UserID {
+		return nil
+	}
+	return cfg.notify(ctx, event, chirp.UserID.UUID, NotificationLike, uuid.NullUUID{UUID: chirp.ID, Valid: true})
+}
+
+// notifyUserFollowed notifies the followed user
+func (cfg *APIConfig) notifyUserFollowed(ctx context.Context, event events.Event) error {
+	var follow database.Follow
+	if err := event.Decode(&follow); err != nil {
+		return err
+	}
+	return cfg.notify(ctx, event, follow.FolloweeID, NotificationFollow, uuid.NullUUID{})
+}
+
+// notify creates a notification for userID about the actor of event and
+// streams it to them, notifying again for the same event is a no-op
+func (cfg *APIConfig) notify(ctx context.Context, event events.Event, userID uuid.UUID, notificationType string, chirpID uuid.NullUUID) error {
+	notification, err := cfg.DB.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  userID,
+		ActorID: event.UserID,
+		Type:    notificationType,
+		ChirpID: chirpID,
+		EventID: event.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// already notified
+		return nil
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgForeignKeyViolation {
+		// the user or chirp is gone, there's no one left to notify
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cfg.streamToUsers(ctx, StreamEventNotification, notification, userID)
+}
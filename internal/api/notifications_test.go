@@ -0,0 +1,247 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "none", body: "hello world", want: nil},
+		{name: "start of body", body: "@alice hi", want: []string{"alice"}},
+		{name: "punctuation", body: "hi (@bob), @carol!", want: []string{"bob", "carol"}},
+		{name: "lowercased and deduped", body: "@Alice @alice @ALICE", want: []string{"alice"}},
+		{name: "email is not a mention", body: "mail me at dave@example.com", want: nil},
+		{name: "double at", body: "@@eve", want: nil},
+		{name: "too short", body: "@ab", want: nil},
+		{name: "too long", body: "@" + strings.Repeat("a", 16), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMentions(tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMentions(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+
+	var body strings.Builder
+	for i := range MaxMentionsPerChirp + 5 {
+		fmt.Fprintf(&body, " @user%02d", i)
+	}
+	if got := ParseMentions(body.String()); len(got) != MaxMentionsPerChirp {
+		t.Errorf("ParseMentions() returned %d handles, want %d", len(got), MaxMentionsPerChirp)
+	}
+}
+
+func TestAPIConfig_Notifications_Validation(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		target        string
+		body          string
+		expectedError string
+	}{
+		{
+			name:          "limit too large",
+			handler:       cfg.GetNotifications,
+			target:        "/api/notifications?limit=1000",
+			expectedError: "limit must be between 1 and 100",
+		},
+		{
+			name:          "invalid cursor",
+			handler:       cfg.GetNotifications,
+			target:        "/api/notifications?before=nope",
+			expectedError: "Invalid before ID passed",
+		},
+		{
+			name:          "nothing to mark",
+			handler:       cfg.MarkNotificationsRead,
+			target:        "/api/notifications/read",
+			body:          `{}`,
+			expectedError: "pass the ids to mark as read, or all",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedError) {
+				t.Errorf("Expected error containing %q, got %s", tt.expectedError, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIConfig_NotificationEndpoints_RequireFirstParty(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	thirdPartyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), auth.ValidScopes(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"list":         cfg.GetNotifications,
+		"unread count": cfg.GetUnreadNotificationCount,
+		"mark read":    cfg.MarkNotificationsRead,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/notifications", strings.NewReader("{}"))
+			req.Header.Set("Authorization", "Bearer "+thirdPartyToken)
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_GetNotifications_MutedWords(t *testing.T) {
+	userID, actorID := uuid.New(), uuid.New()
+	notification := func(notificationType string, body driver.Value) []driver.Value {
+		chirpID := driver.Value(nil)
+		if body != nil {
+			chirpID = uuid.NewString()
+		}
+		return []driver.Value{uuid.NewString(), time.Now(), userID.String(), actorID.String(), notificationType, chirpID, uuid.NewString(), nil, body}
+	}
+	muted := notification(NotificationReply, "no spoilers, big SPOILER")
+	like := notification(NotificationLike, "my spoiler")
+	follow := notification(NotificationFollow, nil)
+	mention := notification(NotificationMention, "hi @you")
+
+	cfg, db := testAPIConfig(t, map[string]fakeQuery{
+		"ListActiveMutedWordsByUsers": func([]driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{userID.String(), "spoiler", nil}}, nil
+		},
+		"ListNotifications": func(args []driver.Value) ([][]driver.Value, error) {
+			switch args[2] {
+			case nil:
+				return [][]driver.Value{muted, like, follow}, nil
+			case follow[0]:
+				return [][]driver.Value{mention}, nil
+			}
+			t.Errorf("ListNotifications() before = %v, want the last notification read", args[2])
+			return nil, nil
+		},
+	})
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/notifications?limit=3", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.GetNotifications(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var got []database.Notification
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() unexpected error = %v", err)
+	}
+	var ids []string
+	for _, n := range got {
+		ids = append(ids, n.ID.String())
+	}
+	if want := []string{like[0].(string), follow[0].(string), mention[0].(string)}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("GetNotifications() = %v, want %v without the muted reply", ids, want)
+	}
+
+	var limits []driver.Value
+	for _, call := range db.calls {
+		if call.Name == "ListNotifications" {
+			limits = append(limits, call.Args[3])
+		}
+	}
+	if want := []driver.Value{int64(3), int64(1)}; !reflect.DeepEqual(limits, want) {
+		t.Errorf("ListNotifications() limits = %v, want %v", limits, want)
+	}
+}
+
+func TestAPIConfig_GetUnreadNotificationCount_MutedWords(t *testing.T) {
+	tests := []struct {
+		name   string
+		phrase []driver.Value
+		want   int64
+	}{
+		{name: "no muted words", want: 5},
+		{name: "muted word", phrase: []driver.Value{"spoiler"}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"ListActiveMutedWordsByUsers": func([]driver.Value) ([][]driver.Value, error) {
+					if tt.phrase == nil {
+						return nil, nil
+					}
+					return [][]driver.Value{{userID.String(), tt.phrase[0], nil}}, nil
+				},
+				"CountUnreadNotifications": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{{int64(5)}}, nil
+				},
+				"ListUnreadNotificationChirps": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{
+						{NotificationReply, "a spoiler"},
+						{NotificationMention, "SPOILER @you"},
+						{NotificationLike, "my spoiler"},
+						{NotificationFollow, nil},
+						{NotificationReply, "hi"},
+					}, nil
+				},
+			})
+			token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+			if err != nil {
+				t.Fatalf("MakeJWT() unexpected error = %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/api/notifications/unread-count", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.GetUnreadNotificationCount(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			var got unreadCountResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() unexpected error = %v", err)
+			}
+			if got.UnreadCount != tt.want {
+				t.Errorf("unread_count = %d, want %d; queries %v", got.UnreadCount, tt.want, db.called())
+			}
+		})
+	}
+}
@@ -0,0 +1,460 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/oidc"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+const (
+	// oauthConsentPath is the consent screen, served by the static file server
+	oauthConsentPath = "/app/consent.html"
+	// oauthAccessTokenTTL matches the lifetime of tokens made by auth.MakeJWT
+	oauthAccessTokenTTL = time.Hour
+
+	MaxOAuthClientNameLength = 100
+)
+
+// oauthError is an error response as defined by RFC 6749
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, oauthErr *oauthError) {
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, code, oauthErr)
+}
+
+func ValidateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("redirect URI must be an absolute URL")
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect URI must not contain a fragment")
+	}
+	// plain http is only fine when the redirect never leaves the machine
+	if u.Scheme != "https" && !(u.Scheme == "http" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1")) {
+		return fmt.Errorf("redirect URI must use https")
+	}
+	return nil
+}
+
+func (cfg *APIConfig) CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type requestBody struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+	type responseBody struct {
+		database.OauthClient
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || utf8.RuneCountInString(params.Name) > MaxOAuthClientNameLength {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("name must be 1-%d characters", MaxOAuthClientNameLength))
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "at least one redirect URI is required")
+		return
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		if err := ValidateRedirectURI(redirectURI); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	scopes, err := auth.ParseScopes(strings.Join(params.Scopes, " "))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(scopes) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "at least one scope is required")
+		return
+	}
+
+	// public clients, e.g. mobile apps, can't keep a secret and rely on
+	// PKCE alone
+	var clientSecret, secretHash string
+	if params.Confidential {
+		clientSecret, err = auth.MakeRefreshToken()
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		secretHash = auth.HashToken(clientSecret)
+	}
+
+	client, err := cfg.DB.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		UserID:       accessToken.UserID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       scopeStrings(scopes),
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, responseBody{client, clientSecret})
+}
+
+func (cfg *APIConfig) GetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	clients, err := cfg.DB.GetOAuthClientsByUserID(r.Context(), accessToken.UserID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if clients == nil {
+		clients = []database.OauthClient{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, clients)
+}
+
+func (cfg *APIConfig) DeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid client ID passed")
+		return
+	}
+
+	deleted, err := cfg.DB.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:     clientID,
+		UserID: accessToken.UserID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deleted == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "No client found")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// authorizeRequest holds the parameters of an authorization request, both
+// from the query string of GET /api/oauth/authorize and from the consent
+// decision
+type authorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+func authorizeRequestFromQuery(q url.Values) authorizeRequest {
+	return authorizeRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+}
+
+// lookupAuthorizeClient resolves the client and checks the redirect URI.
+// Until both are known good, errors must be shown to the user rather than
+// sent to the redirect URI.
+func (cfg *APIConfig) lookupAuthorizeClient(r *http.Request, req authorizeRequest) (database.OauthClient, *oauthError) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return database.OauthClient{}, &oauthError{"invalid_request", "invalid client_id"}
+	}
+	client, err := cfg.DB.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.OauthClient{}, &oauthError{"invalid_request", "unknown client_id"}
+		}
+		return database.OauthClient{}, &oauthError{"server_error", "Something went wrong"}
+	}
+	if !slices.Contains(client.RedirectUris, req.RedirectURI) {
+		return database.OauthClient{}, &oauthError{"invalid_request", "redirect_uri is not registered for this client"}
+	}
+	return client, nil
+}
+
+// checkAuthorizeRequest validates the rest of an authorization request for a
+// known client and returns the requested scopes
+func checkAuthorizeRequest(client database.OauthClient, req authorizeRequest) ([]auth.Scope, *oauthError) {
+	if req.ResponseType != "code" {
+		return nil, &oauthError{"unsupported_response_type", "only the code response type is supported"}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, &oauthError{"invalid_request", "PKCE with code_challenge_method S256 is required"}
+	}
+	scopes, err := auth.ParseScopes(req.Scope)
+	if err != nil {
+		return nil, &oauthError{"invalid_scope", err.Error()}
+	}
+	if len(scopes) == 0 {
+		return nil, &oauthError{"invalid_scope", "at least one scope is required"}
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, string(scope)) {
+			return nil, &oauthError{"invalid_scope", fmt.Sprintf("scope '%s' is not allowed for this client", scope)}
+		}
+	}
+	return scopes, nil
+}
+
+// authorizeRedirect builds the URL the user agent goes back to the client
+// with
+func authorizeRedirect(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	q := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			q.Add(key, value)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// OAuthAuthorize validates an authorization request from a third-party client
+// and sends the user to the consent screen
+func (cfg *APIConfig) OAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequestFromQuery(r.URL.Query())
+	client, oauthErr := cfg.lookupAuthorizeClient(r, req)
+	if oauthErr != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErr)
+		return
+	}
+	if _, oauthErr := checkAuthorizeRequest(client, req); oauthErr != nil {
+		http.Redirect(w, r, authorizeRedirect(req.RedirectURI, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+			"state":             {req.State},
+		}), http.StatusFound)
+		return
+	}
+
+	consent := r.URL.Query()
+	consent.Set("client_name", client.Name)
+	http.Redirect(w, r, oauthConsentPath+"?"+consent.Encode(), http.StatusFound)
+}
+
+// OAuthConsent records the signed in user's decision on the consent screen
+// and tells it where to send the user next
+func (cfg *APIConfig) OAuthConsent(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	type requestBody struct {
+		authorizeRequest
+		Approve bool `json:"approve"`
+	}
+	type responseBody struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	client, oauthErr := cfg.lookupAuthorizeClient(r, params.authorizeRequest)
+	if oauthErr != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErr)
+		return
+	}
+	scopes, oauthErr := checkAuthorizeRequest(client, params.authorizeRequest)
+	if oauthErr == nil && !params.Approve {
+		oauthErr = &oauthError{"access_denied", "the user denied the request"}
+	}
+	if oauthErr != nil {
+		utils.RespondWithJSON(w, http.StatusOK, responseBody{authorizeRedirect(params.RedirectURI, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+			"state":             {params.State},
+		})})
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	err = cfg.DB.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        accessToken.UserID,
+		RedirectUri:   params.RedirectURI,
+		Scopes:        scopeStrings(scopes),
+		CodeChallenge: params.CodeChallenge,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, responseBody{authorizeRedirect(params.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {params.State},
+	})})
+}
+
+// OAuthToken exchanges an authorization code for a scoped access token
+func (cfg *APIConfig) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	type responseBody struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope"`
+	}
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_request", "malformed form body"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"unsupported_grant_type", "only authorization_code is supported"})
+		return
+	}
+
+	// client authentication
+	clientIDString, clientSecret, basicAuth := r.BasicAuth()
+	if basicAuth {
+		clientIDString, _ = url.QueryUnescape(clientIDString)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientIDString, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	invalidClient := &oauthError{"invalid_client", "unknown client or bad credentials"}
+	clientID, err := uuid.Parse(clientIDString)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, invalidClient)
+		return
+	}
+	client, err := cfg.DB.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithOAuthError(w, http.StatusUnauthorized, invalidClient)
+			return
+		}
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "Something went wrong"})
+		return
+	}
+	if client.SecretHash != "" &&
+		subtle.ConstantTimeCompare([]byte(auth.HashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		respondWithOAuthError(w, http.StatusUnauthorized, invalidClient)
+		return
+	}
+
+	// the code is only used up when the client, redirect URI and verifier
+	// all match, so another client can't burn a code it was never issued,
+	// and checking and consuming in one statement means it can't be
+	// exchanged twice
+	code, err := cfg.DB.ConsumeOAuthAuthorizationCode(r.Context(), database.ConsumeOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(r.PostForm.Get("code")),
+		ClientID:      client.ID,
+		RedirectUri:   r.PostForm.Get("redirect_uri"),
+		CodeChallenge: oidc.CodeChallengeS256(r.PostForm.Get("code_verifier")),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_grant", "invalid, expired or already used code"})
+			return
+		}
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "Something went wrong"})
+		return
+	}
+
+	scopes, err := auth.ParseScopes(strings.Join(code.Scopes, " "))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "Something went wrong"})
+		return
+	}
+	accessToken, err := auth.MakeScopedJWT(code.UserID, client.ID.String(), scopes, cfg.JWTTokenSecret)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "Something went wrong"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, http.StatusOK, responseBody{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oauthAccessTokenTTL.Seconds()),
+		Scope:       auth.FormatScopes(scopes),
+	})
+}
+
+func scopeStrings(scopes []auth.Scope) []string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return s
+}
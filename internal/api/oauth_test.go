@@ -0,0 +1,241 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/oidc"
+)
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		name        string
+		redirectURI string
+		wantErr     bool
+	}{
+		{name: "https", redirectURI: "https://client.example.com/callback", wantErr: false},
+		{name: "http on localhost", redirectURI: "http://localhost:3000/callback", wantErr: false},
+		{name: "http on loopback", redirectURI: "http://127.0.0.1/callback", wantErr: false},
+		{name: "plain http", redirectURI: "http://client.example.com/callback", wantErr: true},
+		{name: "relative", redirectURI: "/callback", wantErr: true},
+		{name: "fragment", redirectURI: "https://client.example.com/callback#frag", wantErr: true},
+		{name: "custom scheme", redirectURI: "javascript:alert(1)", wantErr: true},
+		{name: "empty", redirectURI: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRedirectURI(tt.redirectURI)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRedirectURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckAuthorizeRequest(t *testing.T) {
+	client := database.OauthClient{
+		Name:         "Test Client",
+		RedirectUris: []string{"https://client.example.com/callback"},
+		Scopes:       []string{"chirps:read", "profile:read"},
+	}
+	valid := authorizeRequest{
+		ResponseType:        "code",
+		RedirectURI:         "https://client.example.com/callback",
+		Scope:               "chirps:read profile:read",
+		State:               "xyz",
+		CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeMethod: "S256",
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*authorizeRequest)
+		wantCode string
+	}{
+		{name: "valid request", modify: func(*authorizeRequest) {}},
+		{name: "token response type", modify: func(r *authorizeRequest) { r.ResponseType = "token" }, wantCode: "unsupported_response_type"},
+		{name: "missing PKCE", modify: func(r *authorizeRequest) { r.CodeChallenge = "" }, wantCode: "invalid_request"},
+		{name: "plain PKCE", modify: func(r *authorizeRequest) { r.CodeChallengeMethod = "plain" }, wantCode: "invalid_request"},
+		{name: "unknown scope", modify: func(r *authorizeRequest) { r.Scope = "chirps:read admin" }, wantCode: "invalid_scope"},
+		{name: "scope not allowed for client", modify: func(r *authorizeRequest) { r.Scope = "chirps:write" }, wantCode: "invalid_scope"},
+		{name: "no scope", modify: func(r *authorizeRequest) { r.Scope = "" }, wantCode: "invalid_scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+			scopes, oauthErr := checkAuthorizeRequest(client, req)
+			if tt.wantCode == "" {
+				if oauthErr != nil {
+					t.Fatalf("checkAuthorizeRequest() unexpected error = %v", oauthErr)
+				}
+				if len(scopes) != 2 {
+					t.Errorf("checkAuthorizeRequest() scopes = %v, want 2 scopes", scopes)
+				}
+				return
+			}
+			if oauthErr == nil || oauthErr.Code != tt.wantCode {
+				t.Errorf("checkAuthorizeRequest() error = %v, want %s", oauthErr, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRedirect(t *testing.T) {
+	got := authorizeRedirect("https://client.example.com/callback?existing=1", url.Values{
+		"code":  {"abc"},
+		"state": {"x y"},
+	})
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatalf("authorizeRedirect() returned an invalid URL %q", got)
+	}
+	q := u.Query()
+	if u.Host != "client.example.com" || q.Get("existing") != "1" || q.Get("code") != "abc" || q.Get("state") != "x y" {
+		t.Errorf("authorizeRedirect() = %s, want the callback with existing, code and state", got)
+	}
+}
+
+func TestAPIConfig_OAuthToken_RequestErrors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+
+	tests := []struct {
+		name           string
+		form           url.Values
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "unsupported grant type",
+			form:           url.Values{"grant_type": {"password"}, "username": {"a"}, "password": {"b"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "unsupported_grant_type",
+		},
+		{
+			name:           "missing client",
+			form:           url.Values{"grant_type": {"authorization_code"}, "code": {"abc"}},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid_client",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/oauth/token", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			cfg.OAuthToken(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			var body oauthError
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding error response: %v", err)
+			}
+			if body.Code != tt.expectedError {
+				t.Errorf("Expected error %q, got %q", tt.expectedError, body.Code)
+			}
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Error("token endpoint responses must not be cached")
+			}
+		})
+	}
+}
+
+func TestAPIConfig_OAuthToken_CodeMatching(t *testing.T) {
+	clientID, userID := uuid.New(), uuid.New()
+	const (
+		code        = "the-code"
+		redirectURI = "https://app.example.com/callback"
+		verifier    = "the-verifier"
+	)
+
+	tests := []struct {
+		name           string
+		clientID       uuid.UUID
+		redirectURI    string
+		verifier       string
+		expectedStatus int
+	}{
+		{name: "matching exchange", clientID: clientID, redirectURI: redirectURI, verifier: verifier, expectedStatus: http.StatusOK},
+		{name: "another client", clientID: uuid.New(), redirectURI: redirectURI, verifier: verifier, expectedStatus: http.StatusBadRequest},
+		{name: "another redirect URI", clientID: clientID, redirectURI: "https://evil.example.com/callback", verifier: verifier, expectedStatus: http.StatusBadRequest},
+		{name: "wrong verifier", clientID: clientID, redirectURI: redirectURI, verifier: "guess", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := false
+			cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+				"GetOAuthClient": func(args []driver.Value) ([][]driver.Value, error) {
+					now := time.Now()
+					return [][]driver.Value{{args[0], now, now, uuid.NewString(), "App", "", "{" + redirectURI + "}", "{chirps:read}"}}, nil
+				},
+				"ConsumeOAuthAuthorizationCode": func(args []driver.Value) ([][]driver.Value, error) {
+					if used || args[0] != auth.HashToken(code) || args[1] != clientID.String() ||
+						args[2] != redirectURI || args[3] != oidc.CodeChallengeS256(verifier) {
+						return nil, nil
+					}
+					used = true
+					now := time.Now()
+					return [][]driver.Value{{args[0], now, now.Add(time.Minute), clientID.String(), userID.String(), redirectURI, "{chirps:read}", args[3], now}}, nil
+				},
+			})
+
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {tt.clientID.String()},
+				"redirect_uri":  {tt.redirectURI},
+				"code_verifier": {tt.verifier},
+			}
+			req := httptest.NewRequest("POST", "/api/oauth/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			cfg.OAuthToken(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+			// a failed exchange must leave the code for the client it was issued to
+			if used != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("code used = %v after a %d response", used, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_OAuthClientEndpoints_RequireFirstParty(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	thirdPartyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), auth.ValidScopes(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"create":  cfg.CreateOAuthClient,
+		"list":    cfg.GetOAuthClients,
+		"delete":  cfg.DeleteOAuthClient,
+		"consent": cfg.OAuthConsent,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+			req.Header.Set("Authorization", "Bearer "+thirdPartyToken)
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/oidc"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+const (
+	oidcFlowCookieName = "chirpstack_oidc"
+	oidcFlowTTL        = 10 * time.Minute
+)
+
+var errOIDCUnverifiedEmail = errors.New("identity provider did not return a verified email")
+
+// oidcFlowState is what we need to remember between redirecting the user to
+// the provider and the provider redirecting them back, it lives in a signed
+// cookie so any instance can finish the flow
+type oidcFlowState struct {
+	Provider  string    `json:"provider"`
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (cfg *APIConfig) signOIDCFlowState(flow oidcFlowState) (string, error) {
+	data, err := json.Marshal(flow)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + cfg.oidcFlowSignature(payload), nil
+}
+
+func (cfg *APIConfig) verifyOIDCFlowState(value string) (oidcFlowState, error) {
+	payload, signature, found := strings.Cut(value, ".")
+	if !found {
+		return oidcFlowState{}, fmt.Errorf("malformed login state")
+	}
+	if !hmac.Equal([]byte(signature), []byte(cfg.oidcFlowSignature(payload))) {
+		return oidcFlowState{}, fmt.Errorf("login state signature mismatch")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return oidcFlowState{}, fmt.Errorf("malformed login state: %w", err)
+	}
+	var flow oidcFlowState
+	if err := json.Unmarshal(data, &flow); err != nil {
+		return oidcFlowState{}, fmt.Errorf("malformed login state: %w", err)
+	}
+	if time.Now().After(flow.ExpiresAt) {
+		return oidcFlowState{}, fmt.Errorf("login state expired")
+	}
+	return flow, nil
+}
+
+func (cfg *APIConfig) oidcFlowSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte("oidc-flow:"+cfg.JWTTokenSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// OIDCLogin starts signing in with an external provider by redirecting to it
+func (cfg *APIConfig) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.OIDCProviders[r.PathValue("provider")]
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	var flow oidcFlowState
+	for _, dest := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		value, err := oidc.RandomString()
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		*dest = value
+	}
+	flow.Provider = provider.Name
+	flow.ExpiresAt = time.Now().Add(oidcFlowTTL)
+
+	cookieValue, err := cfg.signOIDCFlowState(flow)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    cookieValue,
+		Path:     "/api/auth/",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.Platform == PlatformProd,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(flow.State, flow.Nonce, flow.Verifier), http.StatusFound)
+}
+
+// OIDCCallback finishes signing in with an external provider and responds
+// like LoginUser
+func (cfg *APIConfig) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.OIDCProviders[r.PathValue("provider")]
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, "identity provider denied sign in")
+		return
+	}
+
+	cookie, err := r.Cookie(oidcFlowCookieName)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "invalid login state")
+		return
+	}
+	// the state is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Path:     "/api/auth/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	flow, err := cfg.verifyOIDCFlowState(cookie.Value)
+	if err != nil ||
+		flow.Provider != provider.Name ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(query.Get("state"))) != 1 {
+		utils.RespondWithError(w, http.StatusUnauthorized, "invalid login state")
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Printf("oidc callback for %s: %v", provider.Name, err)
+		utils.RespondWithError(w, http.StatusUnauthorized, "identity provider sign in failed")
+		return
+	}
+
+	user, err := cfg.resolveOIDCUser(r.Context(), provider.Name, claims)
+	if err != nil {
+		if errors.Is(err, errOIDCUnverifiedEmail) {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	cfg.respondWithSession(w, r, user)
+}
+
+// resolveOIDCUser finds the user an external identity belongs to. Unknown
+// identities are linked to the account with the same email, or get a new
+// account, but only when the provider vouches for the email.
+func (cfg *APIConfig) resolveOIDCUser(ctx context.Context, providerName string, claims *oidc.Claims) (database.User, error) {
+	user, err := cfg.DB.GetUserByIdentity(ctx, database.GetUserByIdentityParams{
+		Provider: providerName,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if !claims.EmailVerified {
+		return database.User{}, errOIDCUnverifiedEmail
+	}
+	if _, err := mail.ParseAddress(claims.Email); err != nil {
+		return database.User{}, errOIDCUnverifiedEmail
+	}
+
+	user, err = cfg.DB.GetUserByEmail(ctx, claims.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = cfg.createOIDCUser(ctx, claims)
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	_, err = cfg.DB.CreateIdentity(ctx, database.CreateIdentityParams{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
+
+func (cfg *APIConfig) createOIDCUser(ctx context.Context, claims *oidc.Claims) (database.User, error) {
+	// accounts created through a provider have no password until the user
+	// sets one
+	user, err := cfg.DB.CreateUser(ctx, database.CreateUserParams{
+		Email:          claims.Email,
+		HashedPassword: noPassword,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	displayName := strings.TrimSpace(claims.Name)
+	if displayName == "" || ValidateDisplayName(displayName) != nil {
+		return user, nil
+	}
+	return cfg.DB.UpdateUser(ctx, database.UpdateUserParams{
+		ID:          user.ID,
+		DisplayName: sql.NullString{String: displayName, Valid: true},
+	})
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/oidc"
+	"github.com/maniac-en/chirpstack/internal/oidc/oidctest"
+)
+
+func TestAPIConfig_OIDCFlowState(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	flow := oidcFlowState{
+		Provider:  "mock",
+		State:     "state",
+		Nonce:     "nonce",
+		Verifier:  "verifier",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	signed, err := cfg.signOIDCFlowState(flow)
+	if err != nil {
+		t.Fatalf("signOIDCFlowState() unexpected error = %v", err)
+	}
+	got, err := cfg.verifyOIDCFlowState(signed)
+	if err != nil {
+		t.Fatalf("verifyOIDCFlowState() unexpected error = %v", err)
+	}
+	if got.Provider != flow.Provider || got.State != flow.State || got.Nonce != flow.Nonce || got.Verifier != flow.Verifier {
+		t.Errorf("verifyOIDCFlowState() = %+v, want %+v", got, flow)
+	}
+
+	payload, _, _ := strings.Cut(signed, ".")
+	otherCfg := &APIConfig{JWTTokenSecret: "other-secret"}
+	expired := flow
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	expiredSigned, _ := cfg.signOIDCFlowState(expired)
+
+	tests := []struct {
+		name  string
+		cfg   *APIConfig
+		value string
+	}{
+		{name: "tampered payload", cfg: cfg, value: "e30." + strings.SplitN(signed, ".", 2)[1]},
+		{name: "missing signature", cfg: cfg, value: payload},
+		{name: "signed with another secret", cfg: otherCfg, value: signed},
+		{name: "expired", cfg: cfg, value: expiredSigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.cfg.verifyOIDCFlowState(tt.value); err == nil {
+				t.Error("verifyOIDCFlowState() expected error but got none")
+			}
+		})
+	}
+}
+
+func newMockOIDCConfig(t *testing.T) (*APIConfig, *oidctest.Server) {
+	t.Helper()
+	srv := oidctest.NewServer("chirpstack", "s3cret")
+	t.Cleanup(srv.Close)
+	provider, err := oidc.Discover(context.Background(), "mock", oidc.Config{
+		Issuer:       srv.Issuer(),
+		ClientID:     srv.ClientID,
+		ClientSecret: srv.ClientSecret,
+		RedirectURL:  "http://localhost:8080/api/auth/mock/callback",
+	}, srv.Client())
+	if err != nil {
+		t.Fatalf("Discover() unexpected error = %v", err)
+	}
+	return &APIConfig{
+		JWTTokenSecret: "test-secret",
+		OIDCProviders:  map[string]*oidc.Provider{"mock": provider},
+	}, srv
+}
+
+func TestAPIConfig_OIDCLogin(t *testing.T) {
+	cfg, srv := newMockOIDCConfig(t)
+
+	req := httptest.NewRequest("GET", "/api/auth/mock/login", nil)
+	req.SetPathValue("provider", "mock")
+	w := httptest.NewRecorder()
+	cfg.OIDCLogin(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusFound, w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid Location header: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), srv.URL+"/authorize") {
+		t.Errorf("redirected to %s, want the provider's authorization endpoint", location)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("expected an HttpOnly %s cookie, got %v", oidcFlowCookieName, cookies)
+	}
+	flow, err := cfg.verifyOIDCFlowState(cookies[0].Value)
+	if err != nil {
+		t.Fatalf("login cookie does not verify: %v", err)
+	}
+	q := location.Query()
+	if q.Get("state") != flow.State || q.Get("nonce") != flow.Nonce || q.Get("code_challenge") != oidc.CodeChallengeS256(flow.Verifier) {
+		t.Errorf("authorization request %v does not match the stored flow state", q)
+	}
+}
+
+func TestAPIConfig_OIDCLogin_UnknownProvider(t *testing.T) {
+	cfg, _ := newMockOIDCConfig(t)
+
+	req := httptest.NewRequest("GET", "/api/auth/nope/login", nil)
+	req.SetPathValue("provider", "nope")
+	w := httptest.NewRecorder()
+	cfg.OIDCLogin(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestAPIConfig_OIDCCallback_StateMismatch(t *testing.T) {
+	cfg, _ := newMockOIDCConfig(t)
+
+	login := httptest.NewRecorder()
+	loginReq := httptest.NewRequest("GET", "/api/auth/mock/login", nil)
+	loginReq.SetPathValue("provider", "mock")
+	cfg.OIDCLogin(login, loginReq)
+	cookie := login.Result().Cookies()[0]
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie *http.Cookie
+	}{
+		{name: "missing cookie", query: "code=abc&state=whatever"},
+		{name: "state mismatch", query: "code=abc&state=forged", cookie: cookie},
+		{name: "provider error", query: "error=access_denied", cookie: cookie},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/auth/mock/callback?"+tt.query, nil)
+			req.SetPathValue("provider", "mock")
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+			cfg.OIDCCallback(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_ResolveOIDCUser(t *testing.T) {
+	existing := uuid.New()
+	now := time.Now()
+	userRow := []driver.Value{existing.String(), now, now, "me@example.com", "hash", "", "", "", "", nil}
+	identityRow := []driver.Value{uuid.NewString(), now, now, existing.String(), "mock", "subject", "me@example.com"}
+	noRows := func([]driver.Value) ([][]driver.Value, error) { return nil, nil }
+
+	tests := []struct {
+		name        string
+		claims      oidc.Claims
+		wantErr     error
+		wantQueries []string
+	}{
+		{
+			name:        "verified email links the existing account",
+			claims:      oidc.Claims{Email: "me@example.com", EmailVerified: true},
+			wantQueries: []string{"GetUserByIdentity", "GetUserByEmail", "CreateIdentity"},
+		},
+		{
+			name:        "unverified email is never looked up",
+			claims:      oidc.Claims{Email: "me@example.com", EmailVerified: false},
+			wantErr:     errOIDCUnverifiedEmail,
+			wantQueries: []string{"GetUserByIdentity"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := testAPIConfig(t, map[string]fakeQuery{
+				"GetUserByIdentity": noRows,
+				"GetUserByEmail": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{userRow}, nil
+				},
+				"CreateIdentity": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{identityRow}, nil
+				},
+			})
+			tt.claims.Subject = "subject"
+			user, err := cfg.resolveOIDCUser(t.Context(), "mock", &tt.claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveOIDCUser() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && user.ID != existing {
+				t.Errorf("resolveOIDCUser() = user %s, want %s", user.ID, existing)
+			}
+			if got := db.called(); !reflect.DeepEqual(got, tt.wantQueries) {
+				t.Errorf("queries = %v, want %v", got, tt.wantQueries)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_CreateOIDCUser_WithoutPassword(t *testing.T) {
+	userID := uuid.New()
+	var hashedPassword driver.Value
+	cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+		"CreateUser": func(args []driver.Value) ([][]driver.Value, error) {
+			hashedPassword = args[1]
+			return [][]driver.Value{{userID.String(), time.Now(), time.Now(), args[0], args[1], "", "", "", "", nil}}, nil
+		},
+		"GetUserByEmail": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{userID.String(), time.Now(), time.Now(), args[0], noPassword, "", "", "", "", nil}}, nil
+		},
+	})
+
+	if _, err := cfg.createOIDCUser(t.Context(), &oidc.Claims{Email: "me@example.com"}); err != nil {
+		t.Fatalf("createOIDCUser() unexpected error = %v", err)
+	}
+	if hashedPassword != noPassword {
+		t.Errorf("createOIDCUser() hashed password = %v, want %q", hashedPassword, noPassword)
+	}
+
+	// no password signs in to it, not even the placeholder
+	for _, password := range []string{"", noPassword} {
+		body := `{"email":"me@example.com","password":"` + password + `"}`
+		req := httptest.NewRequest("POST", "/api/login", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		cfg.LoginUser(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("password %q: expected status %d, got %d", password, http.StatusUnauthorized, w.Code)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/preview"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+// linkPreviewResponse is what a chirp's first link points to, as the page
+// describes itself
+type linkPreviewResponse struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+	SiteName    string `json:"site_name"`
+}
+
+func newLinkPreviewResponse(row database.LinkPreview) *linkPreviewResponse {
+	return &linkPreviewResponse{
+		URL:         row.URL,
+		Title:       row.Title,
+		Description: row.Description,
+		ImageURL:    row.ImageUrl,
+		SiteName:    row.SiteName,
+	}
+}
+
+// previewURL returns the URL of a chirp that gets a preview, its first one
+func previewURL(body string) (string, bool) {
+	urls := utils.ExtractURLs(body)
+	if len(urls) == 0 {
+		return "", false
+	}
+	return urls[0], true
+}
+
+// queueLinkPreview has the preview of a new or edited chirp's link fetched,
+// unless a recent one is cached. Chirps show it once it's fetched.
+func (cfg *APIConfig) queueLinkPreview(ctx context.Context, event events.Event) error {
+	if cfg.LinkPreviews == nil {
+		return nil
+	}
+	var chirp database.Chirp
+	if err := event.Decode(&chirp); err != nil {
+		return err
+	}
+	url, ok := previewURL(chirp.Body)
+	if !ok {
+		return nil
+	}
+
+	cached, err := cfg.DB.GetLinkPreview(ctx, url)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil {
+		maxAge := preview.RefreshAfter
+		if !cached.Succeeded {
+			maxAge = preview.RetryAfter
+		}
+		if time.Since(cached.FetchedAt) < maxAge {
+			return nil
+		}
+	}
+	cfg.LinkPreviews.Enqueue(url)
+	return nil
+}
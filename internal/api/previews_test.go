@@ -0,0 +1,20 @@
+package api
+
+import "testing"
+
+func TestPreviewURL(t *testing.T) {
+	tests := []struct {
+		body   string
+		want   string
+		wantOK bool
+	}{
+		{body: "no links", want: "", wantOK: false},
+		{body: "read https://example.com/a, then https://example.com/b", want: "https://example.com/a", wantOK: true},
+	}
+	for _, tt := range tests {
+		got, ok := previewURL(tt.body)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("previewURL(%q) = %q, %v, want %q, %v", tt.body, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+const (
+	ErrCurrentPasswordRequired  string = "current password required"
+	ErrIncorrectCurrentPassword string = "incorrect current password"
+)
+
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 160
+	MaxAvatarURLLength   = 2048
+)
+
+// handles are what people @mention, so keep them short and URL-safe
+var handleRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+
+func ValidateDisplayName(displayName string) error {
+	if utf8.RuneCountInString(displayName) > MaxDisplayNameLength {
+		return fmt.Errorf("display name must be at most %d characters", MaxDisplayNameLength)
+	}
+	return nil
+}
+
+// ValidateHandle accepts an empty handle, which clears it
+func ValidateHandle(handle string) error {
+	if handle == "" {
+		return nil
+	}
+	if !handleRegexp.MatchString(handle) {
+		return fmt.Errorf("handle must be 3-15 letters, digits or underscores")
+	}
+	return nil
+}
+
+func ValidateBio(bio string) error {
+	if utf8.RuneCountInString(bio) > MaxBioLength {
+		return fmt.Errorf("bio must be at most %d characters", MaxBioLength)
+	}
+	return nil
+}
+
+// ValidateAvatarURL accepts an empty URL, which clears it
+func ValidateAvatarURL(avatarURL string) error {
+	if avatarURL == "" {
+		return nil
+	}
+	if len(avatarURL) > MaxAvatarURLLength {
+		return fmt.Errorf("avatar URL must be at most %d characters", MaxAvatarURLLength)
+	}
+	u, err := url.Parse(avatarURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("avatar URL must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// PublicProfile is the projection of a user that is safe to show to anyone,
+// it must never carry the email or any credential
+type PublicProfile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	DisplayName    string    `json:"display_name"`
+	Handle         string    `json:"handle"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	ChirpCount     int64     `json:"chirp_count"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+}
+
+func NewPublicProfile(user database.User, stats database.GetUserStatsRow) PublicProfile {
+	return PublicProfile{
+		ID:             user.ID,
+		CreatedAt:      user.CreatedAt,
+		DisplayName:    user.DisplayName,
+		Handle:         user.Handle,
+		Bio:            user.Bio,
+		AvatarURL:      user.AvatarURL,
+		IsChirpyRed:    stats.IsChirpyRed,
+		ChirpCount:     stats.ChirpCount,
+		FollowerCount:  stats.FollowerCount,
+		FollowingCount: stats.FollowingCount,
+	}
+}
+
+func (cfg *APIConfig) GetUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	if userID == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "No user ID passed")
+		return
+	}
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID passed")
+		return
+	}
+
+	user, err := cfg.DB.GetUserByID(r.Context(), userUUID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No user found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	cfg.respondWithPublicProfile(w, r, user)
+}
+
+func (cfg *APIConfig) GetUserProfileByHandle(w http.ResponseWriter, r *http.Request) {
+	handle := r.PathValue("handle")
+	if handle == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "No handle passed")
+		return
+	}
+
+	user, err := cfg.DB.GetUserByHandle(r.Context(), handle)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No user found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	cfg.respondWithPublicProfile(w, r, user)
+}
+
+func (cfg *APIConfig) respondWithPublicProfile(w http.ResponseWriter, r *http.Request, user database.User) {
+	stats, err := cfg.DB.GetUserStats(r.Context(), user.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, NewPublicProfile(user, stats))
+}
+
+func (cfg *APIConfig) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeProfileRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	userID := accessToken.UserID
+
+	type responseBody struct {
+		database.User
+		database.GetUserStatsRow
+		HasPassword  bool                 `json:"has_password"`
+		Entitlements entitlementsResponse `json:"entitlements"`
+	}
+
+	user, err := cfg.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	stats, err := cfg.DB.GetUserStats(r.Context(), user.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	entitlements, err := cfg.entitlements(r.Context(), user.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, responseBody{user, stats, hasPassword(user), newEntitlementsResponse(entitlements)})
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+func TestValidateHandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		handle  string
+		wantErr bool
+	}{
+		{name: "empty handle clears", handle: "", wantErr: false},
+		{name: "simple handle", handle: "chirper", wantErr: false},
+		{name: "digits and underscores", handle: "chirp_42", wantErr: false},
+		{name: "too short", handle: "ab", wantErr: true},
+		{name: "too long", handle: strings.Repeat("a", 16), wantErr: true},
+		{name: "contains space", handle: "chirp er", wantErr: true},
+		{name: "contains at sign", handle: "@chirper", wantErr: true},
+		{name: "non ascii", handle: "chïrper", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateHandle(tt.handle); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHandle(%q) error = %v, wantErr %v", tt.handle, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDisplayNameAndBio(t *testing.T) {
+	if err := ValidateDisplayName(strings.Repeat("é", MaxDisplayNameLength)); err != nil {
+		t.Errorf("ValidateDisplayName() at limit unexpected error = %v", err)
+	}
+	if err := ValidateDisplayName(strings.Repeat("a", MaxDisplayNameLength+1)); err == nil {
+		t.Error("ValidateDisplayName() over limit expected error but got none")
+	}
+	if err := ValidateBio(strings.Repeat("é", MaxBioLength)); err != nil {
+		t.Errorf("ValidateBio() at limit unexpected error = %v", err)
+	}
+	if err := ValidateBio(strings.Repeat("a", MaxBioLength+1)); err == nil {
+		t.Error("ValidateBio() over limit expected error but got none")
+	}
+}
+
+func TestValidateAvatarURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		avatarURL string
+		wantErr   bool
+	}{
+		{name: "empty url clears", avatarURL: "", wantErr: false},
+		{name: "https url", avatarURL: "https://example.com/me.png", wantErr: false},
+		{name: "http url", avatarURL: "http://example.com/me.png", wantErr: false},
+		{name: "relative url", avatarURL: "/me.png", wantErr: true},
+		{name: "javascript url", avatarURL: "javascript:alert(1)", wantErr: true},
+		{name: "missing host", avatarURL: "https://", wantErr: true},
+		{name: "too long", avatarURL: "https://example.com/" + strings.Repeat("a", MaxAvatarURLLength), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAvatarURL(tt.avatarURL); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAvatarURL(%q) error = %v, wantErr %v", tt.avatarURL, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_UpdateUser_CredentialsRequireCurrentPassword(t *testing.T) {
+	cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+		"GetUserByID": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{{args[0], time.Now(), time.Now(), "me@example.com", "hash", "", "", "", "", nil}}, nil
+		},
+	})
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	for _, body := range []string{
+		`{"email":"new@example.com"}`,
+		`{"password":"newpassword123"}`,
+	} {
+		req := httptest.NewRequest("PATCH", "/api/users", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+
+		cfg.UpdateUser(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("body %s: expected status %d, got %d", body, http.StatusUnauthorized, w.Code)
+		}
+		expected := `{"error":"` + ErrCurrentPasswordRequired + `"}`
+		if strings.TrimSpace(w.Body.String()) != expected {
+			t.Errorf("body %s: expected %q, got %q", body, expected, strings.TrimSpace(w.Body.String()))
+		}
+	}
+}
+
+func TestAPIConfig_UpdateUser_WithoutPassword(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		wantEmail       driver.Value
+		wantHasPassword bool
+	}{
+		{
+			name:            "set a password",
+			body:            `{"password":"newpassword123"}`,
+			wantHasPassword: true,
+		},
+		{
+			name:      "change email",
+			body:      `{"email":"new@example.com"}`,
+			wantEmail: "new@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var email, hashedPassword driver.Value
+			cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+				"GetUserByID": func(args []driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{{args[0], time.Now(), time.Now(), "me@example.com", noPassword, "", "", "", "", nil}}, nil
+				},
+				"UpdateUser": func(args []driver.Value) ([][]driver.Value, error) {
+					email, hashedPassword = args[0], args[1]
+					stored := driver.Value(noPassword)
+					if hashedPassword != nil {
+						stored = hashedPassword
+					}
+					return [][]driver.Value{{args[6], time.Now(), time.Now(), "me@example.com", stored, "", "", "", "", nil}}, nil
+				},
+				"HasActiveSubscription": func([]driver.Value) ([][]driver.Value, error) {
+					return [][]driver.Value{{false}}, nil
+				},
+				"CreateDomainEvent": func(args []driver.Value) ([][]driver.Value, error) {
+					now := time.Now()
+					return [][]driver.Value{{uuid.NewString(), now, args[0], args[1], args[2], "pending", int64(0), now, "", nil, "{}"}}, nil
+				},
+			})
+			token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+			if err != nil {
+				t.Fatalf("MakeJWT() unexpected error = %v", err)
+			}
+
+			// signed up through a provider, there's no current password
+			req := httptest.NewRequest("PUT", "/api/users", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.UpdateUser(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if email != tt.wantEmail {
+				t.Errorf("UpdateUser() email = %v, want %v", email, tt.wantEmail)
+			}
+			if (hashedPassword != nil) != tt.wantHasPassword {
+				t.Errorf("UpdateUser() hashed password = %v, want one set %v", hashedPassword, tt.wantHasPassword)
+			}
+			var got userResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() unexpected error = %v", err)
+			}
+			if got.HasPassword != tt.wantHasPassword {
+				t.Errorf("has_password = %v, want %v", got.HasPassword, tt.wantHasPassword)
+			}
+		})
+	}
+}
+
+func TestNewPublicProfile_OmitsPrivateFields(t *testing.T) {
+	user := database.User{
+		ID:             uuid.New(),
+		Email:          "private@example.com",
+		HashedPassword: "hash",
+		Handle:         "chirper",
+		DisplayName:    "Chirper",
+	}
+	stats := database.GetUserStatsRow{ChirpCount: 3, FollowerCount: 2, FollowingCount: 1}
+
+	data, err := json.Marshal(NewPublicProfile(user, stats))
+	if err != nil {
+		t.Fatalf("json.Marshal() unexpected error = %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() unexpected error = %v", err)
+	}
+	for _, key := range []string{"email", "hashed_password"} {
+		if _, found := got[key]; found {
+			t.Errorf("public profile leaks %q: %s", key, data)
+		}
+	}
+	if got["handle"] != "chirper" || got["chirp_count"] != float64(3) || got["follower_count"] != float64(2) || got["following_count"] != float64(1) {
+		t.Errorf("public profile = %s, missing expected fields", data)
+	}
+}
+
+func TestAPIConfig_FollowUser_CannotFollowSelf(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	userID := uuid.New()
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/users/"+userID.String()+"/follow", nil)
+	req.SetPathValue("id", userID.String())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	cfg.FollowUser(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/fanout"
+	"github.com/maniac-en/chirpstack/internal/stream"
+)
+
+// publishRealtime appends a message to the shared log, every server
+// instance picks it up from there and delivers it with DeliverRealtime
+func (cfg *APIConfig) publishRealtime(ctx context.Context, message fanout.Message) error {
+	if len(message.UserIDs) == 0 && len(message.Topics) == 0 {
+		return nil
+	}
+	// nil slices would be stored as NULL rather than empty arrays
+	if message.UserIDs == nil {
+		message.UserIDs = []uuid.UUID{}
+	}
+	if message.Topics == nil {
+		message.Topics = []string{}
+	}
+	if message.ExcludedUserIDs == nil {
+		message.ExcludedUserIDs = []uuid.UUID{}
+	}
+	return cfg.DB.CreateRealtimeMessage(ctx, database.CreateRealtimeMessageParams{
+		Event:           message.Event,
+		Data:            string(message.Data),
+		UserIds:         message.UserIDs,
+		Topics:          message.Topics,
+		ExcludedUserIds: message.ExcludedUserIDs,
+	})
+}
+
+// DeliverRealtime hands a message from the shared log to the clients
+// connected to this instance. The log's IDs become the stream's event IDs,
+// so clients can resume on any instance.
+func (cfg *APIConfig) DeliverRealtime(message fanout.Message) {
+	if cfg.StreamHub != nil && len(message.UserIDs) > 0 {
+		cfg.StreamHub.PublishMessage(stream.Message{
+			ID:    uint64(message.ID),
+			Event: message.Event,
+			Data:  message.Data,
+		}, message.UserIDs...)
+	}
+	if cfg.Gateway != nil {
+		for _, topic := range message.Topics {
+			if err := cfg.Gateway.Publish(topic, message.Event, message.Data, message.ExcludedUserIDs...); err != nil {
+				log.Printf("delivering realtime message %d: %v", message.ID, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/fanout"
+	"github.com/maniac-en/chirpstack/internal/stream"
+)
+
+func TestAPIConfig_DeliverRealtime(t *testing.T) {
+	cfg := &APIConfig{StreamHub: stream.NewHub()}
+	userID := uuid.New()
+	client, err := cfg.StreamHub.Subscribe(userID, 0, false)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error = %v", err)
+	}
+
+	cfg.DeliverRealtime(fanout.Message{
+		ID:      42,
+		Event:   StreamEventNotification,
+		Data:    []byte(`{"type":"like"}`),
+		UserIDs: []uuid.UUID{userID},
+		// no gateway on this instance, topics are skipped
+		Topics: []string{"hashtag:go"},
+	})
+	select {
+	case got := <-client.Messages():
+		if got.ID != 42 || got.Event != StreamEventNotification || string(got.Data) != `{"type":"like"}` {
+			t.Errorf("got %+v, want the message with the log's ID", got)
+		}
+	default:
+		t.Fatal("the message wasn't delivered to the stream")
+	}
+}
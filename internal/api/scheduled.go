@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+// statuses of a chirp, only published ones are visible to others
+const (
+	ChirpStatusPublished = "published"
+	ChirpStatusScheduled = "scheduled"
+)
+
+const (
+	// MaxScheduleAhead is how far in the future a chirp can be scheduled
+	MaxScheduleAhead = 365 * 24 * time.Hour
+	// publishBatchSize is how many due chirps a transaction publishes
+	publishBatchSize = 100
+)
+
+// checkPublishAt responds with a 400 and returns false unless publishAt is
+// in the future and no more than MaxScheduleAhead away
+func checkPublishAt(w http.ResponseWriter, publishAt time.Time) bool {
+	now := time.Now()
+	switch {
+	case !publishAt.After(now):
+		utils.RespondWithError(w, http.StatusBadRequest, "publish_at must be in the future")
+		return false
+	case publishAt.After(now.Add(MaxScheduleAhead)):
+		utils.RespondWithError(w, http.StatusBadRequest, "publish_at must be within a year")
+		return false
+	}
+	return true
+}
+
+// GetScheduledChirps lists the caller's chirps that aren't published yet,
+// the next one due first
+func (cfg *APIConfig) GetScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirps, err := cfg.DB.ListScheduledChirpsByAuthor(r.Context(), uuid.NullUUID{UUID: accessToken.UserID, Valid: true})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	responses, err := newChirpResponses(r.Context(), cfg.DB, chirps)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, responses)
+}
+
+// DeleteScheduledChirp cancels one of the caller's scheduled chirps. The
+// chirp is picked with the id query parameter, since
+// DELETE /api/chirps/scheduled/{id} would clash with
+// DELETE /api/chirps/{id}/like.
+func (cfg *APIConfig) DeleteScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpUUID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID passed")
+		return
+	}
+
+	// only chirps still scheduled match, so a cancel racing the publisher
+	// either wins or finds nothing
+	_, err = cfg.DB.DeleteScheduledChirp(r.Context(), database.DeleteScheduledChirpParams{
+		ID:     chirpUUID,
+		UserID: uuid.NullUUID{UUID: accessToken.UserID, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No scheduled chirp found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// RunChirpPublisher publishes scheduled chirps once they're due, every
+// interval until ctx is done. Several instances can run it at once, each
+// due chirp is published by exactly one of them.
+func (cfg *APIConfig) RunChirpPublisher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		published, err := cfg.publishDueChirps(ctx)
+		if err != nil {
+			log.Printf("chirp publisher: %v", err)
+		}
+		if published > 0 {
+			log.Printf("chirp publisher: published %d chirp(s)", published)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDueChirps publishes due chirps a batch at a time, recording their
+// ChirpCreated events in the same transaction as the status change
+func (cfg *APIConfig) publishDueChirps(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		var batch int
+		err := cfg.withTx(ctx, func(q *database.Queries) error {
+			chirps, err := q.PublishDueChirps(ctx, publishBatchSize)
+			if err != nil {
+				return err
+			}
+			responses, err := newChirpResponses(ctx, q, chirps)
+			if err != nil {
+				return err
+			}
+			for _, response := range responses {
+				if err := events.Record(ctx, q, events.ChirpCreated, response.UserID.UUID, response); err != nil {
+					return err
+				}
+			}
+			batch = len(chirps)
+			return nil
+		})
+		if err != nil {
+			return published, err
+		}
+		published += batch
+		if batch < publishBatchSize {
+			return published, nil
+		}
+	}
+}
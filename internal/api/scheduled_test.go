@@ -0,0 +1,178 @@
+package api
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+)
+
+func TestAPIConfig_CreateChirps_InvalidPublishAt(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		publishAt time.Time
+	}{
+		{name: "in the past", publishAt: time.Now().Add(-time.Minute)},
+		{name: "too far ahead", publishAt: time.Now().Add(MaxScheduleAhead + time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"body": "later", "publish_at": "` + tt.publishAt.Format(time.RFC3339) + `"}`
+			req := httptest.NewRequest("POST", "/api/chirps", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			cfg.CreateChirps(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_CreateChirps_PublishAtWithOffset(t *testing.T) {
+	userID := uuid.New()
+	var stored driver.Value
+	cfg, _ := testAPIConfig(t, map[string]fakeQuery{
+		"GetActivePlanByUserID": func([]driver.Value) ([][]driver.Value, error) { return nil, nil },
+		"CreateChirp": func(args []driver.Value) ([][]driver.Value, error) {
+			stored = args[4]
+			now := time.Now()
+			return [][]driver.Value{{uuid.NewString(), now, now, args[0], args[1], args[2], args[3], args[4], args[5], "{}"}}, nil
+		},
+	})
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	// publish_at is kept in a timestamp column, which has no time zone, so
+	// it must be stored in UTC or the offset is lost
+	india := time.FixedZone("IST", 5*60*60+30*60)
+	publishAt := time.Now().Add(24 * time.Hour).In(india).Truncate(time.Second)
+	body := `{"body": "later", "publish_at": "` + publishAt.Format(time.RFC3339) + `"}`
+	req := httptest.NewRequest("POST", "/api/chirps", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.CreateChirps(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	got, ok := stored.(time.Time)
+	if !ok {
+		t.Fatalf("CreateChirp publish_at = %#v, want a time", stored)
+	}
+	if got.Location() != time.UTC || !got.Equal(publishAt) {
+		t.Errorf("CreateChirp publish_at = %v, want %v", got, publishAt.UTC())
+	}
+}
+
+func TestAPIConfig_ScheduledChirps_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	readOnlyToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), []auth.Scope{auth.ScopeChirpsRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+	profileToken, err := auth.MakeScopedJWT(uuid.New(), uuid.NewString(), []auth.Scope{auth.ScopeProfileRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		method         string
+		target         string
+		token          string
+		expectedStatus int
+	}{
+		{name: "list without a token", handler: cfg.GetScheduledChirps, method: "GET", target: "/api/chirps/scheduled", expectedStatus: http.StatusUnauthorized},
+		{name: "list without chirps:read", handler: cfg.GetScheduledChirps, method: "GET", target: "/api/chirps/scheduled", token: profileToken, expectedStatus: http.StatusForbidden},
+		{name: "cancel without a token", handler: cfg.DeleteScheduledChirp, method: "DELETE", target: "/api/chirps/scheduled?id=" + uuid.NewString(), expectedStatus: http.StatusUnauthorized},
+		{name: "cancel without chirps:write", handler: cfg.DeleteScheduledChirp, method: "DELETE", target: "/api/chirps/scheduled?id=" + uuid.NewString(), token: readOnlyToken, expectedStatus: http.StatusForbidden},
+		{name: "cancel without an id", handler: cfg.DeleteScheduledChirp, method: "DELETE", target: "/api/chirps/scheduled", token: token, expectedStatus: http.StatusBadRequest},
+		{name: "cancel with an invalid id", handler: cfg.DeleteScheduledChirp, method: "DELETE", target: "/api/chirps/scheduled?id=nope", token: token, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_PublishDueChirps(t *testing.T) {
+	// a full batch means there may be more, so another one is taken
+	batches := []int{publishBatchSize, 1}
+	var recorded []driver.Value
+	cfg, db := testAPIConfig(t, map[string]fakeQuery{
+		"PublishDueChirps": func([]driver.Value) ([][]driver.Value, error) {
+			var rows [][]driver.Value
+			if len(batches) > 0 {
+				for range batches[0] {
+					publishAt := time.Now().Add(-time.Minute)
+					rows = append(rows, []driver.Value{uuid.NewString(), publishAt, time.Now(), "hi", uuid.NewString(), nil, "published", publishAt, VisibilityPublic, "{}"})
+				}
+				batches = batches[1:]
+			}
+			return rows, nil
+		},
+		"ListMediaForChirps": func([]driver.Value) ([][]driver.Value, error) {
+			return nil, nil
+		},
+		"CreateDomainEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			recorded = append(recorded, args[0])
+			now := time.Now()
+			return [][]driver.Value{{uuid.NewString(), now, args[0], args[1], args[2], "pending", int64(0), now, "", nil, "{}"}}, nil
+		},
+	})
+
+	published, err := cfg.publishDueChirps(t.Context())
+	if err != nil {
+		t.Fatalf("publishDueChirps() unexpected error = %v", err)
+	}
+	if published != publishBatchSize+1 {
+		t.Errorf("publishDueChirps() = %d, want %d", published, publishBatchSize+1)
+	}
+	if len(recorded) != published {
+		t.Errorf("recorded %d events, want one per published chirp", len(recorded))
+	}
+	for _, eventType := range recorded {
+		if eventType != "chirp.created" {
+			t.Errorf("recorded a %v event, want chirp.created", eventType)
+			break
+		}
+	}
+	// each batch is published with its events in its own transaction
+	commits := 0
+	for _, name := range db.called() {
+		if name == "COMMIT" {
+			commits++
+		}
+	}
+	if commits != 2 {
+		t.Errorf("committed %d transactions, want 2", commits)
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/fanout"
+	"github.com/maniac-en/chirpstack/internal/stream"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+// events sent on the stream
+const (
+	StreamEventChirpCreated = events.ChirpCreated
+	StreamEventChirpDeleted = events.ChirpDeleted
+	StreamEventNotification = "notification"
+)
+
+const (
+	// StreamHeartbeatInterval keeps proxies from closing idle streams
+	StreamHeartbeatInterval = 15 * time.Second
+	// streamRetry is how long clients wait before reconnecting, in
+	// milliseconds
+	streamRetry = 3000
+)
+
+// Stream pushes chirps created and deleted by followed users, and the
+// user's notifications, as Server-Sent Events. Clients reconnecting with
+// Last-Event-ID get the recent messages they missed.
+func (cfg *APIConfig) Stream(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	if cfg.StreamHub == nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "streaming is not available")
+		return
+	}
+
+	var lastEventID uint64
+	resume := false
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastEventID, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		resume = true
+	}
+
+	client, err := cfg.StreamHub.Subscribe(accessToken.UserID, lastEventID, resume)
+	if errors.Is(err, stream.ErrClosed) {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "server is shutting down")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer cfg.StreamHub.Unsubscribe(client)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, "retry: "+strconv.Itoa(streamRetry)+"\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(StreamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case message, ok := <-client.Messages():
+			if !ok {
+				// too far behind or shutting down, the client reconnects
+				// and resumes
+				return
+			}
+			if _, err := message.WriteTo(w); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// streamChirpEvent pushes a created or deleted chirp to its author and
+// the followers who may see it. New chirps skip followers who muted a word
+// in them, deletions go to everyone in case the chirp was seen before.
+func (cfg *APIConfig) streamChirpEvent(ctx context.Context, event events.Event) error {
+	var chirp chirpResponse
+	if err := event.Decode(&chirp); err != nil {
+		return err
+	}
+	if !chirp.UserID.Valid {
+		return nil
+	}
+	followerIDs, err := cfg.DB.GetTimelineFollowerIDs(ctx, chirp.UserID.UUID)
+	if err != nil {
+		return err
+	}
+	audience := chirpAudience(chirp.Chirp, followerIDs)
+	if event.Type == events.ChirpCreated {
+		audience, err = cfg.withoutMutedWords(ctx, chirp.Chirp, audience)
+		if err != nil {
+			return err
+		}
+	}
+	return cfg.streamToUsers(ctx, event.Type, chirp, audience...)
+}
+
+// streamToUsers pushes v as JSON to the users' open streams, on whichever
+// instance they're connected to
+func (cfg *APIConfig) streamToUsers(ctx context.Context, event string, v any, userIDs ...uuid.UUID) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return cfg.publishRealtime(ctx, fanout.Message{Event: event, Data: data, UserIDs: userIDs})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/stream"
+)
+
+// readEvent reads lines up to the blank line ending an SSE event
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var event strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		if line == "\n" {
+			return event.String()
+		}
+		event.WriteString(line)
+	}
+}
+
+func TestAPIConfig_Stream(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	cfg.StreamHub = stream.NewHub()
+	userID := uuid.New()
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(cfg.Stream))
+	defer server.Close()
+
+	connect := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("connecting to stream: %v", err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+		}
+		if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Content-Type = %q, want text/event-stream", ct)
+		}
+		body := bufio.NewReader(res.Body)
+		// the retry preamble is sent once the client is subscribed
+		if got := readEvent(t, body); got != "retry: 3000\n" {
+			t.Fatalf("first event = %q, want the retry preamble", got)
+		}
+		return res, body
+	}
+
+	res, body := connect("")
+	cfg.StreamHub.PublishMessage(stream.Message{ID: 1, Event: StreamEventNotification, Data: []byte(`{"type":"like"}`)}, userID)
+	cfg.StreamHub.PublishMessage(stream.Message{ID: 2, Event: StreamEventChirpCreated, Data: []byte(`{}`)}, uuid.New())
+	cfg.StreamHub.PublishMessage(stream.Message{ID: 3, Event: StreamEventChirpDeleted, Data: []byte(`{"id":"x"}`)}, userID)
+
+	first := readEvent(t, body)
+	if !strings.Contains(first, "event: notification\ndata: {\"type\":\"like\"}\n") {
+		t.Errorf("first event = %q, want the notification", first)
+	}
+	id := strings.TrimPrefix(strings.SplitN(first, "\n", 2)[0], "id: ")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		t.Fatalf("event has no numeric id: %q", first)
+	}
+	if second := readEvent(t, body); !strings.Contains(second, "event: chirp.deleted\n") {
+		t.Errorf("second event = %q, want the deleted chirp only", second)
+	}
+	res.Body.Close()
+
+	// resuming after the first event replays the second
+	res, body = connect(id)
+	if got := readEvent(t, body); !strings.Contains(got, "event: chirp.deleted\n") {
+		t.Errorf("resumed with %q, want the deleted chirp", got)
+	}
+
+	// closing the hub ends the stream
+	cfg.StreamHub.Close()
+	if _, err := io.ReadAll(body); err != nil {
+		t.Errorf("reading closed stream: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestAPIConfig_Stream_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	cfg.StreamHub = stream.NewHub()
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Last-Event-ID", "nope")
+	w := httptest.NewRecorder()
+	cfg.Stream(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid Last-Event-ID: expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	cfg.StreamHub.Close()
+	req = httptest.NewRequest("GET", "/api/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	cfg.Stream(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("closed hub: expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/stream", nil)
+	w = httptest.NewRecorder()
+	cfg.Stream(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
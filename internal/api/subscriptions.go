@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/webhooks"
+)
+
+// DefaultSubscriptionPeriod is how long a renewal extends a subscription by
+// when the provider doesn't tell us when the new period ends. Upgrades
+// without a period end are open-ended, Polka never renews so would
+// otherwise take Chirpy Red away after one period.
+const DefaultSubscriptionPeriod = 30 * 24 * time.Hour
+
+// Plan is a Chirpy Red tier, every plan makes a user Chirpy Red
+type Plan string
+
+const (
+	PlanRed     Plan = "red"
+	PlanRedPlus Plan = "red_plus"
+)
+
+func (p Plan) IsValid() bool {
+	switch p {
+	case PlanRed, PlanRedPlus:
+		return true
+	default:
+		return false
+	}
+}
+
+func ValidPlans() []Plan {
+	return []Plan{PlanRed, PlanRedPlus}
+}
+
+func ParsePlan(s string) (Plan, error) {
+	p := Plan(s)
+	if !p.IsValid() {
+		return "", fmt.Errorf("invalid plan '%s', must be one of: %v", s, ValidPlans())
+	}
+	return p, nil
+}
+
+var errWebhookInvalidPayload = errors.New("invalid webhook payload")
+
+// processSubscriptionEvent applies a subscription lifecycle event and
+// records the changed subscription as a domain event. Renewals and
+// cancellations for users without a subscription fail with
+// errWebhookUserNotFound, like upgrades for unknown users. Downgrading a
+// user without one changes nothing: they're already downgraded.
+func (cfg *APIConfig) processSubscriptionEvent(ctx context.Context, event webhooks.Event) error {
+	plan := PlanRed
+	if event.Type == webhooks.EventUserUpgraded && event.Plan != "" {
+		var err error
+		plan, err = ParsePlan(event.Plan)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errWebhookInvalidPayload, err)
+		}
+	}
+
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		var subscription database.Subscription
+		var err error
+		switch event.Type {
+		case webhooks.EventUserUpgraded:
+			subscription, err = q.StartSubscription(ctx, database.StartSubscriptionParams{
+				Plan:             string(plan),
+				CurrentPeriodEnd: subscriptionPeriodEnd(event, sql.NullTime{}, time.Now()),
+				UserID:           event.UserID,
+			})
+		case webhooks.EventSubscriptionRenewed:
+			subscription, err = q.GetSubscriptionByUserID(ctx, event.UserID)
+			if err != nil {
+				return err
+			}
+			subscription, err = q.RenewSubscription(ctx, database.RenewSubscriptionParams{
+				UserID:           event.UserID,
+				CurrentPeriodEnd: subscriptionPeriodEnd(event, subscription.CurrentPeriodEnd, time.Now()),
+			})
+		case webhooks.EventSubscriptionCanceled:
+			subscription, err = q.CancelSubscription(ctx, event.UserID)
+		case webhooks.EventUserDowngraded:
+			subscription, err = q.EndSubscription(ctx, event.UserID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+		default:
+			return fmt.Errorf("not a subscription event: %s", event.Type)
+		}
+		if err != nil {
+			return err
+		}
+		return events.Record(ctx, q, events.SubscriptionChanged, event.UserID, subscription)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return errWebhookUserNotFound
+	}
+	return err
+}
+
+// subscriptionPeriodEnd is the end of the period the provider sent.
+// Otherwise a subscription with a period is extended by one default period,
+// from the end of the current one if it hasn't ended yet rather than
+// dropping what's left of it, and one without (current is NULL) stays
+// open-ended.
+func subscriptionPeriodEnd(event webhooks.Event, current sql.NullTime, now time.Time) sql.NullTime {
+	if !event.CurrentPeriodEnd.IsZero() {
+		return sql.NullTime{Time: event.CurrentPeriodEnd.UTC(), Valid: true}
+	}
+	if !current.Valid {
+		return sql.NullTime{}
+	}
+	from := now
+	if current.Time.After(from) {
+		from = current.Time
+	}
+	return sql.NullTime{Time: from.Add(DefaultSubscriptionPeriod).UTC(), Valid: true}
+}
+
+func isSubscriptionEvent(eventType string) bool {
+	switch eventType {
+	case webhooks.EventUserUpgraded, webhooks.EventUserDowngraded,
+		webhooks.EventSubscriptionRenewed, webhooks.EventSubscriptionCanceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// RunSubscriptionExpirer marks subscriptions whose period is over as
+// expired, every interval until ctx is done. Users stop being Chirpy Red at
+// the end of the period either way, this keeps the status column honest.
+func (cfg *APIConfig) RunSubscriptionExpirer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		expired, err := cfg.DB.ExpireSubscriptions(ctx)
+		if err != nil {
+			log.Printf("subscription expirer: %v", err)
+		} else if expired > 0 {
+			log.Printf("subscription expirer: expired %d subscription(s)", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
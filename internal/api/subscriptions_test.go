@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/webhooks"
+)
+
+func TestParsePlan(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Plan
+		wantErr bool
+	}{
+		{input: "red", want: PlanRed},
+		{input: "red_plus", want: PlanRedPlus},
+		{input: "RED", wantErr: true},
+		{input: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePlan(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePlan(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePlan(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionPeriodEnd(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sent := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	period := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+
+	tests := []struct {
+		name    string
+		event   webhooks.Event
+		current sql.NullTime
+		want    sql.NullTime
+	}{
+		{name: "provider's period end", event: webhooks.Event{CurrentPeriodEnd: sent}, want: period(sent)},
+		{name: "provider's period end over the current one", event: webhooks.Event{CurrentPeriodEnd: sent}, current: period(now.Add(time.Hour)), want: period(sent)},
+		{name: "provider's period end with an offset", event: webhooks.Event{CurrentPeriodEnd: sent.In(time.FixedZone("PST", -8*60*60))}, want: period(sent)},
+		// Polka sends no period and never renews, so an upgrade must not lapse
+		{name: "open-ended", want: sql.NullTime{}},
+		{name: "ended period", current: period(now.Add(-time.Hour)), want: period(now.Add(DefaultSubscriptionPeriod))},
+		{name: "running period", current: period(now.Add(time.Hour)), want: period(now.Add(time.Hour + DefaultSubscriptionPeriod))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := subscriptionPeriodEnd(tt.event, tt.current, now)
+			// current_period_end has no time zone, so it's stored in UTC
+			if got.Valid != tt.want.Valid || !got.Time.Equal(tt.want.Time) || got.Valid && got.Time.Location() != time.UTC {
+				t.Errorf("subscriptionPeriodEnd() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_ProcessSubscriptionEvent_RejectsUnknownPlan(t *testing.T) {
+	cfg := &APIConfig{}
+	event := webhooks.Event{Type: webhooks.EventUserUpgraded, UserID: uuid.New(), Plan: "gold"}
+	err := cfg.processSubscriptionEvent(context.Background(), event)
+	if !errors.Is(err, errWebhookInvalidPayload) {
+		t.Errorf("processSubscriptionEvent() error = %v, want %v", err, errWebhookInvalidPayload)
+	}
+}
+
+func TestAPIConfig_ProcessSubscriptionEvent_UpgradeWithoutPeriodIsOpenEnded(t *testing.T) {
+	userID := uuid.New()
+	var periodEnd driver.Value = "unset"
+	cfg, db := testAPIConfig(t, map[string]fakeQuery{
+		"StartSubscription": func(args []driver.Value) ([][]driver.Value, error) {
+			periodEnd = args[1]
+			now := time.Now()
+			return [][]driver.Value{{uuid.NewString(), now, now, userID.String(), args[0], "active", args[1], nil}}, nil
+		},
+		"CreateDomainEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			now := time.Now()
+			return [][]driver.Value{{uuid.NewString(), now, args[0], args[1], args[2], "pending", int64(0), now, "", nil, "{}"}}, nil
+		},
+	})
+
+	// Polka's upgrade: no period end, and no renewal will ever follow
+	event := webhooks.Event{Type: webhooks.EventUserUpgraded, UserID: userID}
+	if err := cfg.processSubscriptionEvent(context.Background(), event); err != nil {
+		t.Fatalf("processSubscriptionEvent() unexpected error = %v", err)
+	}
+	if periodEnd != nil {
+		t.Errorf("StartSubscription current_period_end = %v, want NULL", periodEnd)
+	}
+	if got := strings.Join(db.called(), ","); got != "BEGIN,StartSubscription,CreateDomainEvent,COMMIT" {
+		t.Errorf("queries = %s", got)
+	}
+}
+
+func TestAPIConfig_ProcessSubscriptionEvent_DowngradeWithoutSubscription(t *testing.T) {
+	cfg, db := testAPIConfig(t, map[string]fakeQuery{
+		"EndSubscription": func(args []driver.Value) ([][]driver.Value, error) {
+			return nil, nil
+		},
+	})
+
+	// retried forever by the provider if it isn't acknowledged
+	event := webhooks.Event{Type: webhooks.EventUserDowngraded, UserID: uuid.New()}
+	if err := cfg.processSubscriptionEvent(context.Background(), event); err != nil {
+		t.Fatalf("processSubscriptionEvent() unexpected error = %v", err)
+	}
+	if got := strings.Join(db.called(), ","); got != "BEGIN,EndSubscription,COMMIT" {
+		t.Errorf("queries = %s, want no domain event", got)
+	}
+}
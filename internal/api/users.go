@@ -1,19 +1,84 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/mail"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/maniac-en/chirpstack/internal/auth"
 	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/events"
 	"github.com/maniac-en/chirpstack/internal/utils"
+
+	"github.com/lib/pq"
 )
 
+// noPassword is the hashed password of accounts without one, the column's
+// default. Accounts created through an OIDC provider have none until the
+// user sets one. No password matches it.
+const noPassword = "unset"
+
+// hasPassword reports whether user signs in with a password, and so has to
+// confirm it to change their credentials or delete their account
+func hasPassword(user database.User) bool {
+	return user.HashedPassword != noPassword
+}
+
+// userResponse is a user as the API returns it. is_chirpy_red is derived
+// from the user's subscription rather than stored on the user.
+type userResponse struct {
+	database.User
+	IsChirpyRed bool `json:"is_chirpy_red"`
+	HasPassword bool `json:"has_password"`
+}
+
+func newUserResponse(ctx context.Context, q *database.Queries, user database.User) (userResponse, error) {
+	isChirpyRed, err := q.HasActiveSubscription(ctx, user.ID)
+	if err != nil {
+		return userResponse{}, err
+	}
+	return userResponse{User: user, IsChirpyRed: isChirpyRed, HasPassword: hasPassword(user)}, nil
+}
+
+// confirmCurrentPassword checks the current password of userID, unless
+// their account has none. It responds itself and returns false when the
+// password is missing or wrong.
+func (cfg *APIConfig) confirmCurrentPassword(w http.ResponseWriter, r *http.Request, userID uuid.UUID, currentPassword string) bool {
+	storedUserInfo, err := cfg.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusUnauthorized, "invalid token")
+			return false
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return false
+	}
+	if !hasPassword(storedUserInfo) {
+		// signed in through a provider, there's no password to confirm
+		return true
+	}
+	if currentPassword == "" {
+		utils.RespondWithError(w, http.StatusUnauthorized, ErrCurrentPasswordRequired)
+		return false
+	}
+	err = auth.CheckPasswordHash(currentPassword, storedUserInfo.HashedPassword)
+	if err != nil {
+		if err.Error() == auth.ErrIncorrectEmailOrPassword {
+			utils.RespondWithError(w, http.StatusUnauthorized, ErrIncorrectCurrentPassword)
+			return false
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return false
+	}
+	return true
+}
+
 func (cfg *APIConfig) CreateUser(w http.ResponseWriter, r *http.Request) {
 	type requestBody struct {
 		Password string `json:"password"`
@@ -58,25 +123,28 @@ func (cfg *APIConfig) CreateUser(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusCreated, newUser)
+	// new users can't have a subscription yet
+	utils.RespondWithJSON(w, http.StatusCreated, userResponse{User: newUser, HasPassword: hasPassword(newUser)})
 }
 
 func (cfg *APIConfig) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	jwtToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-
-	userID, err := auth.ValidateJWT(jwtToken, cfg.JWTTokenSecret)
+	accessToken, err := cfg.authenticate(r, auth.ScopeProfileWrite)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusUnauthorized, "invalid token")
+		respondWithAuthError(w, err)
 		return
 	}
+	userID := accessToken.UserID
 
+	// every field is optional, only the ones present in the request are
+	// updated
 	type requestBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		DisplayName     *string `json:"display_name"`
+		Handle          *string `json:"handle"`
+		Bio             *string `json:"bio"`
+		AvatarURL       *string `json:"avatar_url"`
 	}
 	defer r.Body.Close()
 	data, err := io.ReadAll(r.Body)
@@ -90,79 +158,97 @@ func (cfg *APIConfig) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = mail.ParseAddress(params.Email)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid email address")
-		return
+	updateUserParams := database.UpdateUserParams{
+		ID: userID,
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
-	if err != nil {
-		if err.Error() == auth.ErrPasswordTooLong {
-			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	// changing credentials requires a first-party session and the current
+	// password, if the account has one
+	if params.Email != nil || params.Password != nil {
+		if !accessToken.IsFirstParty() {
+			respondWithAuthError(w, errInsufficientScope)
 			return
-		} else {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		}
+		if !cfg.confirmCurrentPassword(w, r, userID, params.CurrentPassword) {
 			return
 		}
 	}
 
-	updateUserParams := database.UpdateUserParams{
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-		ID:             userID,
-	}
-
-	updatedUserInfo, err := cfg.DB.UpdateUser(r.Context(), updateUserParams)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
-		return
-	}
-	utils.RespondWithJSON(w, http.StatusOK, updatedUserInfo)
-}
-
-func (cfg *APIConfig) UpgradeUser(w http.ResponseWriter, r *http.Request) {
-	// validate the API key for
-	polkaAPIKey, err := auth.GetAPIKey(r.Header)
-	if err != nil || polkaAPIKey != cfg.PolkaAPIKey {
-		utils.RespondWithError(w, http.StatusUnauthorized, "missing/invalid API key")
-		return
-	}
-
-	type requestBody struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID uuid.UUID `json:"user_id"`
-		} `json:"data"`
-	}
-
-	defer r.Body.Close()
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
-		return
-	}
-	var params requestBody
-	if err := json.Unmarshal(data, &params); err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
-		return
-	}
-
-	// check if the event is valid
-	if params.Event != "user.upgraded" {
-		utils.RespondWithError(w, http.StatusNoContent, "invalid event")
-		return
+	if params.Email != nil {
+		_, err = mail.ParseAddress(*params.Email)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+		updateUserParams.Email = sql.NullString{String: *params.Email, Valid: true}
+	}
+
+	if params.Password != nil {
+		hashedPassword, err := auth.HashPassword(*params.Password)
+		if err != nil {
+			if err.Error() == auth.ErrPasswordTooLong {
+				utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			} else {
+				utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+				return
+			}
+		}
+		updateUserParams.HashedPassword = sql.NullString{String: hashedPassword, Valid: true}
+	}
+
+	profileFields := []struct {
+		value    *string
+		validate func(string) error
+		dest     *sql.NullString
+	}{
+		{params.DisplayName, ValidateDisplayName, &updateUserParams.DisplayName},
+		{params.Handle, ValidateHandle, &updateUserParams.Handle},
+		{params.Bio, ValidateBio, &updateUserParams.Bio},
+		{params.AvatarURL, ValidateAvatarURL, &updateUserParams.AvatarURL},
+	}
+	for _, field := range profileFields {
+		if field.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*field.value)
+		if err := field.validate(value); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		*field.dest = sql.NullString{String: value, Valid: true}
 	}
 
-	// upgrade user
-	_, err = cfg.DB.UpgradeUser(r.Context(), params.Data.UserID)
+	var res userResponse
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		updatedUserInfo, err := q.UpdateUser(r.Context(), updateUserParams)
+		if err != nil {
+			return err
+		}
+		res, err = newUserResponse(r.Context(), q, updatedUserInfo)
+		if err != nil {
+			return err
+		}
+		return events.Record(r.Context(), q, events.UserUpdated, userID, res)
+	})
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
+			switch pqErr.Constraint {
+			case "users_email_key":
+				utils.RespondWithError(w, http.StatusConflict, "Email already in use")
+				return
+			case "users_handle_key":
+				utils.RespondWithError(w, http.StatusConflict, "Handle already taken")
+				return
+			}
+		}
 		if errors.Is(err, sql.ErrNoRows) {
-			utils.RespondWithError(w, http.StatusNotFound, "user not found")
+			utils.RespondWithError(w, http.StatusUnauthorized, "invalid token")
 			return
 		}
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
-	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	utils.RespondWithJSON(w, http.StatusOK, res)
 }
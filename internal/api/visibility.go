@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+// who can see a chirp besides its author and the users it mentions
+const (
+	// VisibilityPublic chirps are seen by everyone, signed in or not
+	VisibilityPublic = "public"
+	// VisibilityFollowers chirps are seen by the author's followers
+	VisibilityFollowers = "followers"
+	// VisibilityMentioned chirps are seen by no one else
+	VisibilityMentioned = "mentioned"
+)
+
+var errInvalidVisibility = errors.New("visibility must be one of: public, followers, mentioned")
+
+// parseVisibility validates a requested visibility, chirps are public unless
+// asked otherwise
+func parseVisibility(visibility string) (string, error) {
+	switch visibility {
+	case "":
+		return VisibilityPublic, nil
+	case VisibilityPublic, VisibilityFollowers, VisibilityMentioned:
+		return visibility, nil
+	}
+	return "", errInvalidVisibility
+}
+
+// authenticateViewer resolves who is reading chirps. Reading doesn't need a
+// token: without one, or with one lacking chirps:read, the viewer is
+// anonymous and only sees public chirps. A token that's invalid is still an
+// error.
+func (cfg *APIConfig) authenticateViewer(r *http.Request) (uuid.NullUUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}, nil
+	}
+	accessToken, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if errors.Is(err, errInsufficientScope) {
+		return uuid.NullUUID{}, nil
+	}
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: accessToken.UserID, Valid: true}, nil
+}
+
+// chirpVisibleTo reports whether viewerID may see chirp, given whether they
+// follow its author. It mirrors the visibility condition of the
+// chirp_visible_to SQL function, for chirps that come from events rather
+// than the queries using it.
+func chirpVisibleTo(chirp database.Chirp, viewerID uuid.NullUUID, followsAuthor bool) bool {
+	if chirp.Visibility == VisibilityPublic {
+		return true
+	}
+	if !viewerID.Valid {
+		return false
+	}
+	if chirp.UserID.Valid && chirp.UserID.UUID == viewerID.UUID {
+		return true
+	}
+	if slices.Contains(chirp.MentionedIds, viewerID.UUID) {
+		return true
+	}
+	return chirp.Visibility == VisibilityFollowers && followsAuthor
+}
+
+// canView is chirpVisibleTo, looking up whether viewerID follows the author
+// only when it matters
+func (cfg *APIConfig) canView(ctx context.Context, viewerID uuid.UUID, chirp database.Chirp) (bool, error) {
+	viewer := uuid.NullUUID{UUID: viewerID, Valid: true}
+	if chirpVisibleTo(chirp, viewer, false) {
+		return true, nil
+	}
+	if chirp.Visibility != VisibilityFollowers || !chirp.UserID.Valid {
+		return false, nil
+	}
+	follows, err := cfg.DB.IsFollowing(ctx, database.IsFollowingParams{
+		FollowerID: viewerID,
+		FolloweeID: chirp.UserID.UUID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return chirpVisibleTo(chirp, viewer, follows), nil
+}
+
+// chirpAudience returns the users whose timelines get chirp: its author and
+// those of followerIDs, the author's followers, who may see it
+func chirpAudience(chirp database.Chirp, followerIDs []uuid.UUID) []uuid.UUID {
+	audience := make([]uuid.UUID, 0, len(followerIDs)+1)
+	for _, followerID := range followerIDs {
+		if chirpVisibleTo(chirp, uuid.NullUUID{UUID: followerID, Valid: true}, true) {
+			audience = append(audience, followerID)
+		}
+	}
+	return append(audience, chirp.UserID.UUID)
+}
+
+// mentionedUserIDs resolves the users authorID @mentions in body, who can
+// always see the chirp. Handles of users blocked either way are left as
+// text.
+func (cfg *APIConfig) mentionedUserIDs(ctx context.Context, authorID uuid.UUID, body string) ([]uuid.UUID, error) {
+	handles := ParseMentions(body)
+	if len(handles) == 0 {
+		return []uuid.UUID{}, nil
+	}
+	userIDs, err := cfg.DB.GetUserIDsByHandles(ctx, database.GetUserIDsByHandlesParams{
+		Handles:  handles,
+		AuthorID: authorID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if userIDs == nil {
+		userIDs = []uuid.UUID{}
+	}
+	return userIDs, nil
+}
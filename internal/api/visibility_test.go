@@ -0,0 +1,196 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+func TestParseVisibility(t *testing.T) {
+	tests := []struct {
+		visibility string
+		want       string
+		wantErr    bool
+	}{
+		{visibility: "", want: VisibilityPublic},
+		{visibility: "public", want: VisibilityPublic},
+		{visibility: "followers", want: VisibilityFollowers},
+		{visibility: "mentioned", want: VisibilityMentioned},
+		{visibility: "Public", wantErr: true},
+		{visibility: "private", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseVisibility(tt.visibility)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseVisibility(%q) error = %v, wantErr %v", tt.visibility, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseVisibility(%q) = %q, want %q", tt.visibility, got, tt.want)
+		}
+	}
+}
+
+func TestChirpVisibleTo(t *testing.T) {
+	authorID := uuid.New()
+	mentionedID := uuid.New()
+	mentionedFollowerID := uuid.New()
+
+	// every viewer a chirp can have, and whether they follow the author
+	viewers := []struct {
+		name    string
+		id      uuid.NullUUID
+		follows bool
+	}{
+		{name: "anonymous"},
+		{name: "author", id: uuid.NullUUID{UUID: authorID, Valid: true}},
+		{name: "follower", id: uuid.NullUUID{UUID: uuid.New(), Valid: true}, follows: true},
+		{name: "mentioned", id: uuid.NullUUID{UUID: mentionedID, Valid: true}},
+		{name: "mentioned follower", id: uuid.NullUUID{UUID: mentionedFollowerID, Valid: true}, follows: true},
+		{name: "stranger", id: uuid.NullUUID{UUID: uuid.New(), Valid: true}},
+	}
+	// who sees each visibility, in the order of viewers
+	tests := []struct {
+		visibility string
+		want       []bool
+	}{
+		{visibility: VisibilityPublic, want: []bool{true, true, true, true, true, true}},
+		{visibility: VisibilityFollowers, want: []bool{false, true, true, true, true, false}},
+		{visibility: VisibilityMentioned, want: []bool{false, true, false, true, true, false}},
+		// unknown visibilities, like a missing one, show the chirp to no
+		// one but those it's addressed to
+		{visibility: "", want: []bool{false, true, false, true, true, false}},
+	}
+	for _, tt := range tests {
+		chirp := database.Chirp{
+			ID:           uuid.New(),
+			UserID:       uuid.NullUUID{UUID: authorID, Valid: true},
+			Visibility:   tt.visibility,
+			MentionedIds: []uuid.UUID{mentionedID, mentionedFollowerID},
+		}
+		for i, viewer := range viewers {
+			if got := chirpVisibleTo(chirp, viewer.id, viewer.follows); got != tt.want[i] {
+				t.Errorf("chirpVisibleTo(%q chirp, %s) = %v, want %v", tt.visibility, viewer.name, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestChirpAudience(t *testing.T) {
+	authorID := uuid.New()
+	follower := uuid.New()
+	mentionedFollower := uuid.New()
+	mentioned := uuid.New()
+	followers := []uuid.UUID{follower, mentionedFollower}
+
+	tests := []struct {
+		visibility string
+		want       []uuid.UUID
+	}{
+		{visibility: VisibilityPublic, want: []uuid.UUID{follower, mentionedFollower, authorID}},
+		{visibility: VisibilityFollowers, want: []uuid.UUID{follower, mentionedFollower, authorID}},
+		// timelines only show followed users, so mentioned users who don't
+		// follow the author find the chirp through their notifications
+		{visibility: VisibilityMentioned, want: []uuid.UUID{mentionedFollower, authorID}},
+	}
+	for _, tt := range tests {
+		chirp := database.Chirp{
+			UserID:       uuid.NullUUID{UUID: authorID, Valid: true},
+			Visibility:   tt.visibility,
+			MentionedIds: []uuid.UUID{mentionedFollower, mentioned},
+		}
+		if got := chirpAudience(chirp, followers); !slices.Equal(got, tt.want) {
+			t.Errorf("chirpAudience(%q chirp) = %v, want %v", tt.visibility, got, tt.want)
+		}
+	}
+}
+
+func TestAPIConfig_ChirpVisibility_Errors(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	token, err := auth.MakeJWT(uuid.New(), cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+
+	t.Run("invalid visibility", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/chirps", strings.NewReader(`{"body": "hi", "visibility": "secret"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		cfg.CreateChirps(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+		}
+	})
+
+	// a bad token is refused rather than read as anonymous, so clients
+	// notice they're missing chirps
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "list", handler: cfg.GetChirps},
+		{name: "by ID", handler: cfg.GetChirpByID},
+	} {
+		t.Run(tt.name+" with an invalid token", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/chirps", nil)
+			req.SetPathValue("id", uuid.NewString())
+			req.Header.Set("Authorization", "Bearer not-a-token")
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusUnauthorized, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPIConfig_AuthenticateViewer(t *testing.T) {
+	cfg, _ := testAPIConfig(t, nil)
+	userID := uuid.New()
+	token, err := auth.MakeJWT(userID, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	readToken, err := auth.MakeScopedJWT(userID, uuid.NewString(), []auth.Scope{auth.ScopeChirpsRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+	profileToken, err := auth.MakeScopedJWT(userID, uuid.NewString(), []auth.Scope{auth.ScopeProfileRead}, cfg.JWTTokenSecret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    uuid.NullUUID
+		wantErr bool
+	}{
+		{name: "no token", want: uuid.NullUUID{}},
+		{name: "first-party token", token: token, want: uuid.NullUUID{UUID: userID, Valid: true}},
+		{name: "chirps:read", token: readToken, want: uuid.NullUUID{UUID: userID, Valid: true}},
+		{name: "without chirps:read", token: profileToken, want: uuid.NullUUID{}},
+		{name: "invalid token", token: "not-a-token", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/chirps", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			got, err := cfg.authenticateViewer(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authenticateViewer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("authenticateViewer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
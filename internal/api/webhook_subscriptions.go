@@ -0,0 +1,339 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/auth"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/dispatch"
+	"github.com/maniac-en/chirpstack/internal/preview"
+	"github.com/maniac-en/chirpstack/internal/utils"
+)
+
+const (
+	MaxWebhookSubscriptionsPerUser = 10
+	MaxWebhookURLLength            = 2048
+
+	DefaultWebhookDeliveriesLimit = 50
+	MaxWebhookDeliveriesLimit     = 200
+)
+
+// ValidateWebhookURL only allows https, signed payloads would be readable on
+// the wire otherwise. Hosts that are obviously not public are refused up
+// front, names resolving to private addresses are refused by the
+// dispatcher when it connects.
+func ValidateWebhookURL(webhookURL string) error {
+	if len(webhookURL) > MaxWebhookURLLength {
+		return fmt.Errorf("url must be at most %d characters", MaxWebhookURLLength)
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("url must be an absolute URL")
+	}
+	if u.User != nil || u.Fragment != "" {
+		return fmt.Errorf("url must not contain credentials or a fragment")
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("url must use https")
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("url must point to a public address")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && preview.IsBlocked(addr) {
+		return fmt.Errorf("url must point to a public address")
+	}
+	return nil
+}
+
+// parseWebhookEventTypes validates and dedupes the requested event types
+func parseWebhookEventTypes(eventTypes []string) ([]string, error) {
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("events must list at least one of: %v", dispatch.ValidEventTypes())
+	}
+	parsed := make([]string, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		if !dispatch.IsValidEventType(eventType) {
+			return nil, fmt.Errorf("invalid event '%s', must be one of: %v", eventType, dispatch.ValidEventTypes())
+		}
+		if !slices.Contains(parsed, eventType) {
+			parsed = append(parsed, eventType)
+		}
+	}
+	return parsed, nil
+}
+
+func (cfg *APIConfig) CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	cfg.createWebhookSubscription(w, r, uuid.NullUUID{UUID: accessToken.UserID, Valid: true})
+}
+
+func (cfg *APIConfig) GetWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	cfg.getWebhookSubscriptions(w, r, uuid.NullUUID{UUID: accessToken.UserID, Valid: true})
+}
+
+func (cfg *APIConfig) DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	cfg.deleteWebhookSubscription(w, r, uuid.NullUUID{UUID: accessToken.UserID, Valid: true})
+}
+
+func (cfg *APIConfig) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	cfg.getWebhookDeliveries(w, r, uuid.NullUUID{UUID: accessToken.UserID, Valid: true})
+}
+
+func (cfg *APIConfig) RetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	accessToken, err := cfg.authenticate(r, "")
+	if err != nil {
+		respondWithAuthError(w, err)
+		return
+	}
+	cfg.retryWebhookDelivery(w, r, uuid.NullUUID{UUID: accessToken.UserID, Valid: true})
+}
+
+// the admin variants manage subscriptions without an owner, which receive
+// events about every user
+
+func (cfg *APIConfig) AdminCreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.authorizeAdmin(r); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	cfg.createWebhookSubscription(w, r, uuid.NullUUID{})
+}
+
+func (cfg *APIConfig) AdminGetWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.authorizeAdmin(r); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	cfg.getWebhookSubscriptions(w, r, uuid.NullUUID{})
+}
+
+func (cfg *APIConfig) AdminDeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.authorizeAdmin(r); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	cfg.deleteWebhookSubscription(w, r, uuid.NullUUID{})
+}
+
+func (cfg *APIConfig) AdminGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.authorizeAdmin(r); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	cfg.getWebhookDeliveries(w, r, uuid.NullUUID{})
+}
+
+func (cfg *APIConfig) AdminRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.authorizeAdmin(r); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	cfg.retryWebhookDelivery(w, r, uuid.NullUUID{})
+}
+
+func (cfg *APIConfig) createWebhookSubscription(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	type requestBody struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	type responseBody struct {
+		database.WebhookSubscription
+		Secret string `json:"secret"`
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	params := requestBody{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := ValidateWebhookURL(params.URL); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	eventTypes, err := parseWebhookEventTypes(params.Events)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if owner.Valid {
+		count, err := cfg.DB.CountWebhookSubscriptionsByUserID(r.Context(), owner)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		if count >= MaxWebhookSubscriptionsPerUser {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("at most %d webhook subscriptions allowed, delete one first", MaxWebhookSubscriptionsPerUser))
+			return
+		}
+	}
+
+	// the secret signs every delivery, so unlike API keys it is stored as is
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	secret = "whsec_" + secret
+	subscription, err := cfg.DB.CreateWebhookSubscription(r.Context(), database.CreateWebhookSubscriptionParams{
+		UserID:     owner,
+		URL:        params.URL,
+		Secret:     secret,
+		EventTypes: eventTypes,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, responseBody{subscription, secret})
+}
+
+func (cfg *APIConfig) getWebhookSubscriptions(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	subscriptions, err := cfg.DB.GetWebhookSubscriptions(r.Context(), owner)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if subscriptions == nil {
+		subscriptions = []database.WebhookSubscription{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, subscriptions)
+}
+
+func (cfg *APIConfig) deleteWebhookSubscription(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	subscriptionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid subscription ID passed")
+		return
+	}
+	deleted, err := cfg.DB.DeleteWebhookSubscription(r.Context(), database.DeleteWebhookSubscriptionParams{
+		ID:     subscriptionID,
+		UserID: owner,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deleted == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "No webhook subscription found")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// ownedWebhookSubscription looks up the subscription in the path, responding
+// with 400 or 404 when it isn't one of owner's
+func (cfg *APIConfig) ownedWebhookSubscription(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) (database.WebhookSubscription, bool) {
+	subscriptionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid subscription ID passed")
+		return database.WebhookSubscription{}, false
+	}
+	subscription, err := cfg.DB.GetWebhookSubscription(r.Context(), database.GetWebhookSubscriptionParams{
+		ID:     subscriptionID,
+		UserID: owner,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No webhook subscription found")
+			return database.WebhookSubscription{}, false
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return database.WebhookSubscription{}, false
+	}
+	return subscription, true
+}
+
+func (cfg *APIConfig) getWebhookDeliveries(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	query := r.URL.Query()
+	params := database.ListWebhookDeliveriesParams{
+		Status: sql.NullString{String: query.Get("status"), Valid: query.Get("status") != ""},
+		Limit:  DefaultWebhookDeliveriesLimit,
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxWebhookDeliveriesLimit {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(MaxWebhookDeliveriesLimit))
+			return
+		}
+		params.Limit = int32(limit)
+	}
+
+	subscription, ok := cfg.ownedWebhookSubscription(w, r, owner)
+	if !ok {
+		return
+	}
+	params.SubscriptionID = subscription.ID
+	deliveries, err := cfg.DB.ListWebhookDeliveries(r.Context(), params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deliveries == nil {
+		deliveries = []database.WebhookDelivery{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, deliveries)
+}
+
+// retryWebhookDelivery puts a dead-lettered delivery back in the outbox
+func (cfg *APIConfig) retryWebhookDelivery(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	deliveryID, err := uuid.Parse(r.PathValue("delivery_id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid delivery ID passed")
+		return
+	}
+	subscription, ok := cfg.ownedWebhookSubscription(w, r, owner)
+	if !ok {
+		return
+	}
+	delivery, err := cfg.DB.RetryWebhookDelivery(r.Context(), database.RetryWebhookDeliveryParams{
+		ID:             deliveryID,
+		SubscriptionID: subscription.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusConflict, "only dead deliveries of this subscription can be retried")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, delivery)
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/utils"
+	"github.com/maniac-en/chirpstack/internal/webhooks"
+)
+
+const (
+	// maxWebhookBodySize bounds what we read before the signature is checked
+	maxWebhookBodySize = 1 << 20
+
+	DefaultWebhookEventsLimit = 50
+	MaxWebhookEventsLimit     = 200
+)
+
+// statuses of rows in webhook_events
+const (
+	webhookStatusReceived  = "received"
+	webhookStatusProcessed = "processed"
+	webhookStatusIgnored   = "ignored"
+	webhookStatusFailed    = "failed"
+)
+
+var errWebhookUserNotFound = errors.New("user not found")
+
+// HandleWebhook receives webhooks from any provider in the registry. Every
+// verified delivery is logged to webhook_events, and deliveries with an
+// event ID that were already processed are acknowledged without being
+// applied twice.
+func (cfg *APIConfig) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.Webhooks.Lookup(r.PathValue("provider"))
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "unknown webhook provider")
+		return
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// signatures cover the raw body, verify before parsing anything
+	if err := provider.Verifier.Verify(r.Header, data); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	event, parseErr := provider.ParseEvent(data)
+	if parseErr != nil {
+		event = webhooks.Event{}
+	}
+
+	// events without an ID are logged with a NULL event_id, which never
+	// conflicts, as the same body twice may be a real repeat of an event
+	eventID := sql.NullString{String: event.ID, Valid: event.ID != ""}
+	record, err := cfg.DB.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+		Provider:  provider.Name,
+		EventID:   eventID,
+		EventType: event.Type,
+		Payload:   string(data),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.respondToDuplicateWebhook(w, r, provider.Name, eventID)
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	status, processErr := webhookStatusFailed, parseErr
+	if parseErr == nil {
+		status, processErr = cfg.processWebhookEvent(r.Context(), provider.Name, event)
+	}
+	cfg.finishWebhookEvent(r.Context(), record.ID, status, processErr)
+
+	switch {
+	case processErr == nil:
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	case errors.Is(processErr, errWebhookUserNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, processErr.Error())
+	case errors.Is(processErr, errWebhookInvalidPayload):
+		utils.RespondWithError(w, http.StatusBadRequest, processErr.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+	}
+}
+
+// respondToDuplicateWebhook answers a retry of a delivery we already have.
+// One we handled is acknowledged, one still being processed is refused so
+// the provider retries it, in case that attempt never finishes.
+func (cfg *APIConfig) respondToDuplicateWebhook(w http.ResponseWriter, r *http.Request, providerName string, eventID sql.NullString) {
+	status, err := cfg.DB.GetWebhookEventStatus(r.Context(), database.GetWebhookEventStatusParams{
+		Provider: providerName,
+		EventID:  eventID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if status == webhookStatusReceived {
+		utils.RespondWithError(w, http.StatusConflict, "event is already being processed")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// UpgradeUser is the original Polka endpoint, kept for Polka's sake
+func (cfg *APIConfig) UpgradeUser(w http.ResponseWriter, r *http.Request) {
+	r.SetPathValue("provider", "polka")
+	cfg.HandleWebhook(w, r)
+}
+
+// processWebhookEvent applies an event and returns the status to log it with
+func (cfg *APIConfig) processWebhookEvent(ctx context.Context, providerName string, event webhooks.Event) (string, error) {
+	if !isSubscriptionEvent(event.Type) {
+		// acknowledge events we don't handle so providers don't retry them
+		log.Printf("ignoring %s webhook event %q", providerName, event.Type)
+		return webhookStatusIgnored, nil
+	}
+	if err := cfg.processSubscriptionEvent(ctx, event); err != nil {
+		return webhookStatusFailed, err
+	}
+	return webhookStatusProcessed, nil
+}
+
+func (cfg *APIConfig) finishWebhookEvent(ctx context.Context, id uuid.UUID, status string, processErr error) (database.WebhookEvent, error) {
+	var errMessage string
+	if processErr != nil {
+		errMessage = processErr.Error()
+	}
+	record, err := cfg.DB.FinishWebhookEvent(ctx, database.FinishWebhookEventParams{
+		Status: status,
+		Error:  errMessage,
+		ID:     id,
+	})
+	if err != nil {
+		log.Printf("recording outcome of webhook event %s: %v", id, err)
+	}
+	return record, err
+}
+
+func (cfg *APIConfig) GetWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.authorizeAdmin(r); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.ListWebhookEventsParams{
+		Status:   sql.NullString{String: query.Get("status"), Valid: query.Get("status") != ""},
+		Provider: sql.NullString{String: query.Get("provider"), Valid: query.Get("provider") != ""},
+		Limit:    DefaultWebhookEventsLimit,
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxWebhookEventsLimit {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(MaxWebhookEventsLimit))
+			return
+		}
+		params.Limit = int32(limit)
+	}
+
+	events, err := cfg.DB.ListWebhookEvents(r.Context(), params)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if events == nil {
+		events = []database.WebhookEvent{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, events)
+}
+
+func (cfg *APIConfig) GetWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.authorizeAdmin(r); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	eventID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid event ID passed")
+		return
+	}
+	event, err := cfg.DB.GetWebhookEvent(r.Context(), eventID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No webhook event found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, event)
+}
+
+// ReplayWebhookEvent processes a failed event again from its stored payload,
+// or one left received by a crash. The payload was verified when it
+// arrived, so it isn't verified again.
+func (cfg *APIConfig) ReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.authorizeAdmin(r); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	eventID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid event ID passed")
+		return
+	}
+	record, err := cfg.DB.ClaimWebhookEventForReplay(r.Context(), eventID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		if _, err := cfg.DB.GetWebhookEvent(r.Context(), eventID); errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "No webhook event found")
+			return
+		}
+		utils.RespondWithError(w, http.StatusConflict, "only failed or abandoned webhook events can be replayed")
+		return
+	}
+
+	status, processErr := webhookStatusFailed, error(errors.New("webhook provider no longer configured"))
+	if provider, ok := cfg.Webhooks.Lookup(record.Provider); ok {
+		var event webhooks.Event
+		event, processErr = provider.ParseEvent([]byte(record.Payload))
+		if processErr == nil {
+			status, processErr = cfg.processWebhookEvent(r.Context(), provider.Name, event)
+		}
+	}
+	record, err = cfg.finishWebhookEvent(r.Context(), record.ID, status, processErr)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, record)
+}
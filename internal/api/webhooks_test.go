@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/webhooks"
+)
+
+// webhookEventRow is a webhook_events row as the fakeDB returns it
+func webhookEventRow(args []driver.Value, status string) []driver.Value {
+	now := time.Now()
+	return []driver.Value{uuid.NewString(), now, now, args[0], args[1], args[2], args[3], status, "", int64(0), nil}
+}
+
+// loggingWebhookQueries answers the queries logging a new delivery
+func loggingWebhookQueries() map[string]fakeQuery {
+	return map[string]fakeQuery{
+		"CreateWebhookEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{webhookEventRow(args, webhookStatusReceived)}, nil
+		},
+		"FinishWebhookEvent": func(args []driver.Value) ([][]driver.Value, error) {
+			return [][]driver.Value{webhookEventRow([]driver.Value{"", nil, "", ""}, args[0].(string))}, nil
+		},
+	}
+}
+
+func TestAPIConfig_HandleWebhook(t *testing.T) {
+	cfg, _ := testAPIConfig(t, loggingWebhookQueries())
+	cfg.Webhooks = webhooks.NewRegistry(
+		webhooks.Provider{
+			Name:     "polka",
+			Verifier: webhooks.SharedSecretVerifier{Header: "Authorization", Scheme: "ApiKey", Secret: "polka-key"},
+		},
+		webhooks.Provider{
+			Name:     "acme",
+			Verifier: webhooks.HMACVerifier{Secret: "whsec"},
+		},
+	)
+	ignoredEvent := `{"event":"user.deleted","data":{"user_id":"123e4567-e89b-12d3-a456-426614174000"}}`
+
+	tests := []struct {
+		name           string
+		provider       string
+		headers        map[string]string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "unknown provider",
+			provider:       "nope",
+			body:           ignoredEvent,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "polka wrong key",
+			provider:       "polka",
+			headers:        map[string]string{"Authorization": "ApiKey wrong"},
+			body:           ignoredEvent,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "missing/invalid API key",
+		},
+		{
+			name:           "polka ignored event",
+			provider:       "polka",
+			headers:        map[string]string{"Authorization": "ApiKey polka-key"},
+			body:           ignoredEvent,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "hmac missing signature",
+			provider:       "acme",
+			body:           ignoredEvent,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "missing signature",
+		},
+		{
+			name:           "hmac stale signature",
+			provider:       "acme",
+			headers:        map[string]string{webhooks.DefaultSignatureHeader: webhooks.Sign("whsec", time.Now().Add(-time.Hour), []byte(ignoredEvent))},
+			body:           ignoredEvent,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "timestamp outside tolerance",
+		},
+		{
+			name:           "hmac ignored event",
+			provider:       "acme",
+			headers:        map[string]string{webhooks.DefaultSignatureHeader: webhooks.Sign("whsec", time.Now(), []byte(ignoredEvent))},
+			body:           ignoredEvent,
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/webhooks/"+tt.provider, strings.NewReader(tt.body))
+			req.SetPathValue("provider", tt.provider)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			cfg.HandleWebhook(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedError != "" && !strings.Contains(w.Body.String(), tt.expectedError) {
+				t.Errorf("Expected error %q, got %s", tt.expectedError, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIConfig_HandleWebhook_Deduplication(t *testing.T) {
+	withID := `{"id":"evt_1","event":"user.deleted","data":{"user_id":"123e4567-e89b-12d3-a456-426614174000"}}`
+	withoutID := `{"event":"user.deleted","data":{"user_id":"123e4567-e89b-12d3-a456-426614174000"}}`
+
+	tests := []struct {
+		name           string
+		body           string
+		existingStatus string // status of the earlier delivery, "" when there is none
+		expectedStatus int
+		expectedCalls  []string
+	}{
+		{
+			name:           "new event",
+			body:           withID,
+			expectedStatus: http.StatusNoContent,
+			expectedCalls:  []string{"CreateWebhookEvent", "FinishWebhookEvent"},
+		},
+		{
+			name:           "retry of a processed event",
+			body:           withID,
+			existingStatus: webhookStatusProcessed,
+			expectedStatus: http.StatusNoContent,
+			expectedCalls:  []string{"CreateWebhookEvent", "GetWebhookEventStatus"},
+		},
+		{
+			name:           "retry of an event still being processed",
+			body:           withID,
+			existingStatus: webhookStatusReceived,
+			expectedStatus: http.StatusConflict,
+			expectedCalls:  []string{"CreateWebhookEvent", "GetWebhookEventStatus"},
+		},
+		{
+			// the same body again may be a real repeat, so it's never a duplicate
+			name:           "event without an ID",
+			body:           withoutID,
+			existingStatus: webhookStatusProcessed,
+			expectedStatus: http.StatusNoContent,
+			expectedCalls:  []string{"CreateWebhookEvent", "FinishWebhookEvent"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := loggingWebhookQueries()
+			queries["CreateWebhookEvent"] = func(args []driver.Value) ([][]driver.Value, error) {
+				// NULL event IDs never conflict
+				if tt.existingStatus != "" && args[1] != nil {
+					return nil, nil
+				}
+				return [][]driver.Value{webhookEventRow(args, webhookStatusReceived)}, nil
+			}
+			queries["GetWebhookEventStatus"] = func([]driver.Value) ([][]driver.Value, error) {
+				return [][]driver.Value{{tt.existingStatus}}, nil
+			}
+			cfg, db := testAPIConfig(t, queries)
+			cfg.Webhooks = webhooks.NewRegistry(webhooks.Provider{
+				Name:     "polka",
+				Verifier: webhooks.SharedSecretVerifier{Header: "Authorization", Scheme: "ApiKey", Secret: "polka-key"},
+			})
+
+			req := httptest.NewRequest("POST", "/api/webhooks/polka", strings.NewReader(tt.body))
+			req.SetPathValue("provider", "polka")
+			req.Header.Set("Authorization", "ApiKey polka-key")
+			w := httptest.NewRecorder()
+			cfg.HandleWebhook(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+			if got := strings.Join(db.called(), ","); got != strings.Join(tt.expectedCalls, ",") {
+				t.Errorf("queries = %s, want %s", got, strings.Join(tt.expectedCalls, ","))
+			}
+		})
+	}
+}
+
+func TestAPIConfig_ProcessWebhookEvent_IgnoresUnknownEvents(t *testing.T) {
+	cfg := &APIConfig{}
+	status, err := cfg.processWebhookEvent(context.Background(), "polka", webhooks.Event{ID: "evt_1", Type: "user.deleted"})
+	if err != nil || status != webhookStatusIgnored {
+		t.Errorf("processWebhookEvent() = %q, %v, want %q, nil", status, err, webhookStatusIgnored)
+	}
+}
+
+func TestAPIConfig_AdminWebhookEndpoints_RequireAdminKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		adminAPIKey string
+		header      string
+	}{
+		{name: "no header", adminAPIKey: "admin-key"},
+		{name: "wrong key", adminAPIKey: "admin-key", header: "ApiKey wrong"},
+		{name: "bearer token", adminAPIKey: "admin-key", header: "Bearer admin-key"},
+		{name: "admin key not configured", adminAPIKey: "", header: "ApiKey "},
+	}
+	for _, tt := range tests {
+		cfg := &APIConfig{AdminAPIKey: tt.adminAPIKey}
+		handlers := map[string]http.HandlerFunc{
+			"list":   cfg.GetWebhookEvents,
+			"get":    cfg.GetWebhookEvent,
+			"replay": cfg.ReplayWebhookEvent,
+		}
+		for name, handler := range handlers {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				req := httptest.NewRequest("GET", "/admin/webhooks", nil)
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+				w := httptest.NewRecorder()
+				handler(w, req)
+
+				if w.Code != http.StatusUnauthorized {
+					t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+				}
+			})
+		}
+	}
+}
@@ -4,9 +4,11 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -20,6 +22,73 @@ const (
 	ErrIncorrectEmailOrPassword string = "incorrect email or password"
 )
 
+// Scope is a permission a user grants to a third-party client
+type Scope string
+
+const (
+	ScopeChirpsRead   Scope = "chirps:read"
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeProfileRead  Scope = "profile:read"
+	ScopeProfileWrite Scope = "profile:write"
+	ScopeFollowsWrite Scope = "follows:write"
+)
+
+func ValidScopes() []Scope {
+	return []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileRead, ScopeProfileWrite, ScopeFollowsWrite}
+}
+
+func (s Scope) IsValid() bool {
+	return slices.Contains(ValidScopes(), s)
+}
+
+// ParseScopes parses a space-delimited scope list as used by OAuth2
+func ParseScopes(s string) ([]Scope, error) {
+	var scopes []Scope
+	for field := range strings.FieldsSeq(s) {
+		scope := Scope(field)
+		if !scope.IsValid() {
+			return nil, fmt.Errorf("invalid scope '%s', must be one of: %v", field, ValidScopes())
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// FormatScopes is the inverse of ParseScopes
+func FormatScopes(scopes []Scope) string {
+	fields := make([]string, len(scopes))
+	for i, scope := range scopes {
+		fields[i] = string(scope)
+	}
+	return strings.Join(fields, " ")
+}
+
+// AccessToken is a validated access token or API key. First-party tokens,
+// the ones handed out by LoginUser, have no client or key and carry every
+// permission.
+type AccessToken struct {
+	UserID   uuid.UUID
+	ClientID string
+	APIKeyID uuid.UUID
+	Scopes   []Scope
+}
+
+func (t AccessToken) IsFirstParty() bool {
+	return t.ClientID == "" && t.APIKeyID == uuid.Nil
+}
+
+func (t AccessToken) HasScope(scope Scope) bool {
+	return t.IsFirstParty() || slices.Contains(t.Scopes, scope)
+}
+
+type accessTokenClaims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -45,12 +114,29 @@ func CheckPasswordHash(password, hash string) error {
 }
 
 func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
+	return makeAccessToken(userID, "", nil, tokenSecret)
+}
+
+// MakeScopedJWT issues an access token for a third-party client acting on
+// behalf of a user, limited to the granted scopes
+func MakeScopedJWT(userID uuid.UUID, clientID string, scopes []Scope, tokenSecret string) (string, error) {
+	if clientID == "" {
+		return "", fmt.Errorf("scoped tokens need a client")
+	}
+	return makeAccessToken(userID, clientID, scopes, tokenSecret)
+}
+
+func makeAccessToken(userID uuid.UUID, clientID string, scopes []Scope, tokenSecret string) (string, error) {
 	now := time.Now().UTC()
-	claims := &jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
-		Subject:   userID.String(),
+	claims := &accessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			Subject:   userID.String(),
+		},
+		ClientID: clientID,
+		Scope:    FormatScopes(scopes),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -61,8 +147,21 @@ func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
 	return tokenString, nil
 }
 
+// ValidateJWT only accepts first-party tokens, use ParseAccessToken where
+// third-party clients are welcome
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
+	accessToken, err := ParseAccessToken(tokenString, tokenSecret)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	if !accessToken.IsFirstParty() {
+		return uuid.UUID{}, fmt.Errorf("third-party token not accepted")
+	}
+	return accessToken.UserID, nil
+}
+
+func ParseAccessToken(tokenString, tokenSecret string) (AccessToken, error) {
+	claims := &accessTokenClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
 		if token.Method != jwt.SigningMethodHS256 {
@@ -71,19 +170,28 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		return []byte(tokenSecret), nil
 	})
 	if err != nil {
-		return uuid.UUID{}, err
+		return AccessToken{}, err
 	}
 
 	if !token.Valid {
-		return uuid.UUID{}, fmt.Errorf("invalid token")
+		return AccessToken{}, fmt.Errorf("invalid token")
 	}
 
 	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("invalid user ID in token: %w", err)
+		return AccessToken{}, fmt.Errorf("invalid user ID in token: %w", err)
+	}
+
+	scopes, err := ParseScopes(claims.Scope)
+	if err != nil {
+		return AccessToken{}, fmt.Errorf("invalid scope in token: %w", err)
 	}
 
-	return userID, nil
+	return AccessToken{
+		UserID:   userID,
+		ClientID: claims.ClientID,
+		Scopes:   scopes,
+	}, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -121,3 +229,44 @@ func GetAPIKey(headers http.Header) (string, error) {
 	}
 	return authHeaderFields[1], nil
 }
+
+// APIKeyTag starts every personal API key so they are easy to tell apart
+// from JWTs and to spot in leaked logs or commits
+const APIKeyTag = "chirp_"
+
+// MakeAPIKey generates a personal API key of the form chirp_<prefix>_<secret>.
+// The prefix identifies the key and is safe to show, the whole key is only
+// ever stored hashed.
+func MakeAPIKey() (key string, prefix string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+	secret, err := MakeRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(prefixBytes)
+	return APIKeyTag + prefix + "_" + secret, prefix, nil
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyTag)
+}
+
+// ParseAPIKey returns the prefix of a well-formed API key
+func ParseAPIKey(key string) (string, error) {
+	prefix, secret, found := strings.Cut(strings.TrimPrefix(key, APIKeyTag), "_")
+	if !IsAPIKey(key) || !found || len(prefix) != 12 || len(secret) != 64 {
+		return "", fmt.Errorf("malformed API key")
+	}
+	return prefix, nil
+}
+
+// HashToken hashes high-entropy secrets such as client secrets, API keys and
+// authorization codes for storage, unlike passwords they don't need a slow
+// hash
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -341,3 +341,140 @@ func TestPasswordHashRoundTrip(t *testing.T) {
 		t.Errorf("Expected error %v, got %v", ErrIncorrectEmailOrPassword, err.Error())
 	}
 }
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Scope
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "single scope", input: "chirps:read", want: []Scope{ScopeChirpsRead}},
+		{name: "several scopes", input: "chirps:read  chirps:write", want: []Scope{ScopeChirpsRead, ScopeChirpsWrite}},
+		{name: "duplicates collapse", input: "chirps:read chirps:read", want: []Scope{ScopeChirpsRead}},
+		{name: "unknown scope", input: "chirps:read admin", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScopes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if FormatScopes(got) != FormatScopes(tt.want) {
+				t.Errorf("ParseScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopedJWT(t *testing.T) {
+	userID := uuid.New()
+	secret := "test-secret-key"
+
+	token, err := MakeScopedJWT(userID, "client-1", []Scope{ScopeChirpsRead}, secret)
+	if err != nil {
+		t.Fatalf("MakeScopedJWT() unexpected error = %v", err)
+	}
+
+	accessToken, err := ParseAccessToken(token, secret)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() unexpected error = %v", err)
+	}
+	if accessToken.UserID != userID || accessToken.ClientID != "client-1" || accessToken.IsFirstParty() {
+		t.Errorf("ParseAccessToken() = %+v, want a third-party token for %v", accessToken, userID)
+	}
+	if !accessToken.HasScope(ScopeChirpsRead) {
+		t.Error("HasScope(chirps:read) = false, want true")
+	}
+	if accessToken.HasScope(ScopeChirpsWrite) {
+		t.Error("HasScope(chirps:write) = true, want false")
+	}
+
+	// third-party tokens must not pass as first-party sessions
+	if _, err := ValidateJWT(token, secret); err == nil {
+		t.Error("ValidateJWT() accepted a third-party token")
+	}
+
+	if _, err := MakeScopedJWT(userID, "", []Scope{ScopeChirpsRead}, secret); err == nil {
+		t.Error("MakeScopedJWT() without a client expected error but got none")
+	}
+}
+
+func TestFirstPartyJWTHasEveryScope(t *testing.T) {
+	token, err := MakeJWT(uuid.New(), "test-secret-key")
+	if err != nil {
+		t.Fatalf("MakeJWT() unexpected error = %v", err)
+	}
+	accessToken, err := ParseAccessToken(token, "test-secret-key")
+	if err != nil {
+		t.Fatalf("ParseAccessToken() unexpected error = %v", err)
+	}
+	for _, scope := range ValidScopes() {
+		if !accessToken.HasScope(scope) {
+			t.Errorf("first-party token HasScope(%s) = false, want true", scope)
+		}
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	if HashToken("a") == HashToken("b") {
+		t.Error("HashToken() collides for different inputs")
+	}
+	if HashToken("a") != HashToken("a") {
+		t.Error("HashToken() is not deterministic")
+	}
+	if len(HashToken("a")) != 64 {
+		t.Errorf("HashToken() length = %d, want 64", len(HashToken("a")))
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key, prefix, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey() unexpected error = %v", err)
+	}
+	if !IsAPIKey(key) {
+		t.Errorf("IsAPIKey(%q) = false, want true", key)
+	}
+	got, err := ParseAPIKey(key)
+	if err != nil {
+		t.Fatalf("ParseAPIKey() unexpected error = %v", err)
+	}
+	if got != prefix {
+		t.Errorf("ParseAPIKey() = %q, want %q", got, prefix)
+	}
+
+	other, otherPrefix, _ := MakeAPIKey()
+	if other == key || otherPrefix == prefix {
+		t.Error("MakeAPIKey() returned the same key twice")
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "jwt", key: "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.e30.sig"},
+		{name: "tag only", key: "chirp_"},
+		{name: "no secret", key: "chirp_0123456789ab"},
+		{name: "short prefix", key: "chirp_0123_" + strings.Repeat("a", 64)},
+		{name: "short secret", key: "chirp_0123456789ab_abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseAPIKey(tt.key); err == nil {
+				t.Errorf("ParseAPIKey(%q) expected error but got none", tt.key)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAccessTokenIsNotFirstParty(t *testing.T) {
+	accessToken := AccessToken{UserID: uuid.New(), APIKeyID: uuid.New(), Scopes: ValidScopes()}
+	if accessToken.IsFirstParty() {
+		t.Error("IsFirstParty() = true for an API key, want false")
+	}
+}
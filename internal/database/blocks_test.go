@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestBlocks checks what a block takes away between two users besides
+// their chirps, which TestChirpVisibleTo covers
+func TestBlocks(t *testing.T) {
+	q := testQueries(t)
+	ctx := t.Context()
+
+	createUser := func(email, handle string) uuid.UUID {
+		t.Helper()
+		user, err := q.CreateUser(ctx, CreateUserParams{Email: email, HashedPassword: "unused"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.UpdateUser(ctx, UpdateUserParams{ID: user.ID, Handle: sql.NullString{String: handle, Valid: true}}); err != nil {
+			t.Fatal(err)
+		}
+		return user.ID
+	}
+	blocker := createUser("blocker@example.com", "blocker")
+	blocked := createUser("blocked@example.com", "blocked")
+	bystander := createUser("bystander@example.com", "bystander")
+
+	for _, follow := range []FollowUserParams{
+		{FollowerID: blocker, FolloweeID: blocked},
+		{FollowerID: blocked, FolloweeID: blocker},
+		{FollowerID: bystander, FolloweeID: blocker},
+	} {
+		if _, err := q.FollowUser(ctx, follow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notify := func(userID, actorID uuid.UUID) error {
+		_, err := q.CreateNotification(ctx, CreateNotificationParams{
+			UserID:  userID,
+			ActorID: actorID,
+			Type:    "follow",
+			EventID: uuid.New(),
+		})
+		return err
+	}
+	if err := notify(blocker, blocked); err != nil {
+		t.Fatal(err)
+	}
+
+	// what BlockUser does
+	if _, err := q.BlockUser(ctx, BlockUserParams{BlockerID: blocker, BlockedID: blocked}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.DeleteFollowsBetween(ctx, DeleteFollowsBetweenParams{UserID: blocker, OtherID: blocked}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("follows", func(t *testing.T) {
+		for _, follow := range []IsFollowingParams{
+			{FollowerID: blocker, FolloweeID: blocked},
+			{FollowerID: blocked, FolloweeID: blocker},
+		} {
+			if following, err := q.IsFollowing(ctx, follow); err != nil || following {
+				t.Errorf("IsFollowing(%+v) = %v, %v, want the follow removed", follow, following, err)
+			}
+		}
+		followerIDs, err := q.GetTimelineFollowerIDs(ctx, blocker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(followerIDs, []uuid.UUID{bystander}) {
+			t.Errorf("GetTimelineFollowerIDs() = %v, want only the bystander", followerIDs)
+		}
+	})
+
+	t.Run("mentions", func(t *testing.T) {
+		for authorID, handle := range map[uuid.UUID]string{blocker: "blocked", blocked: "blocker"} {
+			userIDs, err := q.GetUserIDsByHandles(ctx, GetUserIDsByHandlesParams{
+				Handles:  []string{handle, "bystander"},
+				AuthorID: authorID,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(userIDs, []uuid.UUID{bystander}) {
+				t.Errorf("GetUserIDsByHandles(@%s, @bystander) = %v, want only the bystander", handle, userIDs)
+			}
+		}
+	})
+
+	t.Run("notifications", func(t *testing.T) {
+		for _, users := range [][2]uuid.UUID{{blocker, blocked}, {blocked, blocker}} {
+			if err := notify(users[0], users[1]); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("CreateNotification() error = %v, want no notification", err)
+			}
+		}
+		if err := notify(blocker, bystander); err != nil {
+			t.Errorf("CreateNotification() from the bystander error = %v", err)
+		}
+
+		// the one from before the block is hidden, not deleted
+		notifications, err := q.ListNotifications(ctx, ListNotificationsParams{UserID: blocker, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(notifications) != 1 || notifications[0].ActorID != bystander {
+			t.Errorf("ListNotifications() = %+v, want only the bystander's", notifications)
+		}
+		if unread, err := q.CountUnreadNotifications(ctx, blocker); err != nil || unread != 1 {
+			t.Errorf("CountUnreadNotifications() = %d, %v, want 1", unread, err)
+		}
+		if unread, err := q.ListUnreadNotificationChirps(ctx, blocker); err != nil || len(unread) != 1 {
+			t.Errorf("ListUnreadNotificationChirps() = %+v, %v, want only the bystander's", unread, err)
+		}
+	})
+
+	t.Run("live updates", func(t *testing.T) {
+		for userID, want := range map[uuid.UUID][]uuid.UUID{blocker: {blocked}, blocked: {blocker}, bystander: nil} {
+			got, err := q.ListUserIDsBlockedEitherWay(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("ListUserIDsBlockedEitherWay() = %v, want %v", got, want)
+			}
+		}
+	})
+}
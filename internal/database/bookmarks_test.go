@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBookmarks(t *testing.T) {
+	q := testQueries(t)
+	ctx := t.Context()
+
+	user, err := q.CreateUser(ctx, CreateUserParams{Email: "reader@example.com", HashedPassword: "unused"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := q.CreateBookmarkCollection(ctx, CreateBookmarkCollectionParams{UserID: user.ID, Name: "later"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chirpIDs []uuid.UUID
+	for i := range 5 {
+		chirp, err := q.CreateChirp(ctx, CreateChirpParams{
+			Body:         "chirp",
+			UserID:       uuid.NullUUID{UUID: user.ID, Valid: true},
+			Status:       "published",
+			Visibility:   "public",
+			MentionedIds: []uuid.UUID{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmark := CreateBookmarkParams{UserID: user.ID, ChirpID: chirp.ID}
+		if i%2 == 0 {
+			bookmark.CollectionID = uuid.NullUUID{UUID: collection.ID, Valid: true}
+		}
+		if err := q.CreateBookmark(ctx, bookmark); err != nil {
+			t.Fatal(err)
+		}
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+
+	// pages through every bookmark, newest first, from the cursor values of
+	// the last one of each page
+	list := func(params ListBookmarksParams) []uuid.UUID {
+		t.Helper()
+		var listed []uuid.UUID
+		for {
+			rows, err := q.ListBookmarks(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) == 0 {
+				return listed
+			}
+			for _, row := range rows {
+				listed = append(listed, row.Chirp.ID)
+			}
+			last := rows[len(rows)-1]
+			params.BeforeCreatedAt = sql.NullTime{Time: last.BookmarkedAt, Valid: true}
+			params.BeforeChirpID = uuid.NullUUID{UUID: last.Chirp.ID, Valid: true}
+		}
+	}
+	// made in one transaction, they were all bookmarked at the same NOW()
+	// and are ordered by chirp ID
+	want := slices.Clone(chirpIDs)
+	slices.SortFunc(want, func(a, b uuid.UUID) int { return slices.Compare(b[:], a[:]) })
+
+	t.Run("pages", func(t *testing.T) {
+		if got := list(ListBookmarksParams{UserID: user.ID, Limit: 2}); !slices.Equal(got, want) {
+			t.Errorf("ListBookmarks() pages = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("cursor of a deleted bookmark", func(t *testing.T) {
+		rows, err := q.ListBookmarks(ctx, ListBookmarksParams{UserID: user.ID, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := rows[len(rows)-1]
+		if _, err := q.DeleteBookmark(ctx, DeleteBookmarkParams{UserID: user.ID, ChirpID: last.Chirp.ID}); err != nil {
+			t.Fatal(err)
+		}
+		rows, err = q.ListBookmarks(ctx, ListBookmarksParams{
+			UserID:          user.ID,
+			BeforeCreatedAt: sql.NullTime{Time: last.BookmarkedAt, Valid: true},
+			BeforeChirpID:   uuid.NullUUID{UUID: last.Chirp.ID, Valid: true},
+			Limit:           10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 {
+			t.Errorf("ListBookmarks() after the deleted cursor got %d bookmarks, want 3", len(rows))
+		}
+		if err := q.CreateBookmark(ctx, CreateBookmarkParams{UserID: user.ID, ChirpID: last.Chirp.ID, CollectionID: last.CollectionID}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("collections", func(t *testing.T) {
+		inCollection := ListBookmarksParams{
+			UserID:       user.ID,
+			CollectionID: uuid.NullUUID{UUID: collection.ID, Valid: true},
+			Limit:        2,
+		}
+		var wantFiled []uuid.UUID
+		for _, id := range want {
+			if i := slices.Index(chirpIDs, id); i%2 == 0 {
+				wantFiled = append(wantFiled, id)
+			}
+		}
+		if got := list(inCollection); !slices.Equal(got, wantFiled) {
+			t.Errorf("ListBookmarks() in the collection = %v, want %v", got, wantFiled)
+		}
+
+		// deleting the collection keeps its bookmarks, unfiled
+		if _, err := q.DeleteBookmarkCollection(ctx, DeleteBookmarkCollectionParams{ID: collection.ID, UserID: user.ID}); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := q.ListBookmarks(ctx, ListBookmarksParams{UserID: user.ID, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != len(chirpIDs) {
+			t.Errorf("ListBookmarks() after deleting the collection got %d bookmarks, want %d", len(rows), len(chirpIDs))
+		}
+		for _, row := range rows {
+			if row.CollectionID.Valid {
+				t.Errorf("bookmark of %s is still in collection %s", row.Chirp.ID, row.CollectionID.UUID)
+			}
+		}
+	})
+}
@@ -7,29 +7,49 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
 `
 
 type CreateChirpParams struct {
-	Body   string        `json:"body"`
-	UserID uuid.NullUUID `json:"user_id"`
+	Body         string        `json:"body"`
+	UserID       uuid.NullUUID `json:"user_id"`
+	ReplyToID    uuid.NullUUID `json:"reply_to_id"`
+	Status       string        `json:"status"`
+	PublishAt    sql.NullTime  `json:"publish_at"`
+	Visibility   string        `json:"visibility"`
+	MentionedIds []uuid.UUID   `json:"mentioned_ids"`
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ReplyToID,
+		arg.Status,
+		arg.PublishAt,
+		arg.Visibility,
+		pq.Array(arg.MentionedIds),
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +57,11 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+		&i.Status,
+		&i.PublishAt,
+		&i.Visibility,
+		pq.Array(&i.MentionedIds),
 	)
 	return i, err
 }
@@ -44,6 +69,11 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 const deleteChirpByID = `-- name: DeleteChirpByID :exec
 DELETE FROM chirps
 WHERE id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id
+    AND users.deleted_at IS NOT NULL
+)
 `
 
 func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
@@ -51,14 +81,54 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteScheduledChirp = `-- name: DeleteScheduledChirp :one
+DELETE FROM chirps
+WHERE id = $1
+AND user_id = $2
+AND status = 'scheduled'
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
+`
+
+type DeleteScheduledChirpParams struct {
+	ID     uuid.UUID     `json:"id"`
+	UserID uuid.NullUUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteScheduledChirp(ctx context.Context, arg DeleteScheduledChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, deleteScheduledChirp, arg.ID, arg.UserID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ReplyToID,
+		&i.Status,
+		&i.PublishAt,
+		&i.Visibility,
+		pq.Array(&i.MentionedIds),
+	)
+	return i, err
+}
+
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
 FROM chirps
 WHERE id = $1
+AND status = 'published'
+AND chirp_visible_to(chirps.user_id, chirps.visibility, chirps.mentioned_ids, $2)
 `
 
-func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirpByID, id)
+type GetChirpByIDParams struct {
+	ID       uuid.UUID     `json:"id"`
+	ViewerID uuid.NullUUID `json:"viewer_id"`
+}
+
+// Visibility and blocks as for GetChirps, muted users' chirps are still
+// shown when asked for
+func (q *Queries) GetChirpByID(ctx context.Context, arg GetChirpByIDParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByID, arg.ID, arg.ViewerID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -66,18 +136,34 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+		&i.Status,
+		&i.PublishAt,
+		&i.Visibility,
+		pq.Array(&i.MentionedIds),
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
 FROM chirps
+WHERE status = 'published'
+AND chirp_visible_to(chirps.user_id, chirps.visibility, chirps.mentioned_ids, $1)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $1
+    AND mutes.muted_id = chirps.user_id
+)
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+// Only chirps viewer_id may see, as chirp_visible_to decides: public ones,
+// their own, the ones mentioning them and followers-only ones of users they
+// follow, none by users they blocked or who blocked them. Chirps by users they muted are
+// left out too. Without a viewer_id only public chirps are returned.
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +177,11 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
+			&i.Status,
+			&i.PublishAt,
+			&i.Visibility,
+			pq.Array(&i.MentionedIds),
 		); err != nil {
 			return nil, err
 		}
@@ -106,14 +197,23 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByAuthorID = `-- name: GetChirpsByAuthorID :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
 FROM chirps
 WHERE user_id = $1
+AND status = 'published'
+AND chirp_visible_to(chirps.user_id, chirps.visibility, chirps.mentioned_ids, $2)
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorID, userID)
+type GetChirpsByAuthorIDParams struct {
+	UserID   uuid.NullUUID `json:"user_id"`
+	ViewerID uuid.NullUUID `json:"viewer_id"`
+}
+
+// Visibility and blocks as for GetChirps, muted users' chirps are still
+// shown when asked for
+func (q *Queries) GetChirpsByAuthorID(ctx context.Context, arg GetChirpsByAuthorIDParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorID, arg.UserID, arg.ViewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -127,6 +227,11 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.NullUUID)
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
+			&i.Status,
+			&i.PublishAt,
+			&i.Visibility,
+			pq.Array(&i.MentionedIds),
 		); err != nil {
 			return nil, err
 		}
@@ -140,3 +245,133 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.NullUUID)
 	}
 	return items, nil
 }
+
+const listScheduledChirpsByAuthor = `-- name: ListScheduledChirpsByAuthor :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at FROM chirps
+WHERE user_id = $1
+AND status = 'scheduled'
+ORDER BY publish_at ASC
+`
+
+func (q *Queries) ListScheduledChirpsByAuthor(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduledChirpsByAuthor, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.Status,
+			&i.PublishAt,
+			&i.Visibility,
+			pq.Array(&i.MentionedIds),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET status = 'published',
+    created_at = publish_at,
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM chirps
+    WHERE status = 'scheduled'
+    AND publish_at <= NOW()
+    AND NOT EXISTS (
+        SELECT 1 FROM users
+        WHERE users.id = chirps.user_id
+        AND users.deleted_at IS NOT NULL
+    )
+    ORDER BY publish_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
+`
+
+// Locked rows are skipped, so instances running this at the same time each
+// publish different chirps. Chirps of deleted accounts wait until the
+// account is restored or purged.
+func (q *Queries) PublishDueChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.Status,
+			&i.PublishAt,
+			&i.Visibility,
+			pq.Array(&i.MentionedIds),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $1, mentioned_ids = $2, updated_at = NOW()
+WHERE id = $3
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
+`
+
+type UpdateChirpParams struct {
+	Body         string      `json:"body"`
+	MentionedIds []uuid.UUID `json:"mentioned_ids"`
+	ID           uuid.UUID   `json:"id"`
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.Body, pq.Array(arg.MentionedIds), arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ReplyToID,
+		&i.Status,
+		&i.PublishAt,
+		&i.Visibility,
+		pq.Array(&i.MentionedIds),
+	)
+	return i, err
+}
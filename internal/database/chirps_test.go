@@ -0,0 +1,154 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestChirpVisibleTo checks who the chirp read queries show chirps to, as
+// chirp_visible_to decides
+func TestChirpVisibleTo(t *testing.T) {
+	q := testQueries(t)
+	ctx := t.Context()
+
+	createUser := func(email string) uuid.UUID {
+		t.Helper()
+		user, err := q.CreateUser(ctx, CreateUserParams{Email: email, HashedPassword: "unused"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.ID
+	}
+	author := createUser("author@example.com")
+	follower := createUser("follower@example.com")
+	mentioned := createUser("mentioned@example.com")
+	stranger := createUser("stranger@example.com")
+	blocked := createUser("blocked@example.com")
+	blocker := createUser("blocker@example.com")
+	deleted := createUser("deleted@example.com")
+
+	for _, followerID := range []uuid.UUID{follower, blocked, blocker} {
+		if _, err := q.FollowUser(ctx, FollowUserParams{FollowerID: followerID, FolloweeID: author}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := q.FollowUser(ctx, FollowUserParams{FollowerID: follower, FolloweeID: deleted}); err != nil {
+		t.Fatal(err)
+	}
+
+	createChirp := func(authorID uuid.UUID, visibility string, mentionedIDs ...uuid.UUID) uuid.UUID {
+		t.Helper()
+		chirp, err := q.CreateChirp(ctx, CreateChirpParams{
+			Body:         visibility,
+			UserID:       uuid.NullUUID{UUID: authorID, Valid: true},
+			Status:       "published",
+			Visibility:   visibility,
+			MentionedIds: append([]uuid.UUID{}, mentionedIDs...),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chirp.ID
+	}
+	public := createChirp(author, "public")
+	followersOnly := createChirp(author, "followers")
+	mentionedOnly := createChirp(author, "mentioned", mentioned, blocked)
+	deletedAuthors := createChirp(deleted, "public")
+
+	// blocks made after the chirps, mentions included, still hide them
+	if _, err := q.BlockUser(ctx, BlockUserParams{BlockerID: author, BlockedID: blocked}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.BlockUser(ctx, BlockUserParams{BlockerID: blocker, BlockedID: author}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.SoftDeleteUser(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		viewerID uuid.NullUUID
+		want     []uuid.UUID
+	}{
+		{name: "anonymous", want: []uuid.UUID{public}},
+		{name: "author", viewerID: uuid.NullUUID{UUID: author, Valid: true}, want: []uuid.UUID{public, followersOnly, mentionedOnly}},
+		{name: "follower", viewerID: uuid.NullUUID{UUID: follower, Valid: true}, want: []uuid.UUID{public, followersOnly}},
+		{name: "mentioned", viewerID: uuid.NullUUID{UUID: mentioned, Valid: true}, want: []uuid.UUID{public, mentionedOnly}},
+		{name: "stranger", viewerID: uuid.NullUUID{UUID: stranger, Valid: true}, want: []uuid.UUID{public}},
+		{name: "blocked by author", viewerID: uuid.NullUUID{UUID: blocked, Valid: true}},
+		{name: "blocking author", viewerID: uuid.NullUUID{UUID: blocker, Valid: true}},
+	}
+	all := []uuid.UUID{public, followersOnly, mentionedOnly, deletedAuthors}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var byID []uuid.UUID
+			for _, id := range all {
+				chirp, err := q.GetChirpByID(ctx, GetChirpByIDParams{ID: id, ViewerID: tt.viewerID})
+				if errors.Is(err, sql.ErrNoRows) {
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				byID = append(byID, chirp.ID)
+			}
+			assertChirpIDs(t, "GetChirpByID", byID, tt.want)
+
+			chirps, err := q.GetChirps(ctx, tt.viewerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertChirpIDs(t, "GetChirps", chirpIDs(chirps), tt.want)
+
+			chirps, err = q.GetChirpsByAuthorID(ctx, GetChirpsByAuthorIDParams{UserID: uuid.NullUUID{UUID: author, Valid: true}, ViewerID: tt.viewerID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertChirpIDs(t, "GetChirpsByAuthorID", chirpIDs(chirps), tt.want)
+
+			if !tt.viewerID.Valid {
+				return
+			}
+			for _, id := range all {
+				if err := q.CreateBookmark(ctx, CreateBookmarkParams{UserID: tt.viewerID.UUID, ChirpID: id}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bookmarks, err := q.ListBookmarks(ctx, ListBookmarksParams{UserID: tt.viewerID.UUID, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bookmarked []uuid.UUID
+			for _, bookmark := range bookmarks {
+				bookmarked = append(bookmarked, bookmark.Chirp.ID)
+			}
+			assertChirpIDs(t, "ListBookmarks", bookmarked, tt.want)
+		})
+	}
+}
+
+func chirpIDs(chirps []Chirp) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	return ids
+}
+
+// assertChirpIDs compares got and want in any order
+func assertChirpIDs(t *testing.T, query string, got, want []uuid.UUID) {
+	t.Helper()
+	sortIDs := func(ids []uuid.UUID) []uuid.UUID {
+		ids = slices.Clone(ids)
+		slices.SortFunc(ids, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+		return ids
+	}
+	if !slices.Equal(sortIDs(got), sortIDs(want)) {
+		t.Errorf("%s = %v, want %v", query, got, want)
+	}
+}
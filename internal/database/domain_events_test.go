@@ -0,0 +1,73 @@
+package database
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDomainEvents(t *testing.T) {
+	q := testQueries(t)
+	ctx := t.Context()
+
+	event, err := q.CreateDomainEvent(ctx, CreateDomainEventParams{EventType: "chirp.created", UserID: uuid.New(), Payload: "{}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// claim returns the handlers a failed attempt recorded
+	claim := func() DomainEvent {
+		t.Helper()
+		claimed, err := q.ClaimDomainEvents(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range claimed {
+			if e.ID == event.ID {
+				return e
+			}
+		}
+		t.Fatalf("ClaimDomainEvents() = %v, want %s", claimed, event.ID)
+		return DomainEvent{}
+	}
+	if got := claim(); len(got.HandledBy) != 0 || got.Attempts != 1 {
+		t.Errorf("first claim = %+v, want no handlers and one attempt", got)
+	}
+	// NOW() is when the transaction started, so the retry is due before it
+	if err := q.FailDomainEvent(ctx, FailDomainEventParams{
+		Status:      "pending",
+		LastError:   "notifications: unavailable",
+		AvailableAt: time.Now().UTC().Add(-time.Hour),
+		HandledBy:   []string{"stream", "gateway"},
+		ID:          event.ID,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := claim(); !slices.Equal(got.HandledBy, []string{"stream", "gateway"}) || got.Attempts != 2 {
+		t.Errorf("retry = %+v, want the handled ones kept and two attempts", got)
+	}
+
+	// only published events past the cutoff are deleted
+	pending, err := q.CreateDomainEvent(ctx, CreateDomainEventParams{EventType: "chirp.created", UserID: uuid.New(), Payload: "{}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.MarkDomainEventPublished(ctx, event.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := q.DeletePublishedDomainEventsBefore(ctx, time.Now().UTC().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("DeletePublishedDomainEventsBefore(an hour ago) = %d, %v, want nothing deleted", n, err)
+	}
+	if n, err := q.DeletePublishedDomainEventsBefore(ctx, time.Now().UTC().Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("DeletePublishedDomainEventsBefore(in an hour) = %d, %v, want the published event deleted", n, err)
+	}
+	claimed, err := q.ClaimDomainEvents(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != pending.ID {
+		t.Errorf("ClaimDomainEvents() = %v, want the pending event kept", claimed)
+	}
+}
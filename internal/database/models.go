@@ -11,12 +11,183 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID    `json:"id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"-"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+}
+
+type Block struct {
+	BlockerID uuid.UUID `json:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Bookmark struct {
+	UserID       uuid.UUID     `json:"user_id"`
+	ChirpID      uuid.UUID     `json:"chirp_id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	CollectionID uuid.NullUUID `json:"collection_id"`
+}
+
+type BookmarkCollection struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+}
+
 type Chirp struct {
+	ID           uuid.UUID     `json:"id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	Body         string        `json:"body"`
+	UserID       uuid.NullUUID `json:"user_id"`
+	ReplyToID    uuid.NullUUID `json:"reply_to_id"`
+	Status       string        `json:"status"`
+	PublishAt    sql.NullTime  `json:"publish_at"`
+	Visibility   string        `json:"visibility"`
+	MentionedIds []uuid.UUID   `json:"mentioned_ids"`
+}
+
+type DomainEvent struct {
+	ID          uuid.UUID    `json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	EventType   string       `json:"event_type"`
+	UserID      uuid.UUID    `json:"user_id"`
+	Payload     string       `json:"payload"`
+	Status      string       `json:"status"`
+	Attempts    int32        `json:"attempts"`
+	AvailableAt time.Time    `json:"available_at"`
+	LastError   string       `json:"last_error"`
+	PublishedAt sql.NullTime `json:"published_at"`
+	HandledBy   []string     `json:"handled_by"`
+}
+
+type Draft struct {
+	ID         uuid.UUID     `json:"id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	UserID     uuid.UUID     `json:"user_id"`
+	Body       string        `json:"body"`
+	ReplyToID  uuid.NullUUID `json:"reply_to_id"`
+	MediaIds   []uuid.UUID   `json:"media_ids"`
+	Visibility string        `json:"visibility"`
+}
+
+type Follow struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Identity struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+}
+
+type Like struct {
+	UserID    uuid.UUID `json:"user_id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LinkPreview struct {
+	URL         string    `json:"url"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	Succeeded   bool      `json:"succeeded"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageUrl    string    `json:"image_url"`
+	SiteName    string    `json:"site_name"`
+}
+
+type MediaAttachment struct {
+	ID                   uuid.UUID     `json:"id"`
+	CreatedAt            time.Time     `json:"created_at"`
+	UserID               uuid.NullUUID `json:"user_id"`
+	ChirpID              uuid.NullUUID `json:"chirp_id"`
+	AttachedAt           sql.NullTime  `json:"attached_at"`
+	Position             int32         `json:"position"`
+	ContentType          string        `json:"content_type"`
+	Size                 int64         `json:"size"`
+	Width                int32         `json:"width"`
+	Height               int32         `json:"height"`
+	BlobKey              string        `json:"blob_key"`
+	ThumbnailKey         string        `json:"thumbnail_key"`
+	ThumbnailContentType string        `json:"thumbnail_content_type"`
+}
+
+type Mute struct {
+	MuterID   uuid.UUID `json:"muter_id"`
+	MutedID   uuid.UUID `json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MutedWord struct {
+	ID        uuid.UUID    `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Phrase    string       `json:"phrase"`
+	ExpiresAt sql.NullTime `json:"expires_at"`
+}
+
+type Notification struct {
 	ID        uuid.UUID     `json:"id"`
 	CreatedAt time.Time     `json:"created_at"`
-	UpdatedAt time.Time     `json:"updated_at"`
-	Body      string        `json:"body"`
-	UserID    uuid.NullUUID `json:"user_id"`
+	UserID    uuid.UUID     `json:"user_id"`
+	ActorID   uuid.UUID     `json:"actor_id"`
+	Type      string        `json:"type"`
+	ChirpID   uuid.NullUUID `json:"chirp_id"`
+	EventID   uuid.UUID     `json:"event_id"`
+	ReadAt    sql.NullTime  `json:"read_at"`
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string       `json:"code_hash"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+	ClientID      uuid.UUID    `json:"client_id"`
+	UserID        uuid.UUID    `json:"user_id"`
+	RedirectUri   string       `json:"redirect_uri"`
+	Scopes        []string     `json:"scopes"`
+	CodeChallenge string       `json:"code_challenge"`
+	UsedAt        sql.NullTime `json:"used_at"`
+}
+
+type OauthClient struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	UserID       uuid.UUID `json:"user_id"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"-"`
+	RedirectUris []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+}
+
+type RealtimeMessage struct {
+	ID              int64       `json:"id"`
+	CreatedAt       time.Time   `json:"created_at"`
+	Event           string      `json:"event"`
+	Data            string      `json:"data"`
+	UserIds         []uuid.UUID `json:"user_ids"`
+	Topics          []string    `json:"topics"`
+	ExcludedUserIds []uuid.UUID `json:"excluded_user_ids"`
 }
 
 type RefreshToken struct {
@@ -28,11 +199,67 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime  `json:"revoked_at"`
 }
 
+type Subscription struct {
+	ID               uuid.UUID    `json:"id"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+	UserID           uuid.UUID    `json:"user_id"`
+	Plan             string       `json:"plan"`
+	Status           string       `json:"status"`
+	CurrentPeriodEnd sql.NullTime `json:"current_period_end"`
+	CanceledAt       sql.NullTime `json:"canceled_at"`
+}
+
 type User struct {
-	ID             uuid.UUID `json:"id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"-"`
-	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	ID             uuid.UUID    `json:"id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	Email          string       `json:"email"`
+	HashedPassword string       `json:"-"`
+	DisplayName    string       `json:"display_name"`
+	Handle         string       `json:"handle"`
+	Bio            string       `json:"bio"`
+	AvatarURL      string       `json:"avatar_url"`
+	DeletedAt      sql.NullTime `json:"-"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID     `json:"id"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	SubscriptionID uuid.UUID     `json:"subscription_id"`
+	EventID        string        `json:"event_id"`
+	EventType      string        `json:"event_type"`
+	Payload        string        `json:"payload"`
+	Status         string        `json:"status"`
+	Attempts       int32         `json:"attempts"`
+	NextAttemptAt  time.Time     `json:"next_attempt_at"`
+	LastAttemptAt  sql.NullTime  `json:"last_attempt_at"`
+	ResponseStatus sql.NullInt32 `json:"response_status"`
+	LastError      string        `json:"last_error"`
+	DeliveredAt    sql.NullTime  `json:"delivered_at"`
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID      `json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Provider    string         `json:"provider"`
+	EventID     sql.NullString `json:"event_id"`
+	EventType   string         `json:"event_type"`
+	Payload     string         `json:"payload"`
+	Status      string         `json:"status"`
+	Error       string         `json:"error"`
+	Attempts    int32          `json:"attempts"`
+	ProcessedAt sql.NullTime   `json:"processed_at"`
+}
+
+type WebhookSubscription struct {
+	ID         uuid.UUID     `json:"id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	UserID     uuid.NullUUID `json:"user_id"`
+	URL        string        `json:"url"`
+	Secret     string        `json:"-"`
+	EventTypes []string      `json:"event_types"`
 }
@@ -7,8 +7,11 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -20,7 +23,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, display_name, handle, bio, avatar_url, deleted_at
 `
 
 type CreateUserParams struct {
@@ -37,13 +40,17 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Handle,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, display_name, handle, bio, avatar_url, deleted_at
 FROM users
 WHERE email = $1
 `
@@ -57,38 +64,241 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.DisplayName,
+		&i.Handle,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, display_name, handle, bio, avatar_url, deleted_at
+FROM users
+WHERE handle <> ''
+AND lower(handle) = lower($1)
+AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.DisplayName,
+		&i.Handle,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, display_name, handle, bio, avatar_url, deleted_at
+FROM users
+WHERE id = $1
+AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.DisplayName,
+		&i.Handle,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserIDsByHandles = `-- name: GetUserIDsByHandles :many
+SELECT id
+FROM users
+WHERE handle <> ''
+AND lower(handle) = ANY($1::text[])
+AND deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = users.id AND blocks.blocked_id = $2)
+    OR (blocks.blocker_id = $2 AND blocks.blocked_id = users.id)
+)
+`
+
+type GetUserIDsByHandlesParams struct {
+	Handles  []string  `json:"handles"`
+	AuthorID uuid.UUID `json:"author_id"`
+}
+
+// The users author_id can mention, none who blocked them or whom they
+// blocked
+func (q *Queries) GetUserIDsByHandles(ctx context.Context, arg GetUserIDsByHandlesParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getUserIDsByHandles, pq.Array(arg.Handles), arg.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserStats = `-- name: GetUserStats :one
+SELECT
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = $1::uuid AND chirps.status = 'published') AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = $1::uuid) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = $1::uuid) AS following_count,
+    EXISTS (
+        SELECT 1 FROM subscriptions
+        WHERE subscriptions.user_id = $1::uuid
+        AND subscriptions.status IN ('active', 'canceled')
+        AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > NOW())
+    ) AS is_chirpy_red
+`
+
+type GetUserStatsRow struct {
+	ChirpCount     int64 `json:"chirp_count"`
+	FollowerCount  int64 `json:"follower_count"`
+	FollowingCount int64 `json:"following_count"`
+	IsChirpyRed    bool  `json:"is_chirpy_red"`
+}
+
+func (q *Queries) GetUserStats(ctx context.Context, userID uuid.UUID) (GetUserStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserStats, userID)
+	var i GetUserStatsRow
+	err := row.Scan(
+		&i.ChirpCount,
+		&i.FollowerCount,
+		&i.FollowingCount,
 		&i.IsChirpyRed,
 	)
 	return i, err
 }
 
-const truncateUsers = `-- name: TruncateUsers :exec
-TRUNCATE users CASCADE
+const isUserActive = `-- name: IsUserActive :one
+SELECT EXISTS (
+    SELECT 1 FROM users
+    WHERE id = $1
+    AND deleted_at IS NULL
+)
 `
 
-func (q *Queries) TruncateUsers(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, truncateUsers)
+// False once the account is deleted, its tokens stop working at once
+// rather than when they expire
+func (q *Queries) IsUserActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isUserActive, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const lockActiveUser = `-- name: LockActiveUser :one
+SELECT id
+FROM users
+WHERE id = $1
+AND deleted_at IS NULL
+FOR SHARE
+`
+
+// Keeps the user from being deleted until the transaction ends, returns no
+// rows once the account is deleted
+func (q *Queries) LockActiveUser(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, lockActiveUser, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const lockUserForUpdate = `-- name: LockUserForUpdate :exec
+SELECT id
+FROM users
+WHERE id = $1
+FOR NO KEY UPDATE
+`
+
+// Makes the user's transactions that count their rows before adding one
+// take turns, so two of them can't both get under a limit
+func (q *Queries) LockUserForUpdate(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, lockUserForUpdate, id)
 	return err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL
+AND deleted_at < $1::timestamp
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUser = `-- name: RestoreUser :one
 UPDATE users
 SET
-    email = $1,
-    hashed_password = $2,
+    deleted_at = NULL,
     updated_at = NOW()
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, display_name, handle, bio, avatar_url, deleted_at
 `
 
-type UpdateUserParams struct {
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"-"`
-	ID             uuid.UUID `json:"id"`
+func (q *Queries) RestoreUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, restoreUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.DisplayName,
+		&i.Handle,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.DeletedAt,
+	)
+	return i, err
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+const softDeleteUser = `-- name: SoftDeleteUser :one
+UPDATE users
+SET
+    deleted_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, email, hashed_password, display_name, handle, bio, avatar_url, deleted_at
+`
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, softDeleteUser, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -96,22 +306,59 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Handle,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const upgradeUser = `-- name: UpgradeUser :one
+const truncateUsers = `-- name: TruncateUsers :exec
+TRUNCATE users CASCADE
+`
+
+func (q *Queries) TruncateUsers(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, truncateUsers)
+	return err
+}
+
+const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET
-    is_chirpy_red = TRUE,
+    email = COALESCE($1, email),
+    hashed_password = COALESCE($2, hashed_password),
+    display_name = COALESCE($3, display_name),
+    handle = COALESCE($4, handle),
+    bio = COALESCE($5, bio),
+    avatar_url = COALESCE($6, avatar_url),
     updated_at = NOW()
-WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+WHERE id = $7
+AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, email, hashed_password, display_name, handle, bio, avatar_url, deleted_at
 `
 
-func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (User, error) {
-	row := q.db.QueryRowContext(ctx, upgradeUser, id)
+type UpdateUserParams struct {
+	Email          sql.NullString `json:"email"`
+	HashedPassword sql.NullString `json:"-"`
+	DisplayName    sql.NullString `json:"display_name"`
+	Handle         sql.NullString `json:"handle"`
+	Bio            sql.NullString `json:"bio"`
+	AvatarURL      sql.NullString `json:"avatar_url"`
+	ID             uuid.UUID      `json:"id"`
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.DisplayName,
+		arg.Handle,
+		arg.Bio,
+		arg.AvatarURL,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -119,7 +366,11 @@ func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.DisplayName,
+		&i.Handle,
+		&i.Bio,
+		&i.AvatarURL,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,284 @@
+// Package dispatch delivers outgoing webhooks from the webhook_deliveries
+// outbox, retrying failures with exponential backoff until they succeed or
+// are dead-lettered
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/preview"
+	"github.com/maniac-en/chirpstack/internal/webhooks"
+)
+
+// event types subscribers can register for, the domain events of the same
+// name are sent as they are
+const (
+	EventChirpCreated = events.ChirpCreated
+	EventChirpUpdated = events.ChirpUpdated
+	EventChirpDeleted = events.ChirpDeleted
+	EventUserUpdated  = events.UserUpdated
+)
+
+func ValidEventTypes() []string {
+	return []string{EventChirpCreated, EventChirpUpdated, EventChirpDeleted, EventUserUpdated}
+}
+
+func IsValidEventType(eventType string) bool {
+	for _, t := range ValidEventTypes() {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// statuses of rows in webhook_deliveries
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+const (
+	DefaultBatchSize   = 20
+	DefaultMaxAttempts = 8
+	DefaultTimeout     = 10 * time.Second
+
+	// the first retry waits baseBackoff, each one after that twice as long
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+	// maxResponseBody bounds how much of a receiver's response is read
+	maxResponseBody = 64 << 10
+)
+
+// Event is the JSON envelope every delivery carries
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewEvent wraps a domain event for subscribers
+func NewEvent(event events.Event) Event {
+	return Event{
+		ID:        "evt_" + event.ID.String(),
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt.UTC(),
+		Data:      event.Payload,
+	}
+}
+
+// Delivery is one event on its way to one subscription. Attempts counts
+// this attempt.
+type Delivery struct {
+	ID        uuid.UUID
+	URL       string
+	Secret    string
+	EventID   string
+	EventType string
+	Payload   []byte
+	Attempts  int
+}
+
+// Result is the outcome of an attempt. NextAttemptAt is only meaningful
+// while the delivery is still pending.
+type Result struct {
+	Status         string
+	ResponseStatus int
+	Error          string
+	NextAttemptAt  time.Time
+}
+
+// Store is the outbox. ClaimDeliveries must hand each due delivery to one
+// caller only, and count the attempt.
+type Store interface {
+	ClaimDeliveries(ctx context.Context, limit int) ([]Delivery, error)
+	FinishDelivery(ctx context.Context, id uuid.UUID, result Result) error
+}
+
+type Dispatcher struct {
+	Store       Store
+	Client      *http.Client
+	BatchSize   int
+	MaxAttempts int
+	// Now is used instead of time.Now when set
+	Now func() time.Time
+}
+
+// New returns a dispatcher with the default settings and an HTTP client that
+// only connects to public addresses, so webhook URLs can't be used to reach
+// the network the server runs in, and doesn't follow redirects
+func New(store Store) *Dispatcher {
+	return &Dispatcher{
+		Store:       store,
+		Client:      newClient(DefaultTimeout, preview.IsBlocked),
+		BatchSize:   DefaultBatchSize,
+		MaxAttempts: DefaultMaxAttempts,
+	}
+}
+
+// newClient returns a client that doesn't follow redirects and refuses to
+// connect to the addresses blocked reports, checked at dial time like link
+// previews are
+func newClient(timeout time.Duration, blocked func(netip.Addr) bool) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy from the environment, it would dial on our behalf
+			Proxy:                 nil,
+			DialContext:           preview.NewDialer(timeout, blocked).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Run dispatches due deliveries every interval until ctx is done. A full
+// batch is followed by another right away.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := d.DispatchOnce(ctx)
+			if err != nil {
+				log.Printf("webhook dispatcher: %v", err)
+			}
+			if err != nil || n < d.batchSize() {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce attempts one batch of due deliveries concurrently and returns
+// how many it claimed
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	deliveries, err := d.Store.ClaimDeliveries(ctx, d.batchSize())
+	if err != nil {
+		return 0, fmt.Errorf("claiming deliveries: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := d.deliver(ctx, delivery)
+			if err := d.Store.FinishDelivery(ctx, delivery.ID, result); err != nil {
+				// the lease runs out and the delivery is attempted again
+				log.Printf("webhook dispatcher: recording delivery %s: %v", delivery.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery Delivery) Result {
+	now := d.now()
+	statusCode, err := d.send(ctx, delivery, now)
+	if err == nil {
+		return Result{Status: StatusSucceeded, ResponseStatus: statusCode, NextAttemptAt: now}
+	}
+
+	result := Result{
+		Status:         StatusPending,
+		ResponseStatus: statusCode,
+		Error:          err.Error(),
+		NextAttemptAt:  now.Add(Backoff(delivery.Attempts)),
+	}
+	if delivery.Attempts >= d.maxAttempts() {
+		result.Status = StatusDead
+		result.NextAttemptAt = now
+	}
+	return result
+}
+
+// send posts the payload and returns the response status, any status but
+// 2xx is an error
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpstack-Webhooks/1.0")
+	req.Header.Set("Webhook-Id", delivery.EventID)
+	req.Header.Set("Webhook-Event", delivery.EventType)
+	req.Header.Set("Webhook-Delivery", delivery.ID.String())
+	req.Header.Set(webhooks.DefaultSignatureHeader, webhooks.Sign(delivery.Secret, now, delivery.Payload))
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// drain so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxResponseBody))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// Backoff is how long to wait after the given failed attempt
+func Backoff(attempt int) time.Duration {
+	backoff := baseBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
+
+func (d *Dispatcher) batchSize() int {
+	if d.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return d.BatchSize
+}
+
+func (d *Dispatcher) maxAttempts() int {
+	if d.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return d.MaxAttempts
+}
+
+func (d *Dispatcher) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now().UTC()
+}
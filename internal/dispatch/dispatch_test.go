@@ -0,0 +1,255 @@
+package dispatch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/preview"
+	"github.com/maniac-en/chirpstack/internal/webhooks"
+)
+
+// newTestDispatcher can reach loopback test servers and nothing else that
+// preview.IsBlocked refuses
+func newTestDispatcher(store Store) *Dispatcher {
+	d := New(store)
+	d.Client = newClient(DefaultTimeout, func(addr netip.Addr) bool {
+		return !addr.IsLoopback() && preview.IsBlocked(addr)
+	})
+	return d
+}
+
+// fakeStore hands out its pending deliveries once and records the results
+type fakeStore struct {
+	mu         sync.Mutex
+	deliveries []Delivery
+	results    map[uuid.UUID]Result
+}
+
+func (s *fakeStore) ClaimDeliveries(ctx context.Context, limit int) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := min(limit, len(s.deliveries))
+	claimed := s.deliveries[:n]
+	s.deliveries = s.deliveries[n:]
+	return claimed, nil
+}
+
+func (s *fakeStore) FinishDelivery(ctx context.Context, id uuid.UUID, result Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.results == nil {
+		s.results = make(map[uuid.UUID]Result)
+	}
+	s.results[id] = result
+	return nil
+}
+
+func TestDispatcher_DispatchOnce(t *testing.T) {
+	now := time.Now()
+	verifier := webhooks.HMACVerifier{Secret: "whsec_test"}
+
+	var mu sync.Mutex
+	received := map[string]string{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := verifier.Verify(r.Header, body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		received[r.Header.Get("Webhook-Id")] = string(body)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/redirect":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer receiver.Close()
+
+	tests := []struct {
+		name          string
+		path          string
+		secret        string
+		attempts      int
+		wantStatus    string
+		wantResponse  int
+		wantNextAtt   time.Duration
+		wantDelivered bool
+	}{
+		{
+			name:          "delivered",
+			path:          "/ok",
+			secret:        "whsec_test",
+			attempts:      1,
+			wantStatus:    StatusSucceeded,
+			wantResponse:  http.StatusNoContent,
+			wantDelivered: true,
+		},
+		{
+			name:          "server error is retried",
+			path:          "/fail",
+			secret:        "whsec_test",
+			attempts:      3,
+			wantStatus:    StatusPending,
+			wantResponse:  http.StatusInternalServerError,
+			wantNextAtt:   2 * time.Minute,
+			wantDelivered: true,
+		},
+		{
+			name:          "last attempt is dead-lettered",
+			path:          "/fail",
+			secret:        "whsec_test",
+			attempts:      DefaultMaxAttempts,
+			wantStatus:    StatusDead,
+			wantResponse:  http.StatusInternalServerError,
+			wantDelivered: true,
+		},
+		{
+			name:          "redirects are not followed",
+			path:          "/redirect",
+			secret:        "whsec_test",
+			attempts:      1,
+			wantStatus:    StatusPending,
+			wantResponse:  http.StatusFound,
+			wantNextAtt:   30 * time.Second,
+			wantDelivered: true,
+		},
+		{
+			name:         "wrong secret is rejected by the receiver",
+			path:         "/ok",
+			secret:       "whsec_other",
+			attempts:     1,
+			wantStatus:   StatusPending,
+			wantResponse: http.StatusUnauthorized,
+			wantNextAtt:  30 * time.Second,
+		},
+	}
+
+	store := &fakeStore{}
+	for _, tt := range tests {
+		store.deliveries = append(store.deliveries, Delivery{
+			ID:        uuid.New(),
+			URL:       receiver.URL + tt.path,
+			Secret:    tt.secret,
+			EventID:   tt.name,
+			EventType: EventChirpCreated,
+			Payload:   []byte(`{"type":"chirp.created"}`),
+			Attempts:  tt.attempts,
+		})
+	}
+	ids := make([]uuid.UUID, len(store.deliveries))
+	for i, d := range store.deliveries {
+		ids[i] = d.ID
+	}
+
+	d := newTestDispatcher(store)
+	d.Now = func() time.Time { return now }
+	n, err := d.DispatchOnce(context.Background())
+	if err != nil {
+		t.Fatalf("DispatchOnce() unexpected error = %v", err)
+	}
+	if n != len(tests) {
+		t.Fatalf("DispatchOnce() claimed %d deliveries, want %d", n, len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := store.results[ids[i]]
+			if result.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q (error %q)", result.Status, tt.wantStatus, result.Error)
+			}
+			if result.ResponseStatus != tt.wantResponse {
+				t.Errorf("response status = %d, want %d", result.ResponseStatus, tt.wantResponse)
+			}
+			if got := result.NextAttemptAt.Sub(now); result.Status == StatusPending && got != tt.wantNextAtt {
+				t.Errorf("next attempt in %v, want %v", got, tt.wantNextAtt)
+			}
+			if _, ok := received[tt.name]; ok != tt.wantDelivered {
+				t.Errorf("receiver got the payload = %v, want %v", ok, tt.wantDelivered)
+			}
+		})
+	}
+}
+
+func TestDispatcher_DispatchOnce_Unreachable(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	id := uuid.New()
+	store := &fakeStore{deliveries: []Delivery{{ID: id, URL: url, Attempts: 1}}}
+	if _, err := newTestDispatcher(store).DispatchOnce(context.Background()); err != nil {
+		t.Fatalf("DispatchOnce() unexpected error = %v", err)
+	}
+	result := store.results[id]
+	if result.Status != StatusPending || result.ResponseStatus != 0 || result.Error == "" {
+		t.Errorf("result = %+v, want a pending retry with the connection error", result)
+	}
+	// next_attempt_at has no time zone and is compared with NOW()
+	if result.NextAttemptAt.Location() != time.UTC {
+		t.Errorf("next attempt at %v, want it in UTC", result.NextAttemptAt)
+	}
+}
+
+func TestDispatcher_DispatchOnce_RefusesPrivateAddresses(t *testing.T) {
+	reached := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer receiver.Close()
+
+	id := uuid.New()
+	store := &fakeStore{deliveries: []Delivery{{ID: id, URL: receiver.URL + "/hook", Attempts: 1}}}
+	if _, err := New(store).DispatchOnce(context.Background()); err != nil {
+		t.Fatalf("DispatchOnce() unexpected error = %v", err)
+	}
+	result := store.results[id]
+	if reached {
+		t.Error("the default client connected to a loopback address")
+	}
+	// nothing about the internal service may reach the subscriber
+	if result.ResponseStatus != 0 || !strings.Contains(result.Error, preview.ErrBlocked.Error()) {
+		t.Errorf("result = %+v, want a refused connection", result)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	id := uuid.New()
+	event := NewEvent(events.Event{ID: id, Type: EventUserUpdated, Payload: []byte(`{"id":"u1"}`)})
+	if event.Type != EventUserUpdated || string(event.Data) != `{"id":"u1"}` || event.ID != "evt_"+id.String() {
+		t.Errorf("NewEvent() = %+v", event)
+	}
+	if IsValidEventType("chirp.liked") {
+		t.Error("IsValidEventType(chirp.liked) = true, want false")
+	}
+}
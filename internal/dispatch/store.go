@@ -0,0 +1,44 @@
+package dispatch
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+// DBStore is the Store backed by the webhook_deliveries table
+type DBStore struct {
+	DB *database.Queries
+}
+
+func (s DBStore) ClaimDeliveries(ctx context.Context, limit int) ([]Delivery, error) {
+	rows, err := s.DB.ClaimWebhookDeliveries(ctx, int32(limit))
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]Delivery, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, Delivery{
+			ID:        row.ID,
+			URL:       row.URL,
+			Secret:    row.Secret,
+			EventID:   row.EventID,
+			EventType: row.EventType,
+			Payload:   []byte(row.Payload),
+			Attempts:  int(row.Attempts),
+		})
+	}
+	return deliveries, nil
+}
+
+func (s DBStore) FinishDelivery(ctx context.Context, id uuid.UUID, result Result) error {
+	return s.DB.FinishWebhookDelivery(ctx, database.FinishWebhookDeliveryParams{
+		Status:         result.Status,
+		ResponseStatus: sql.NullInt32{Int32: int32(result.ResponseStatus), Valid: result.ResponseStatus != 0},
+		LastError:      result.Error,
+		NextAttemptAt:  result.NextAttemptAt,
+		ID:             id,
+	})
+}
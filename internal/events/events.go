@@ -0,0 +1,120 @@
+// Package events is the domain event bus. Events are recorded in the
+// domain_events outbox in the same transaction as the change they describe,
+// and a Relay publishes the committed ones to in-process subscribers.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+// event types recorded by chirpstack
+const (
+	ChirpCreated        = "chirp.created"
+	ChirpUpdated        = "chirp.updated"
+	ChirpDeleted        = "chirp.deleted"
+	ChirpLiked          = "chirp.liked"
+	UserUpdated         = "user.updated"
+	UserFollowed        = "user.followed"
+	SubscriptionChanged = "subscription.changed"
+)
+
+// AllEvents subscribes a handler to every event type
+const AllEvents = "*"
+
+// Event is something that happened to UserID's data. Payload is the JSON of
+// whatever was recorded, usually the changed row.
+type Event struct {
+	ID        uuid.UUID
+	Type      string
+	UserID    uuid.UUID
+	Payload   json.RawMessage
+	CreatedAt time.Time
+	// Attempts counts the times the relay published the event, this one
+	// included
+	Attempts int
+	// Handled names the handlers that handled the event on an earlier
+	// attempt, publishing it again skips them
+	Handled []string
+}
+
+// Decode unmarshals the payload into v
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// Record writes an event to the outbox. Pass the queries of the transaction
+// making the change, so the event is only published if the change commits.
+func Record(ctx context.Context, q *database.Queries, eventType string, userID uuid.UUID, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding %s event: %w", eventType, err)
+	}
+	_, err = q.CreateDomainEvent(ctx, database.CreateDomainEventParams{
+		EventType: eventType,
+		UserID:    userID,
+		Payload:   string(payload),
+	})
+	return err
+}
+
+// Handler reacts to an event. Events are delivered at least once, a handler
+// may see the same event again after it failed or the relay died, so it
+// must be idempotent.
+type Handler func(ctx context.Context, event Event) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// Bus fans events out to the handlers subscribed to them
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[string][]subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[string][]subscriber)}
+}
+
+// Subscribe registers handler for eventType, or for every event with
+// AllEvents. name identifies the handler in errors and logs, and in
+// Event.Handled, so it must be unique among the handlers of an event.
+func (b *Bus) Subscribe(eventType, name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[eventType] = append(b.subscribers[eventType], subscriber{name, handler})
+}
+
+// Publish runs the event's handlers in the order they subscribed, except
+// those in event.Handled. Every handler runs even if an earlier one fails,
+// the failures are joined. It returns the handlers that have handled the
+// event, on this attempt or an earlier one.
+func (b *Bus) Publish(ctx context.Context, event Event) ([]string, error) {
+	b.mu.RLock()
+	subscribers := slices.Concat(b.subscribers[event.Type], b.subscribers[AllEvents])
+	b.mu.RUnlock()
+
+	handled := slices.Clone(event.Handled)
+	var errs []error
+	for _, s := range subscribers {
+		if slices.Contains(event.Handled, s.name) {
+			continue
+		}
+		if err := s.handler(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			continue
+		}
+		handled = append(handled, s.name)
+	}
+	return handled, errors.Join(errs...)
+}
@@ -0,0 +1,204 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBus_Publish(t *testing.T) {
+	bus := NewBus()
+	var calls []string
+	record := func(name string, err error) Handler {
+		return func(ctx context.Context, event Event) error {
+			calls = append(calls, name+":"+event.Type)
+			return err
+		}
+	}
+	bus.Subscribe(ChirpCreated, "first", record("first", nil))
+	bus.Subscribe(ChirpCreated, "failing", record("failing", errors.New("boom")))
+	bus.Subscribe(AllEvents, "audit", record("audit", nil))
+	bus.Subscribe(UserUpdated, "users", record("users", nil))
+
+	handled, err := bus.Publish(context.Background(), Event{Type: ChirpCreated})
+	if err == nil || err.Error() != "failing: boom" {
+		t.Errorf("Publish() error = %v, want the failing handler's error", err)
+	}
+	want := []string{"first:chirp.created", "failing:chirp.created", "audit:chirp.created"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("handlers ran = %v, want %v", calls, want)
+	}
+	if want := []string{"first", "audit"}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("Publish() handled = %v, want %v", handled, want)
+	}
+
+	// a retry only runs the handler that failed
+	calls = nil
+	handled, _ = bus.Publish(context.Background(), Event{Type: ChirpCreated, Handled: handled})
+	if want := []string{"failing:chirp.created"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("handlers ran again = %v, want %v", calls, want)
+	}
+	if want := []string{"first", "audit"}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("Publish() handled = %v, want %v", handled, want)
+	}
+
+	calls = nil
+	if _, err := bus.Publish(context.Background(), Event{Type: ChirpDeleted}); err != nil {
+		t.Errorf("Publish() unexpected error = %v", err)
+	}
+	if want := []string{"audit:chirp.deleted"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("handlers ran = %v, want %v", calls, want)
+	}
+}
+
+func TestEvent_Decode(t *testing.T) {
+	event := Event{Payload: []byte(`{"body":"hello"}`)}
+	var chirp struct {
+		Body string `json:"body"`
+	}
+	if err := event.Decode(&chirp); err != nil || chirp.Body != "hello" {
+		t.Errorf("Decode() = %+v, %v", chirp, err)
+	}
+}
+
+type failure struct {
+	status  string
+	handled []string
+	retryAt time.Time
+}
+
+// fakeStore hands out its events once and records what happened to them
+type fakeStore struct {
+	events          []Event
+	published       []uuid.UUID
+	failed          map[uuid.UUID]failure
+	publishedBefore time.Time
+}
+
+func (s *fakeStore) ClaimEvents(ctx context.Context, limit int) ([]Event, error) {
+	n := min(limit, len(s.events))
+	claimed := s.events[:n]
+	s.events = s.events[n:]
+	return claimed, nil
+}
+
+func (s *fakeStore) MarkPublished(ctx context.Context, id uuid.UUID) error {
+	s.published = append(s.published, id)
+	return nil
+}
+
+func (s *fakeStore) MarkFailed(ctx context.Context, id uuid.UUID, status string, handled []string, err error, retryAt time.Time) error {
+	if s.failed == nil {
+		s.failed = make(map[uuid.UUID]failure)
+	}
+	s.failed[id] = failure{status, handled, retryAt}
+	return nil
+}
+
+func (s *fakeStore) DeletePublishedBefore(ctx context.Context, t time.Time) (int64, error) {
+	s.publishedBefore = t
+	return 0, nil
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ok := Event{ID: uuid.New(), Type: ChirpCreated, Attempts: 1}
+	retried := Event{ID: uuid.New(), Type: UserUpdated, Attempts: 2}
+	exhausted := Event{ID: uuid.New(), Type: UserUpdated, Attempts: DefaultMaxAttempts}
+	store := &fakeStore{events: []Event{ok, retried, exhausted}}
+
+	bus := NewBus()
+	var published []uuid.UUID
+	bus.Subscribe(AllEvents, "recorder", func(ctx context.Context, event Event) error {
+		published = append(published, event.ID)
+		return nil
+	})
+	bus.Subscribe(UserUpdated, "broken", func(ctx context.Context, event Event) error {
+		return errors.New("unavailable")
+	})
+
+	relay := NewRelay(store, bus)
+	relay.Now = func() time.Time { return now }
+	n, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce() unexpected error = %v", err)
+	}
+	if n != 3 {
+		t.Errorf("RelayOnce() = %d, want 3", n)
+	}
+
+	if want := []uuid.UUID{ok.ID, retried.ID, exhausted.ID}; !reflect.DeepEqual(published, want) {
+		t.Errorf("published %v, want every event in order %v", published, want)
+	}
+	if want := []uuid.UUID{ok.ID}; !reflect.DeepEqual(store.published, want) {
+		t.Errorf("marked published %v, want %v", store.published, want)
+	}
+	if got := store.failed[retried.ID]; got.status != StatusPending || !got.retryAt.Equal(now.Add(10*time.Second)) {
+		t.Errorf("failed event = %+v, want pending and retried in 10s", got)
+	}
+	if got := store.failed[retried.ID].handled; !reflect.DeepEqual(got, []string{"recorder"}) {
+		t.Errorf("failed event handled by %v, want the recorder kept so it isn't run again", got)
+	}
+	if got := store.failed[exhausted.ID]; got.status != StatusFailed {
+		t.Errorf("exhausted event = %+v, want %q", got, StatusFailed)
+	}
+}
+
+func TestRelay_UTC(t *testing.T) {
+	// available_at and published_at have no time zone and are compared with
+	// NOW()
+	failing := Event{ID: uuid.New(), Type: UserUpdated, Attempts: 1}
+	store := &fakeStore{events: []Event{failing}}
+	bus := NewBus()
+	bus.Subscribe(UserUpdated, "broken", func(ctx context.Context, event Event) error {
+		return errors.New("unavailable")
+	})
+	relay := NewRelay(store, bus)
+	if _, err := relay.RelayOnce(context.Background()); err != nil {
+		t.Fatalf("RelayOnce() unexpected error = %v", err)
+	}
+	if got := store.failed[failing.ID].retryAt; got.Location() != time.UTC {
+		t.Errorf("retry at %v, want it in UTC", got)
+	}
+
+	relay.Retention = time.Hour
+	relay.prune(context.Background())
+	if store.publishedBefore.Location() != time.UTC {
+		t.Errorf("DeletePublishedBefore(%v), want the cutoff in UTC", store.publishedBefore)
+	}
+	if want := time.Now().Add(-time.Hour); store.publishedBefore.Sub(want).Abs() > time.Minute {
+		t.Errorf("DeletePublishedBefore(%v), want about %v", store.publishedBefore, want)
+	}
+}
+
+func TestRelay_Wake(t *testing.T) {
+	relay := NewRelay(&fakeStore{}, NewBus())
+	// waking never blocks, even when nobody is listening
+	relay.Wake()
+	relay.Wake()
+	select {
+	case <-relay.wake:
+	default:
+		t.Error("Wake() didn't signal the relay")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 5 * time.Second},
+		{3, 20 * time.Second},
+		{20, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// statuses of rows in domain_events
+const (
+	StatusPending   = "pending"
+	StatusPublished = "published"
+	StatusFailed    = "failed"
+)
+
+const (
+	DefaultBatchSize   = 100
+	DefaultMaxAttempts = 10
+	// DefaultRetention is how long published events are kept
+	DefaultRetention = 7 * 24 * time.Hour
+	// pruneInterval is how often events past the retention period are
+	// deleted
+	pruneInterval = time.Hour
+
+	// the first retry waits baseBackoff, each one after that twice as long
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 10 * time.Minute
+)
+
+// Store is the outbox. ClaimEvents must hand each due event to one caller
+// only, oldest first, and count the attempt. MarkFailed keeps the handlers
+// that handled the event, so a retry skips them.
+type Store interface {
+	ClaimEvents(ctx context.Context, limit int) ([]Event, error)
+	MarkPublished(ctx context.Context, id uuid.UUID) error
+	MarkFailed(ctx context.Context, id uuid.UUID, status string, handled []string, err error, retryAt time.Time) error
+	DeletePublishedBefore(ctx context.Context, t time.Time) (int64, error)
+}
+
+// Relay moves committed events from the outbox to the bus. An event whose
+// handlers fail is retried with backoff, so it can be overtaken by later
+// events; only the failed handlers run again.
+type Relay struct {
+	Store       Store
+	Bus         *Bus
+	BatchSize   int
+	MaxAttempts int
+	Retention   time.Duration
+	// Now is used instead of time.Now when set
+	Now func() time.Time
+
+	wake chan struct{}
+}
+
+func NewRelay(store Store, bus *Bus) *Relay {
+	return &Relay{
+		Store:       store,
+		Bus:         bus,
+		BatchSize:   DefaultBatchSize,
+		MaxAttempts: DefaultMaxAttempts,
+		Retention:   DefaultRetention,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Wake makes Run check the outbox now instead of at the next tick, call it
+// after committing events
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays events every interval, or when woken, until ctx is done. A
+// full batch is followed by another right away. Published events older
+// than the retention period are deleted as it goes.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(pruneInterval)
+	defer pruneTicker.Stop()
+	for {
+		for {
+			n, err := r.RelayOnce(ctx)
+			if err != nil {
+				log.Printf("event relay: %v", err)
+			}
+			if err != nil || n < r.batchSize() {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		case <-pruneTicker.C:
+			r.prune(ctx)
+		}
+	}
+}
+
+// RelayOnce publishes one batch of due events, in order, and returns how
+// many it claimed
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	events, err := r.Store.ClaimEvents(ctx, r.batchSize())
+	if err != nil {
+		return 0, fmt.Errorf("claiming events: %w", err)
+	}
+	for _, event := range events {
+		handled, err := r.Bus.Publish(ctx, event)
+		if err != nil {
+			r.fail(ctx, event, handled, err)
+			continue
+		}
+		if err := r.Store.MarkPublished(ctx, event.ID); err != nil {
+			// the lease runs out and the event is published again
+			log.Printf("event relay: marking %s %s published: %v", event.Type, event.ID, err)
+		}
+	}
+	return len(events), nil
+}
+
+func (r *Relay) fail(ctx context.Context, event Event, handled []string, handlerErr error) {
+	now := r.now()
+	status, retryAt := StatusPending, now.Add(Backoff(event.Attempts))
+	if event.Attempts >= r.maxAttempts() {
+		status, retryAt = StatusFailed, now
+		log.Printf("event relay: giving up on %s %s: %v", event.Type, event.ID, handlerErr)
+	}
+	if err := r.Store.MarkFailed(ctx, event.ID, status, handled, handlerErr, retryAt); err != nil {
+		log.Printf("event relay: recording failure of %s %s: %v", event.Type, event.ID, err)
+	}
+}
+
+// prune deletes the published events older than the retention period
+func (r *Relay) prune(ctx context.Context) {
+	if _, err := r.Store.DeletePublishedBefore(ctx, r.now().Add(-r.retention())); err != nil {
+		log.Printf("event relay: pruning events: %v", err)
+	}
+}
+
+// Backoff is how long to wait after the given failed attempt
+func Backoff(attempt int) time.Duration {
+	backoff := baseBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
+
+func (r *Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return r.BatchSize
+}
+
+func (r *Relay) maxAttempts() int {
+	if r.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+func (r *Relay) retention() time.Duration {
+	if r.Retention <= 0 {
+		return DefaultRetention
+	}
+	return r.Retention
+}
+
+func (r *Relay) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now().UTC()
+}
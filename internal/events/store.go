@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+// DBStore is the Store backed by the domain_events table
+type DBStore struct {
+	DB *database.Queries
+}
+
+func (s DBStore) ClaimEvents(ctx context.Context, limit int) ([]Event, error) {
+	rows, err := s.DB.ClaimDomainEvents(ctx, int32(limit))
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, Event{
+			ID:        row.ID,
+			Type:      row.EventType,
+			UserID:    row.UserID,
+			Payload:   json.RawMessage(row.Payload),
+			CreatedAt: row.CreatedAt,
+			Attempts:  int(row.Attempts),
+			Handled:   row.HandledBy,
+		})
+	}
+	// RETURNING doesn't keep the order the rows were claimed in
+	slices.SortFunc(events, func(a, b Event) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return events, nil
+}
+
+func (s DBStore) MarkPublished(ctx context.Context, id uuid.UUID) error {
+	return s.DB.MarkDomainEventPublished(ctx, id)
+}
+
+func (s DBStore) MarkFailed(ctx context.Context, id uuid.UUID, status string, handled []string, err error, retryAt time.Time) error {
+	// a nil slice would be stored as NULL rather than an empty array
+	if handled == nil {
+		handled = []string{}
+	}
+	return s.DB.FailDomainEvent(ctx, database.FailDomainEventParams{
+		Status:      status,
+		LastError:   err.Error(),
+		AvailableAt: retryAt,
+		HandledBy:   handled,
+		ID:          id,
+	})
+}
+
+func (s DBStore) DeletePublishedBefore(ctx context.Context, t time.Time) (int64, error) {
+	return s.DB.DeletePublishedDomainEventsBefore(ctx, t)
+}
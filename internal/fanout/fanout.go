@@ -0,0 +1,209 @@
+// Package fanout carries real-time messages to every server instance.
+// Messages are appended to a log in Postgres whose inserts NOTIFY the
+// instances; each one reads the log from where it left off and hands the
+// messages to its own streams and WebSockets. Since the log is read by ID, a
+// missed notification or a dropped listener connection delays messages but
+// doesn't lose them.
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Channel is the channel notified of each new message, by a trigger on the
+// realtime_messages table
+const Channel = "realtime_messages"
+
+const (
+	DefaultBatchSize = 100
+	// DefaultGapTimeout is how long a skipped ID is waited for. IDs are
+	// taken before inserts commit, so a later message can be visible before
+	// an earlier one; after the timeout the earlier one is assumed rolled
+	// back.
+	DefaultGapTimeout = 5 * time.Second
+	// DefaultRetention is how long messages are kept for instances catching
+	// up
+	DefaultRetention = time.Hour
+)
+
+// Message is delivered to the stream clients of UserIDs and the gateway
+// sessions subscribed to Topics, except those of ExcludedUserIDs
+type Message struct {
+	ID              int64
+	CreatedAt       time.Time
+	Event           string
+	Data            []byte
+	UserIDs         []uuid.UUID
+	Topics          []string
+	ExcludedUserIDs []uuid.UUID
+}
+
+// Store is the message log. IDs grow in the order messages are created.
+type Store interface {
+	LatestID(ctx context.Context) (int64, error)
+	MessagesAfter(ctx context.Context, id int64, limit int) ([]Message, error)
+	DeleteBefore(ctx context.Context, t time.Time) (int64, error)
+}
+
+// Receiver reads the log and delivers each message once, in order. It
+// starts from the end of the log, what was published before it started
+// isn't delivered.
+type Receiver struct {
+	Store      Store
+	Deliver    func(Message)
+	BatchSize  int
+	GapTimeout time.Duration
+	Retention  time.Duration
+	// Now is used instead of time.Now when set
+	Now func() time.Time
+
+	wake    chan struct{}
+	started bool
+	cursor  int64
+	// gapSince is when the receiver started waiting on a skipped ID
+	gapSince time.Time
+}
+
+func NewReceiver(store Store, deliver func(Message)) *Receiver {
+	return &Receiver{
+		Store:      store,
+		Deliver:    deliver,
+		BatchSize:  DefaultBatchSize,
+		GapTimeout: DefaultGapTimeout,
+		Retention:  DefaultRetention,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Wake makes Run read the log now instead of at the next tick
+func (r *Receiver) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run reads the log every interval, or when woken, until ctx is done. A
+// full batch is followed by another right away. Messages older than the
+// retention period are deleted as it goes.
+func (r *Receiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(r.retention())
+	defer pruneTicker.Stop()
+	for {
+		for {
+			n, err := r.ReceiveOnce(ctx)
+			if err != nil {
+				log.Printf("fanout: %v", err)
+			}
+			if err != nil || n < r.batchSize() {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		case <-pruneTicker.C:
+			r.prune(ctx)
+		}
+	}
+}
+
+// prune deletes the messages older than the retention period
+func (r *Receiver) prune(ctx context.Context) {
+	if _, err := r.Store.DeleteBefore(ctx, r.now().Add(-r.retention())); err != nil {
+		log.Printf("fanout: pruning messages: %v", err)
+	}
+}
+
+// ReceiveOnce delivers the next batch of messages and returns how many it
+// read. It stops early at a gap in the IDs until the gap times out.
+func (r *Receiver) ReceiveOnce(ctx context.Context) (int, error) {
+	if !r.started {
+		latestID, err := r.Store.LatestID(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("finding the end of the log: %w", err)
+		}
+		r.cursor = latestID
+		r.started = true
+	}
+
+	messages, err := r.Store.MessagesAfter(ctx, r.cursor, r.batchSize())
+	if err != nil {
+		return 0, fmt.Errorf("reading messages after %d: %w", r.cursor, err)
+	}
+	for i, message := range messages {
+		if message.ID != r.cursor+1 {
+			if r.gapSince.IsZero() {
+				r.gapSince = r.now()
+			}
+			if r.now().Sub(r.gapSince) < r.gapTimeout() {
+				return i, nil
+			}
+		}
+		r.gapSince = time.Time{}
+		r.cursor = message.ID
+		r.Deliver(message)
+	}
+	return len(messages), nil
+}
+
+// Listen wakes r whenever a message is published, through a LISTEN on a
+// dedicated connection. The listener reconnects by itself and r catches up
+// on what was published meanwhile; close the listener to stop.
+func Listen(connStr string, r *Receiver) (*pq.Listener, error) {
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("fanout listener: %v", err)
+		}
+	})
+	if err := listener.Listen(Channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	go func() {
+		// a nil notification follows every reconnect, it wakes r too
+		for range listener.Notify {
+			r.Wake()
+		}
+	}()
+	return listener, nil
+}
+
+func (r *Receiver) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now().UTC()
+}
+
+func (r *Receiver) batchSize() int {
+	if r.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return r.BatchSize
+}
+
+func (r *Receiver) gapTimeout() time.Duration {
+	if r.GapTimeout <= 0 {
+		return DefaultGapTimeout
+	}
+	return r.GapTimeout
+}
+
+func (r *Receiver) retention() time.Duration {
+	if r.Retention <= 0 {
+		return DefaultRetention
+	}
+	return r.Retention
+}
@@ -0,0 +1,154 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory log, messages are listed in ID order
+type fakeStore struct {
+	messages      []Message
+	err           error
+	deletedBefore time.Time
+}
+
+func (s *fakeStore) LatestID(ctx context.Context) (int64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	var latest int64
+	for _, m := range s.messages {
+		latest = max(latest, m.ID)
+	}
+	return latest, nil
+}
+
+func (s *fakeStore) MessagesAfter(ctx context.Context, id int64, limit int) ([]Message, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var messages []Message
+	for _, m := range s.messages {
+		if m.ID > id && len(messages) < limit {
+			messages = append(messages, m)
+		}
+	}
+	return messages, nil
+}
+
+func (s *fakeStore) DeleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	s.deletedBefore = t
+	return 0, nil
+}
+
+func (s *fakeStore) add(ids ...int64) {
+	for _, id := range ids {
+		s.messages = append(s.messages, Message{ID: id, Event: "chirp.created"})
+	}
+}
+
+func TestReceiver_ReceiveOnce(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeStore{}
+	store.add(1, 2)
+	var delivered []int64
+	receiver := NewReceiver(store, func(m Message) { delivered = append(delivered, m.ID) })
+	receiver.BatchSize = 2
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	receiver.Now = func() time.Time { return now }
+
+	// messages from before the receiver started aren't delivered
+	if n, err := receiver.ReceiveOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("ReceiveOnce() = %d, %v, want nothing new", n, err)
+	}
+
+	store.add(3, 4, 5)
+	if n, err := receiver.ReceiveOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("ReceiveOnce() = %d, %v, want a full batch", n, err)
+	}
+	if n, err := receiver.ReceiveOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("ReceiveOnce() = %d, %v, want the rest", n, err)
+	}
+	if want := []int64{3, 4, 5}; !reflect.DeepEqual(delivered, want) {
+		t.Errorf("delivered %v, want %v", delivered, want)
+	}
+
+	// 6 hasn't committed yet, 7 waits for it
+	store.add(7)
+	if n, err := receiver.ReceiveOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("ReceiveOnce() = %d, %v, want to wait at the gap", n, err)
+	}
+	store.messages = append(store.messages[:len(store.messages)-1], Message{ID: 6}, Message{ID: 7})
+	if n, err := receiver.ReceiveOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("ReceiveOnce() = %d, %v, want both once the gap is filled", n, err)
+	}
+
+	// 8 never commits, 9 is delivered once the gap times out
+	store.add(9)
+	if n, _ := receiver.ReceiveOnce(ctx); n != 0 {
+		t.Fatalf("ReceiveOnce() = %d, want to wait at the gap", n)
+	}
+	now = now.Add(receiver.GapTimeout)
+	if n, err := receiver.ReceiveOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("ReceiveOnce() = %d, %v, want to move past the gap", n, err)
+	}
+	if want := []int64{3, 4, 5, 6, 7, 9}; !reflect.DeepEqual(delivered, want) {
+		t.Errorf("delivered %v, want %v", delivered, want)
+	}
+
+	// after an outage the receiver catches up from where it was
+	store.err = errors.New("connection refused")
+	if _, err := receiver.ReceiveOnce(ctx); err == nil {
+		t.Fatal("ReceiveOnce() expected an error")
+	}
+	store.err = nil
+	store.add(10)
+	if n, err := receiver.ReceiveOnce(ctx); err != nil || n != 1 || delivered[len(delivered)-1] != 10 {
+		t.Errorf("ReceiveOnce() = %d, %v, want 10 after the outage", n, err)
+	}
+}
+
+func TestReceiver_StartError(t *testing.T) {
+	store := &fakeStore{err: errors.New("connection refused")}
+	receiver := NewReceiver(store, func(Message) { t.Error("nothing should be delivered") })
+	if _, err := receiver.ReceiveOnce(context.Background()); err == nil {
+		t.Fatal("ReceiveOnce() expected an error")
+	}
+
+	// the end of the log is looked up again once the store is back
+	store.err = nil
+	store.add(1)
+	if n, err := receiver.ReceiveOnce(context.Background()); err != nil || n != 0 {
+		t.Errorf("ReceiveOnce() = %d, %v, want to start after 1", n, err)
+	}
+}
+
+func TestReceiver_Prune(t *testing.T) {
+	store := &fakeStore{}
+	receiver := NewReceiver(store, func(Message) {})
+	receiver.Retention = time.Hour
+	receiver.prune(context.Background())
+
+	// created_at has no time zone and is set by NOW()
+	if store.deletedBefore.Location() != time.UTC {
+		t.Errorf("DeleteBefore(%v), want the cutoff in UTC", store.deletedBefore)
+	}
+	if want := time.Now().Add(-time.Hour); store.deletedBefore.Sub(want).Abs() > time.Minute {
+		t.Errorf("DeleteBefore(%v), want about %v", store.deletedBefore, want)
+	}
+}
+
+func TestReceiver_Wake(t *testing.T) {
+	receiver := NewReceiver(&fakeStore{}, func(Message) {})
+	receiver.Wake()
+	// a second wake before Run takes the first doesn't block
+	receiver.Wake()
+	select {
+	case <-receiver.wake:
+	default:
+		t.Error("Wake() didn't signal")
+	}
+}
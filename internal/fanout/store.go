@@ -0,0 +1,44 @@
+package fanout
+
+import (
+	"context"
+	"time"
+
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+// DBStore is the Store backed by the realtime_messages table
+type DBStore struct {
+	DB *database.Queries
+}
+
+func (s DBStore) LatestID(ctx context.Context) (int64, error) {
+	return s.DB.GetLatestRealtimeMessageID(ctx)
+}
+
+func (s DBStore) MessagesAfter(ctx context.Context, id int64, limit int) ([]Message, error) {
+	rows, err := s.DB.ListRealtimeMessagesAfter(ctx, database.ListRealtimeMessagesAfterParams{
+		ID:    id,
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(rows))
+	for _, row := range rows {
+		messages = append(messages, Message{
+			ID:              row.ID,
+			CreatedAt:       row.CreatedAt,
+			Event:           row.Event,
+			Data:            []byte(row.Data),
+			UserIDs:         row.UserIds,
+			Topics:          row.Topics,
+			ExcludedUserIDs: row.ExcludedUserIds,
+		})
+	}
+	return messages, nil
+}
+
+func (s DBStore) DeleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	return s.DB.DeleteRealtimeMessagesBefore(ctx, t)
+}
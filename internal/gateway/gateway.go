@@ -0,0 +1,359 @@
+// Package gateway serves live chirp events over WebSocket. Clients speak a
+// small JSON protocol to subscribe to topics: their timeline, a hashtag or
+// a user.
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/websocket"
+)
+
+// message types of the protocol
+const (
+	TypeSubscribe    = "subscribe"
+	TypeUnsubscribe  = "unsubscribe"
+	TypePing         = "ping"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypePong         = "pong"
+	TypeEvent        = "event"
+	TypeError        = "error"
+)
+
+// topics clients can subscribe to
+const (
+	TopicTimeline      = "timeline"
+	topicHashtagPrefix = "hashtag:"
+	topicUserPrefix    = "user:"
+	// timelines are per user, internally they're keyed by the user's ID
+	topicTimelinePrefix = "timeline:"
+)
+
+const (
+	// DefaultBufferSize is how many messages a session may fall behind by
+	// before it's disconnected
+	DefaultBufferSize = 64
+	// DefaultPingInterval is how often the server pings, a session that
+	// sends nothing for two intervals is disconnected
+	DefaultPingInterval = 30 * time.Second
+	// MaxSubscriptions is how many topics one session can subscribe to
+	MaxSubscriptions = 50
+	// maxClientMessageSize bounds what clients can send
+	maxClientMessageSize = 4 << 10
+)
+
+var hashtagRegexp = regexp.MustCompile(`^\w{1,50}$`)
+
+// TimelineTopic is the topic of userID's home timeline
+func TimelineTopic(userID uuid.UUID) string {
+	return topicTimelinePrefix + userID.String()
+}
+
+// UserTopic is the topic of the chirps userID posts
+func UserTopic(userID uuid.UUID) string {
+	return topicUserPrefix + userID.String()
+}
+
+// HashtagTopic is the topic of chirps tagged with tag
+func HashtagTopic(tag string) string {
+	return topicHashtagPrefix + strings.ToLower(tag)
+}
+
+// ParseTopic resolves a topic a client subscribes to, on behalf of userID,
+// to the topic events are published on
+func ParseTopic(topic string, userID uuid.UUID) (string, error) {
+	switch {
+	case topic == TopicTimeline:
+		return TimelineTopic(userID), nil
+	case strings.HasPrefix(topic, topicHashtagPrefix):
+		tag := strings.TrimPrefix(topic, topicHashtagPrefix)
+		if !hashtagRegexp.MatchString(tag) {
+			return "", errors.New("hashtags are 1-50 letters, digits or underscores")
+		}
+		return HashtagTopic(tag), nil
+	case strings.HasPrefix(topic, topicUserPrefix):
+		id, err := uuid.Parse(strings.TrimPrefix(topic, topicUserPrefix))
+		if err != nil {
+			return "", errors.New("invalid user ID")
+		}
+		return UserTopic(id), nil
+	}
+	return "", fmt.Errorf("invalid topic '%s', must be %s, %s<tag> or %s<id>", topic, TopicTimeline, topicHashtagPrefix, topicUserPrefix)
+}
+
+// topicUserID returns the user whose chirps a published topic carries, if
+// it's a user topic
+func topicUserID(topic string) (uuid.UUID, bool) {
+	if !strings.HasPrefix(topic, topicUserPrefix) {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(strings.TrimPrefix(topic, topicUserPrefix))
+	return id, err == nil
+}
+
+// clientTopic is the name a client knows a published topic by
+func clientTopic(topic string) string {
+	if strings.HasPrefix(topic, topicTimelinePrefix) {
+		return TopicTimeline
+	}
+	return topic
+}
+
+// Message is what's sent both ways. Clients may set ID on requests to
+// match them with the reply.
+type Message struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id,omitempty"`
+	Topic string          `json:"topic,omitempty"`
+	Event string          `json:"event,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type session struct {
+	conn   *websocket.Conn
+	userID uuid.UUID
+	send   chan []byte
+	// topics is guarded by the gateway's mu
+	topics map[string]struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Gateway tracks the sessions and their subscriptions. Events are per
+// process, a session only gets what is published on its server.
+type Gateway struct {
+	BufferSize   int
+	PingInterval time.Duration
+	// AuthorizeUserTopic, when set, is asked before userID subscribes to
+	// the chirps of authorID. An error refuses the subscription and is sent
+	// to the client.
+	AuthorizeUserTopic func(userID, authorID uuid.UUID) error
+
+	mu       sync.Mutex
+	topics   map[string]map[*session]struct{}
+	sessions map[*session]struct{}
+	closed   bool
+}
+
+func New() *Gateway {
+	return &Gateway{
+		BufferSize:   DefaultBufferSize,
+		PingInterval: DefaultPingInterval,
+		topics:       make(map[string]map[*session]struct{}),
+		sessions:     make(map[*session]struct{}),
+	}
+}
+
+// Serve runs the protocol for userID on conn until either side closes it
+func (g *Gateway) Serve(conn *websocket.Conn, userID uuid.UUID) {
+	conn.MaxMessageSize = maxClientMessageSize
+	// pongs to the write loop's pings keep quiet clients connected
+	conn.IdleTimeout = 2 * g.pingInterval()
+	s := &session{
+		conn:   conn,
+		userID: userID,
+		send:   make(chan []byte, g.bufferSize()),
+		topics: make(map[string]struct{}),
+		done:   make(chan struct{}),
+	}
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		conn.Close(websocket.CloseGoingAway, "server is shutting down")
+		return
+	}
+	g.sessions[s] = struct{}{}
+	g.mu.Unlock()
+	defer g.disconnect(s, websocket.CloseNormal, "")
+
+	go g.writeLoop(s)
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req Message
+		if messageType != websocket.TextMessage || json.Unmarshal(data, &req) != nil {
+			g.reply(s, Message{Type: TypeError, Error: "messages must be JSON text"})
+			continue
+		}
+		g.reply(s, g.handle(s, req))
+	}
+}
+
+// handle applies a client request and returns the reply
+func (g *Gateway) handle(s *session, req Message) Message {
+	switch req.Type {
+	case TypePing:
+		return Message{Type: TypePong, ID: req.ID}
+	case TypeSubscribe, TypeUnsubscribe:
+		topic, err := ParseTopic(req.Topic, s.userID)
+		if err != nil {
+			return Message{Type: TypeError, ID: req.ID, Error: err.Error()}
+		}
+		if authorID, ok := topicUserID(topic); ok && req.Type == TypeSubscribe && g.AuthorizeUserTopic != nil {
+			// asked before taking mu, it may be slow
+			if err := g.AuthorizeUserTopic(s.userID, authorID); err != nil {
+				return Message{Type: TypeError, ID: req.ID, Error: err.Error()}
+			}
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if _, ok := g.sessions[s]; !ok {
+			// dropped while the request was in flight
+			return Message{Type: TypeError, ID: req.ID, Error: "disconnected"}
+		}
+		if req.Type == TypeUnsubscribe {
+			g.unsubscribe(s, topic)
+			return Message{Type: TypeUnsubscribed, ID: req.ID, Topic: req.Topic}
+		}
+		if _, ok := s.topics[topic]; !ok && len(s.topics) >= MaxSubscriptions {
+			return Message{Type: TypeError, ID: req.ID, Error: fmt.Sprintf("at most %d subscriptions allowed", MaxSubscriptions)}
+		}
+		s.topics[topic] = struct{}{}
+		if g.topics[topic] == nil {
+			g.topics[topic] = make(map[*session]struct{})
+		}
+		g.topics[topic][s] = struct{}{}
+		return Message{Type: TypeSubscribed, ID: req.ID, Topic: req.Topic}
+	}
+	return Message{Type: TypeError, ID: req.ID, Error: fmt.Sprintf("unknown message type '%s'", req.Type)}
+}
+
+// reply queues a message for the session
+func (g *Gateway) reply(s *session, message Message) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.enqueue(s, data)
+}
+
+// Publish sends an event to every session subscribed to topic, except
+// those of excludedUserIDs. Sessions too far behind to take it are
+// disconnected.
+func (g *Gateway) Publish(topic, event string, data []byte, excludedUserIDs ...uuid.UUID) error {
+	message, err := json.Marshal(Message{
+		Type:  TypeEvent,
+		Topic: clientTopic(topic),
+		Event: event,
+		Data:  data,
+	})
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for s := range g.topics[topic] {
+		if slices.Contains(excludedUserIDs, s.userID) {
+			continue
+		}
+		g.enqueue(s, message)
+	}
+	return nil
+}
+
+// Close disconnects every session and refuses new ones
+func (g *Gateway) Close() {
+	g.mu.Lock()
+	g.closed = true
+	sessions := make([]*session, 0, len(g.sessions))
+	for s := range g.sessions {
+		sessions = append(sessions, s)
+	}
+	g.mu.Unlock()
+	for _, s := range sessions {
+		g.disconnect(s, websocket.CloseGoingAway, "server is shutting down")
+	}
+}
+
+// enqueue must be called with mu held
+func (g *Gateway) enqueue(s *session, message []byte) {
+	select {
+	case <-s.done:
+	case s.send <- message:
+	default:
+		// too slow, closing from here would block on the write so leave it
+		// to the write loop
+		s.stop()
+		g.remove(s)
+	}
+}
+
+func (g *Gateway) writeLoop(s *session) {
+	ticker := time.NewTicker(g.pingInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			s.conn.Close(websocket.CloseTryAgainLater, "too slow")
+			return
+		case <-ticker.C:
+			if err := s.conn.Ping(nil); err != nil {
+				g.disconnect(s, websocket.CloseGoingAway, "")
+				return
+			}
+		case message := <-s.send:
+			if err := s.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				g.disconnect(s, websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// disconnect drops the session and closes its connection
+func (g *Gateway) disconnect(s *session, code int, reason string) {
+	g.mu.Lock()
+	g.remove(s)
+	g.mu.Unlock()
+	s.stop()
+	s.conn.Close(code, reason)
+}
+
+// remove must be called with mu held
+func (g *Gateway) remove(s *session) {
+	delete(g.sessions, s)
+	for topic := range s.topics {
+		g.unsubscribe(s, topic)
+	}
+}
+
+// unsubscribe must be called with mu held
+func (g *Gateway) unsubscribe(s *session, topic string) {
+	delete(s.topics, topic)
+	delete(g.topics[topic], s)
+	if len(g.topics[topic]) == 0 {
+		delete(g.topics, topic)
+	}
+}
+
+func (s *session) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (g *Gateway) bufferSize() int {
+	if g.BufferSize > 0 {
+		return g.BufferSize
+	}
+	return DefaultBufferSize
+}
+
+func (g *Gateway) pingInterval() time.Duration {
+	if g.PingInterval > 0 {
+		return g.PingInterval
+	}
+	return DefaultPingInterval
+}
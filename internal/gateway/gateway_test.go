@@ -0,0 +1,398 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/maniac-en/chirpstack/internal/websocket"
+)
+
+// newServer serves g to clients identified by the user query parameter
+func newServer(t *testing.T, g *Gateway) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.URL.Query().Get("user"))
+		if err != nil {
+			http.Error(w, "no user", http.StatusBadRequest)
+			return
+		}
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		g.Serve(conn, userID)
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+type client struct {
+	conn *websocket.Conn
+}
+
+func dial(url string, userID uuid.UUID) (*client, error) {
+	conn, err := websocket.Dial(url+"?user="+userID.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &client{conn: conn}, nil
+}
+
+func (c *client) send(message Message) error {
+	data, _ := json.Marshal(message)
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *client) receive() (Message, error) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return Message{}, err
+	}
+	var message Message
+	err = json.Unmarshal(data, &message)
+	return message, err
+}
+
+// request sends a message and waits for the reply
+func (c *client) request(message Message) (Message, error) {
+	if err := c.send(message); err != nil {
+		return Message{}, err
+	}
+	return c.receive()
+}
+
+func TestParseTopic(t *testing.T) {
+	userID := uuid.New()
+	other := uuid.New()
+	tests := []struct {
+		topic   string
+		want    string
+		wantErr bool
+	}{
+		{topic: "timeline", want: "timeline:" + userID.String()},
+		{topic: "hashtag:GoLang", want: "hashtag:golang"},
+		{topic: "user:" + other.String(), want: "user:" + other.String()},
+		{topic: "hashtag:", wantErr: true},
+		{topic: "hashtag:two words", wantErr: true},
+		{topic: "user:nope", wantErr: true},
+		{topic: "timeline:" + other.String(), wantErr: true},
+		{topic: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTopic(tt.topic, userID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTopic(%q) error = %v, wantErr %v", tt.topic, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTopic(%q) = %q, want %q", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestGateway_Protocol(t *testing.T) {
+	g := New()
+	url := newServer(t, g)
+	userID := uuid.New()
+	c, err := dial(url, userID)
+	if err != nil {
+		t.Fatalf("dial() unexpected error = %v", err)
+	}
+	defer c.conn.Close(websocket.CloseNormal, "")
+
+	steps := []struct {
+		name string
+		req  Message
+		want Message
+	}{
+		{
+			name: "ping",
+			req:  Message{Type: TypePing, ID: "1"},
+			want: Message{Type: TypePong, ID: "1"},
+		},
+		{
+			name: "subscribe",
+			req:  Message{Type: TypeSubscribe, ID: "2", Topic: "timeline"},
+			want: Message{Type: TypeSubscribed, ID: "2", Topic: "timeline"},
+		},
+		{
+			name: "invalid topic",
+			req:  Message{Type: TypeSubscribe, ID: "3", Topic: "everything"},
+			want: Message{Type: TypeError, ID: "3", Error: "invalid topic 'everything', must be timeline, hashtag:<tag> or user:<id>"},
+		},
+		{
+			name: "unknown type",
+			req:  Message{Type: "shout", ID: "4"},
+			want: Message{Type: TypeError, ID: "4", Error: "unknown message type 'shout'"},
+		},
+	}
+	for _, step := range steps {
+		got, err := c.request(step.req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error = %v", step.name, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(step.want) {
+			t.Errorf("%s: got %+v, want %+v", step.name, got, step.want)
+		}
+	}
+
+	g.Publish(TimelineTopic(userID), "chirp.created", []byte(`{"body":"hi"}`))
+	got, err := c.receive()
+	if err != nil {
+		t.Fatalf("receive() unexpected error = %v", err)
+	}
+	if got.Type != TypeEvent || got.Topic != "timeline" || got.Event != "chirp.created" || string(got.Data) != `{"body":"hi"}` {
+		t.Errorf("got %+v, want the chirp on the timeline", got)
+	}
+
+	if got, err := c.request(Message{Type: TypeUnsubscribe, Topic: "timeline"}); err != nil || got.Type != TypeUnsubscribed {
+		t.Fatalf("unsubscribe got %+v, %v", got, err)
+	}
+	g.Publish(TimelineTopic(userID), "chirp.created", []byte(`{}`))
+	// the pong proves the event was skipped, replies keep their order
+	if got, err := c.request(Message{Type: TypePing}); err != nil || got.Type != TypePong {
+		t.Errorf("after unsubscribing got %+v, %v, want only the pong", got, err)
+	}
+
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatalf("WriteMessage() unexpected error = %v", err)
+	}
+	if got, err := c.receive(); err != nil || got.Error != "messages must be JSON text" {
+		t.Errorf("invalid JSON got %+v, %v", got, err)
+	}
+}
+
+func TestGateway_SubscriptionLimit(t *testing.T) {
+	g := New()
+	c, err := dial(newServer(t, g), uuid.New())
+	if err != nil {
+		t.Fatalf("dial() unexpected error = %v", err)
+	}
+	defer c.conn.Close(websocket.CloseNormal, "")
+
+	for i := range MaxSubscriptions {
+		if got, err := c.request(Message{Type: TypeSubscribe, Topic: fmt.Sprintf("hashtag:tag%d", i)}); err != nil || got.Type != TypeSubscribed {
+			t.Fatalf("subscription %d got %+v, %v", i, got, err)
+		}
+	}
+	got, err := c.request(Message{Type: TypeSubscribe, Topic: "hashtag:onetoomany"})
+	if err != nil || got.Type != TypeError {
+		t.Errorf("subscription over the limit got %+v, %v, want an error", got, err)
+	}
+	// subscribing again to a topic doesn't count
+	if got, err := c.request(Message{Type: TypeSubscribe, Topic: "hashtag:tag0"}); err != nil || got.Type != TypeSubscribed {
+		t.Errorf("repeated subscription got %+v, %v", got, err)
+	}
+}
+
+func TestGateway_Blocks(t *testing.T) {
+	authorID := uuid.New()
+	blockedID := uuid.New()
+	g := New()
+	g.AuthorizeUserTopic = func(userID, otherID uuid.UUID) error {
+		if userID == blockedID && otherID == authorID {
+			return errors.New("you can't subscribe to this user")
+		}
+		return nil
+	}
+	url := newServer(t, g)
+	blocked, err := dial(url, blockedID)
+	if err != nil {
+		t.Fatalf("dial() unexpected error = %v", err)
+	}
+	defer blocked.conn.Close(websocket.CloseNormal, "")
+
+	got, err := blocked.request(Message{Type: TypeSubscribe, Topic: "user:" + authorID.String()})
+	if err != nil || got.Type != TypeError || got.Error != "you can't subscribe to this user" {
+		t.Errorf("subscribing to the author got %+v, %v, want it refused", got, err)
+	}
+	if got, err := blocked.request(Message{Type: TypeSubscribe, Topic: "user:" + uuid.NewString()}); err != nil || got.Type != TypeSubscribed {
+		t.Errorf("subscribing to someone else got %+v, %v", got, err)
+	}
+	if got, err := blocked.request(Message{Type: TypeSubscribe, Topic: "hashtag:go"}); err != nil || got.Type != TypeSubscribed {
+		t.Fatalf("subscribing to a hashtag got %+v, %v", got, err)
+	}
+
+	// hashtags, and users subscribed before a block, are filtered when
+	// publishing
+	other, err := dial(url, uuid.New())
+	if err != nil {
+		t.Fatalf("dial() unexpected error = %v", err)
+	}
+	defer other.conn.Close(websocket.CloseNormal, "")
+	if got, err := other.request(Message{Type: TypeSubscribe, Topic: "hashtag:go"}); err != nil || got.Type != TypeSubscribed {
+		t.Fatalf("subscribing to a hashtag got %+v, %v", got, err)
+	}
+	g.Publish(HashtagTopic("go"), "chirp.created", []byte(`{}`), blockedID)
+	if got, err := other.receive(); err != nil || got.Type != TypeEvent {
+		t.Errorf("other user got %+v, %v, want the chirp", got, err)
+	}
+	// the pong proves the event was skipped, replies keep their order
+	if got, err := blocked.request(Message{Type: TypePing}); err != nil || got.Type != TypePong {
+		t.Errorf("excluded user got %+v, %v, want only the pong", got, err)
+	}
+}
+
+func TestGateway_ManyClients(t *testing.T) {
+	const clients = 100
+	const events = 20
+
+	g := New()
+	url := newServer(t, g)
+
+	userIDs := make([]uuid.UUID, clients)
+	conns := make([]*client, clients)
+	for i := range clients {
+		userIDs[i] = uuid.New()
+		c, err := dial(url, userIDs[i])
+		if err != nil {
+			t.Fatalf("dial() unexpected error = %v", err)
+		}
+		defer c.conn.Close(websocket.CloseNormal, "")
+		conns[i] = c
+	}
+
+	// everyone subscribes at once
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for _, c := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, topic := range []string{"hashtag:go", "timeline"} {
+				got, err := c.request(Message{Type: TypeSubscribe, Topic: topic})
+				if err == nil && got.Type != TypeSubscribed {
+					err = fmt.Errorf("subscribing to %s got %+v", topic, got)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// publishers race each other and the readers
+	for i := range events {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Publish(HashtagTopic("go"), "chirp.created", []byte(fmt.Sprintf(`{"n":%d}`, i)))
+		}()
+	}
+	for _, userID := range userIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Publish(TimelineTopic(userID), "chirp.created", []byte(`{}`))
+		}()
+	}
+
+	received := make(chan error, clients)
+	for _, c := range conns {
+		go func() {
+			hashtag, timeline := 0, 0
+			for hashtag < events || timeline < 1 {
+				got, err := c.receive()
+				if err != nil {
+					received <- fmt.Errorf("after %d hashtag and %d timeline events: %w", hashtag, timeline, err)
+					return
+				}
+				switch got.Topic {
+				case "hashtag:go":
+					hashtag++
+				case "timeline":
+					timeline++
+				}
+			}
+			if timeline != 1 {
+				received <- fmt.Errorf("got %d timeline events, want only the client's own", timeline)
+				return
+			}
+			received <- nil
+		}()
+	}
+	wg.Wait()
+	for range clients {
+		if err := <-received; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGateway_Close(t *testing.T) {
+	g := New()
+	url := newServer(t, g)
+	c, err := dial(url, uuid.New())
+	if err != nil {
+		t.Fatalf("dial() unexpected error = %v", err)
+	}
+	// wait until the session is registered
+	if _, err := c.request(Message{Type: TypePing}); err != nil {
+		t.Fatalf("ping unexpected error = %v", err)
+	}
+
+	g.Close()
+	_, err = c.receive()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("receive() after Close() error = %v, want close 1001", err)
+	}
+
+	// new sessions are turned away
+	c, err = dial(url, uuid.New())
+	if err != nil {
+		t.Fatalf("dial() unexpected error = %v", err)
+	}
+	if _, err := c.receive(); !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("receive() on a closed gateway error = %v, want close 1001", err)
+	}
+}
+
+func TestGateway_Keepalive(t *testing.T) {
+	g := New()
+	g.PingInterval = 20 * time.Millisecond
+	c, err := dial(newServer(t, g), uuid.New())
+	if err != nil {
+		t.Fatalf("dial() unexpected error = %v", err)
+	}
+	defer c.conn.Close(websocket.CloseNormal, "")
+
+	// reading answers the server's pings, which is all a quiet client does
+	replies := make(chan Message)
+	go func() {
+		defer close(replies)
+		for {
+			c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, data, err := c.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var message Message
+			json.Unmarshal(data, &message)
+			replies <- message
+		}
+	}()
+
+	time.Sleep(10 * g.PingInterval)
+	if err := c.send(Message{Type: TypePing, ID: "still here"}); err != nil {
+		t.Fatalf("send() unexpected error = %v", err)
+	}
+	if got, ok := <-replies; !ok || got.Type != TypePong {
+		t.Errorf("got %+v, want the session kept alive by pongs", got)
+	}
+}
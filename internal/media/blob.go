@@ -0,0 +1,90 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// ErrNotFound is returned for keys with no blob
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files by key. Keys are slash-separated and made
+// of lowercase letters, digits, dots, dashes and underscores.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns ErrNotFound if there is no blob for key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds if there is no blob for key
+	Delete(ctx context.Context, key string) error
+}
+
+var keyRegexp = regexp.MustCompile(`^[a-z0-9_-][a-z0-9._-]*(/[a-z0-9_-][a-z0-9._-]*)*$`)
+
+// ValidateKey rejects keys that could escape a directory or bucket prefix
+func ValidateKey(key string) error {
+	if len(key) > 256 || !keyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid blob key '%s'", key)
+	}
+	return nil
+}
+
+// FileStore keeps blobs as files under Dir
+type FileStore struct {
+	Dir string
+}
+
+func (s FileStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// written to a temporary file first, so readers never see part of it
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s FileStore) Delete(ctx context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
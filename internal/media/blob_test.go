@@ -0,0 +1,78 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	valid := []string{"abc", "0f3a/original", "0f3a/thumbnail.jpg", "a_b-c/d.e"}
+	invalid := []string{"", "/abs", "a/../b", "..", "a//b", "a/", ".hidden", "Upper", "a b", "a\\b"}
+	for _, key := range valid {
+		if err := ValidateKey(key); err != nil {
+			t.Errorf("ValidateKey(%q) unexpected error = %v", key, err)
+		}
+	}
+	for _, key := range invalid {
+		if err := ValidateKey(key); err == nil {
+			t.Errorf("ValidateKey(%q) expected an error", key)
+		}
+	}
+}
+
+// testBlobStore runs the BlobStore contract against store
+func testBlobStore(t *testing.T, store BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing/original"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing key error = %v, want ErrNotFound", err)
+	}
+	if err := store.Put(ctx, "abc/original", []byte("first"), "image/png"); err != nil {
+		t.Fatalf("Put() unexpected error = %v", err)
+	}
+	// putting again replaces the blob
+	if err := store.Put(ctx, "abc/original", []byte("second"), "image/png"); err != nil {
+		t.Fatalf("Put() unexpected error = %v", err)
+	}
+	r, err := store.Get(ctx, "abc/original")
+	if err != nil {
+		t.Fatalf("Get() unexpected error = %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "second" {
+		t.Errorf("Get() = %q, want %q", data, "second")
+	}
+
+	if err := store.Delete(ctx, "abc/original"); err != nil {
+		t.Fatalf("Delete() unexpected error = %v", err)
+	}
+	if _, err := store.Get(ctx, "abc/original"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "abc/original"); err != nil {
+		t.Errorf("Delete() of a missing key unexpected error = %v", err)
+	}
+
+	if err := store.Put(ctx, "../escape", []byte("x"), "image/png"); err == nil {
+		t.Error("Put() with an invalid key expected an error")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	testBlobStore(t, FileStore{Dir: dir})
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir + "/abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("FileStore left %d files behind", len(entries))
+	}
+}
@@ -0,0 +1,123 @@
+// Package media validates uploaded images, strips their metadata, makes
+// thumbnails and stores the results in a BlobStore.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	// registers the GIF decoder
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxSize is the largest upload accepted, in bytes
+	MaxSize = 5 << 20
+	// MaxPixels bounds the decoded size of an image, so a small file can't
+	// expand into gigabytes of pixels
+	MaxPixels = 40_000_000
+	// ThumbnailSize is the longest side of a thumbnail
+	ThumbnailSize = 320
+
+	jpegQuality = 90
+)
+
+var (
+	ErrTooLarge        = fmt.Errorf("media is larger than %d bytes", MaxSize)
+	ErrUnsupportedType = errors.New("unsupported media type, must be JPEG, PNG or GIF")
+	ErrTooManyPixels   = fmt.Errorf("image is larger than %d pixels", MaxPixels)
+	ErrInvalidImage    = errors.New("invalid image")
+)
+
+// Image is an upload ready to store: its metadata removed and a thumbnail
+// made
+type Image struct {
+	ContentType          string
+	Data                 []byte
+	Width                int
+	Height               int
+	Thumbnail            []byte
+	ThumbnailContentType string
+}
+
+// Process checks an upload by its content rather than its name or declared
+// type, removes EXIF and other metadata that can locate or identify the
+// uploader, and makes a thumbnail. JPEGs rotated through EXIF are rotated
+// for real, since the tag saying so is removed with the rest.
+func Process(data []byte) (*Image, error) {
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	orientation := 1
+	var stripped []byte
+	switch contentType {
+	case "image/jpeg":
+		stripped, orientation, err = stripJPEG(data)
+	case "image/png":
+		stripped, err = stripPNG(data)
+	case "image/gif":
+		stripped, err = stripGIF(data)
+	}
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	// decodes the first frame of GIFs
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	result := &Image{
+		ContentType: contentType,
+		Data:        stripped,
+		Width:       config.Width,
+		Height:      config.Height,
+	}
+	if orientation != 1 {
+		img = orient(img, orientation)
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		result.Data = b.Bytes()
+		result.Width, result.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	var thumbnail bytes.Buffer
+	small := Thumbnail(img, ThumbnailSize)
+	if contentType == "image/jpeg" {
+		result.ThumbnailContentType = "image/jpeg"
+		err = jpeg.Encode(&thumbnail, small, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		// PNG keeps transparency
+		result.ThumbnailContentType = "image/png"
+		err = png.Encode(&thumbnail, small)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Thumbnail = thumbnail.Bytes()
+	return result, nil
+}
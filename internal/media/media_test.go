@@ -0,0 +1,246 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// exifSegment is an APP1 segment holding only an orientation, big-endian
+func exifSegment(orientation uint16) []byte {
+	payload := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08")
+	payload = binary.BigEndian.AppendUint16(payload, 1)
+	payload = binary.BigEndian.AppendUint16(payload, exifOrientationTag)
+	payload = binary.BigEndian.AppendUint16(payload, 3) // SHORT
+	payload = binary.BigEndian.AppendUint32(payload, 1)
+	payload = binary.BigEndian.AppendUint16(payload, orientation)
+	payload = append(payload, 0, 0, 0, 0, 0, 0)
+
+	segment := []byte{0xff, markerAPP1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// withSegments inserts JPEG segments right after the start of image
+func withSegments(jpegData []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, jpegData[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, jpegData[2:]...)
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// pngChunk builds a chunk with its CRC
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestProcess_JPEG(t *testing.T) {
+	plain := encodeJPEG(t, testImage(400, 200))
+	comment := []byte{0xff, markerCOM, 0x00, 0x0c, 'G', 'P', 'S', ' ', 's', 'e', 'c', 'r', 'e', 't'}
+
+	t.Run("metadata is removed", func(t *testing.T) {
+		got, err := Process(withSegments(plain, exifSegment(1), comment))
+		if err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+		if !bytes.Equal(got.Data, plain) {
+			t.Error("Process() kept metadata segments, want the image as encoded")
+		}
+		if got.ContentType != "image/jpeg" || got.Width != 400 || got.Height != 200 {
+			t.Errorf("Process() = %s %dx%d, want image/jpeg 400x200", got.ContentType, got.Width, got.Height)
+		}
+		thumbnail, err := jpeg.Decode(bytes.NewReader(got.Thumbnail))
+		if err != nil {
+			t.Fatalf("thumbnail isn't a JPEG: %v", err)
+		}
+		if b := thumbnail.Bounds(); b.Dx() != 320 || b.Dy() != 160 {
+			t.Errorf("thumbnail is %dx%d, want 320x160", b.Dx(), b.Dy())
+		}
+	})
+
+	t.Run("rotated through EXIF", func(t *testing.T) {
+		got, err := Process(withSegments(plain, exifSegment(6)))
+		if err != nil {
+			t.Fatalf("Process() unexpected error = %v", err)
+		}
+		if bytes.Contains(got.Data, []byte("Exif")) {
+			t.Error("Process() kept the EXIF segment")
+		}
+		if got.Width != 200 || got.Height != 400 {
+			t.Errorf("Process() = %dx%d, want the rotated 200x400", got.Width, got.Height)
+		}
+		decoded, err := jpeg.Decode(bytes.NewReader(got.Data))
+		if err != nil {
+			t.Fatalf("rotated image isn't a JPEG: %v", err)
+		}
+		if b := decoded.Bounds(); b.Dx() != 200 || b.Dy() != 400 {
+			t.Errorf("rotated image is %dx%d, want 200x400", b.Dx(), b.Dy())
+		}
+	})
+}
+
+func TestProcess_PNG(t *testing.T) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, testImage(50, 20)); err != nil {
+		t.Fatal(err)
+	}
+	plain := b.Bytes()
+	// after the signature and IHDR
+	ihdrEnd := len(pngSignature) + 12 + 13
+	tagged := append(append(append([]byte{}, plain[:ihdrEnd]...), pngChunk("tEXt", []byte("Author\x00someone"))...), plain[ihdrEnd:]...)
+
+	got, err := Process(tagged)
+	if err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if !bytes.Equal(got.Data, plain) {
+		t.Error("Process() kept the tEXt chunk")
+	}
+	if got.ThumbnailContentType != "image/png" {
+		t.Errorf("thumbnail type = %s, want image/png", got.ThumbnailContentType)
+	}
+	thumbnail, err := png.Decode(bytes.NewReader(got.Thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail isn't a PNG: %v", err)
+	}
+	if b := thumbnail.Bounds(); b.Dx() != 50 || b.Dy() != 20 {
+		t.Errorf("thumbnail of a small image is %dx%d, want the same 50x20", b.Dx(), b.Dy())
+	}
+}
+
+func TestProcess_GIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	var b bytes.Buffer
+	err := gif.EncodeAll(&b, &gif.GIF{
+		Image:     []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 10, 10), palette), image.NewPaletted(image.Rect(0, 0, 10, 10), palette)},
+		Delay:     []int{10, 10},
+		LoopCount: 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := b.Bytes()
+	// a comment right before the trailer
+	commented := append(append([]byte{}, plain[:len(plain)-1]...), gifExtension, gifComment, 6, 's', 'e', 'c', 'r', 'e', 't', 0, gifTrailer)
+
+	got, err := Process(commented)
+	if err != nil {
+		t.Fatalf("Process() unexpected error = %v", err)
+	}
+	if !bytes.Equal(got.Data, plain) {
+		t.Error("Process() kept the comment")
+	}
+	animation, err := gif.DecodeAll(bytes.NewReader(got.Data))
+	if err != nil || len(animation.Image) != 2 {
+		t.Errorf("stripped GIF has %v, %v, want both frames", animation, err)
+	}
+}
+
+func TestProcess_Rejects(t *testing.T) {
+	// an IHDR claiming 10000x10000 pixels
+	ihdr := binary.BigEndian.AppendUint32(nil, 10000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 10000)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0)
+	huge := append(append([]byte{}, pngSignature...), pngChunk("IHDR", ihdr)...)
+
+	truncated := encodeJPEG(t, testImage(10, 10))[:100]
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "text", data: []byte("hello world"), want: ErrUnsupportedType},
+		{name: "svg", data: []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), want: ErrUnsupportedType},
+		{name: "too many pixels", data: huge, want: ErrTooManyPixels},
+		{name: "truncated", data: truncated, want: ErrInvalidImage},
+		{name: "too large", data: make([]byte, MaxSize+1), want: ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Process() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		w, h         int
+		wantW, wantH int
+	}{
+		{w: 1000, h: 500, wantW: 320, wantH: 160},
+		{w: 500, h: 1000, wantW: 160, wantH: 320},
+		{w: 100, h: 50, wantW: 100, wantH: 50},
+		{w: 5000, h: 3, wantW: 320, wantH: 1},
+	}
+	for _, tt := range tests {
+		got := Thumbnail(testImage(tt.w, tt.h), ThumbnailSize).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("Thumbnail() of %dx%d is %dx%d, want %dx%d", tt.w, tt.h, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+
+	// averaging a black and white checkerboard gives grey
+	checkers := image.NewGray(image.Rect(0, 0, 2, 2))
+	checkers.Pix = []uint8{0, 255, 255, 0}
+	if got := Thumbnail(checkers, 1).NRGBAAt(0, 0); got.R < 120 || got.R > 135 {
+		t.Errorf("Thumbnail() of a checkerboard = %v, want grey", got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// a 2x1 image, red then blue
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	src.SetNRGBA(0, 0, red)
+	src.SetNRGBA(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		// positions of red and blue afterwards
+		red, blue image.Point
+	}{
+		{orientation: 2, red: image.Pt(1, 0), blue: image.Pt(0, 0)},
+		{orientation: 3, red: image.Pt(1, 0), blue: image.Pt(0, 0)},
+		{orientation: 6, red: image.Pt(0, 0), blue: image.Pt(0, 1)},
+		{orientation: 8, red: image.Pt(0, 1), blue: image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		if got.At(tt.red.X, tt.red.Y) != color.Color(red) || got.At(tt.blue.X, tt.blue.Y) != color.Color(blue) {
+			t.Errorf("orient(%d) put red and blue in the wrong places", tt.orientation)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errTruncated = errors.New("truncated image")
+
+// JPEG markers
+const (
+	markerSOS  = 0xda
+	markerEOI  = 0xd9
+	markerAPP1 = 0xe1 // EXIF and XMP
+	markerIPTC = 0xed // APP13, Photoshop and IPTC
+	markerCOM  = 0xfe
+)
+
+const exifOrientationTag = 0x0112
+
+// stripJPEG drops the segments carrying metadata and returns the EXIF
+// orientation they held, 1 if none. Color profiles (APP2) and the Adobe
+// color transform (APP14) are kept since decoders need them.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, 0, errTruncated
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	orientation := 1
+	i := 2
+	for {
+		// markers may be padded with any number of 0xff
+		for i < len(data) && data[i] == 0xff && i+1 < len(data) && data[i+1] == 0xff {
+			i++
+		}
+		if i+1 >= len(data) || data[i] != 0xff {
+			return nil, 0, errTruncated
+		}
+		marker := data[i+1]
+		if marker == markerSOS || marker == markerEOI {
+			// the entropy-coded image data and everything after it
+			return append(out, data[i:]...), orientation, nil
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			// standalone markers have no length
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, 0, errTruncated
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, 0, errTruncated
+		}
+		switch marker {
+		case markerAPP1:
+			if o := exifOrientation(data[i+4 : end]); o != 0 {
+				orientation = o
+			}
+		case markerIPTC, markerCOM:
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// exifOrientation reads the orientation from an APP1 payload, 0 if it
+// isn't EXIF or has no valid orientation
+func exifOrientation(payload []byte) int {
+	tiff, ok := bytes.CutPrefix(payload, []byte("Exif\x00\x00"))
+	if !ok || len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := range entries {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		// a SHORT, stored at the start of the value field
+		if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+			return o
+		}
+		return 0
+	}
+	return 0
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// chunks that hold text, EXIF or a timestamp
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG drops the metadata chunks
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errTruncated
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, errTruncated
+		}
+		// length, type, data and CRC
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i+12 {
+			return nil, errTruncated
+		}
+		chunkType := string(data[i+4 : i+8])
+		if !pngMetadataChunks[chunkType] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out, nil
+}
+
+// GIF block introducers
+const (
+	gifExtension  = 0x21
+	gifImage      = 0x2c
+	gifTrailer    = 0x3b
+	gifComment    = 0xfe
+	gifAppExt     = 0xff
+	gifNetscape   = "NETSCAPE2.0"
+	gifColorTable = 0x80
+)
+
+// stripGIF drops comments and application extensions, which is where XMP
+// lives, except the one setting how often an animation loops
+func stripGIF(data []byte) ([]byte, error) {
+	// header and logical screen descriptor
+	if len(data) < 13 {
+		return nil, errTruncated
+	}
+	i := 13
+	if data[10]&gifColorTable != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, errTruncated
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+
+	// skipSubBlocks returns the end of the sub-blocks starting at j
+	skipSubBlocks := func(j int) (int, error) {
+		for {
+			if j >= len(data) {
+				return 0, errTruncated
+			}
+			size := int(data[j])
+			j += 1 + size
+			if size == 0 {
+				return j, nil
+			}
+		}
+	}
+
+	for {
+		if i >= len(data) {
+			return nil, errTruncated
+		}
+		switch data[i] {
+		case gifTrailer:
+			return append(out, gifTrailer), nil
+		case gifExtension:
+			if i+2 > len(data) {
+				return nil, errTruncated
+			}
+			end, err := skipSubBlocks(i + 2)
+			if err != nil {
+				return nil, err
+			}
+			keep := true
+			switch data[i+1] {
+			case gifComment:
+				keep = false
+			case gifAppExt:
+				keep = i+3+len(gifNetscape) <= len(data) && string(data[i+3:i+3+len(gifNetscape)]) == gifNetscape
+			}
+			if keep {
+				out = append(out, data[i:end]...)
+			}
+			i = end
+		case gifImage:
+			// descriptor, optional local color table, LZW code size, data
+			if i+10 > len(data) {
+				return nil, errTruncated
+			}
+			j := i + 10
+			if data[i+9]&gifColorTable != 0 {
+				j += 3 << (data[i+9]&0x07 + 1)
+			}
+			end, err := skipSubBlocks(j + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, data[i:end]...)
+			i = end
+		default:
+			return nil, errTruncated
+		}
+	}
+}
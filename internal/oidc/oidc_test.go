@@ -0,0 +1,178 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/maniac-en/chirpstack/internal/oidc"
+	"github.com/maniac-en/chirpstack/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/api/auth/mock/callback"
+
+func newProvider(t *testing.T, srv *oidctest.Server, clientSecret string) *oidc.Provider {
+	t.Helper()
+	provider, err := oidc.Discover(context.Background(), "mock", oidc.Config{
+		Issuer:       srv.Issuer(),
+		ClientID:     srv.ClientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}, srv.Client())
+	if err != nil {
+		t.Fatalf("Discover() unexpected error = %v", err)
+	}
+	return provider
+}
+
+// authorize follows the provider's authorization endpoint and returns the
+// code and state it redirects back with
+func authorize(t *testing.T, srv *oidctest.Server, authURL string) (string, string) {
+	t.Helper()
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET authorization endpoint unexpected error = %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorization endpoint status = %d, want %d", res.StatusCode, http.StatusFound)
+	}
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect location: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatalf("redirected to %s, want %s", location, redirectURL)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	srv := oidctest.NewServer("chirpstack", "s3cret")
+	defer srv.Close()
+	srv.SetUser(oidctest.User{
+		Subject:       "user-123",
+		Email:         "oidc.user@example.com",
+		EmailVerified: true,
+		Name:          "OIDC User",
+	})
+	provider := newProvider(t, srv, "s3cret")
+
+	verifier, _ := oidc.RandomString()
+	nonce, _ := oidc.RandomString()
+	code, state := authorize(t, srv, provider.AuthCodeURL("the-state", nonce, verifier))
+	if state != "the-state" {
+		t.Errorf("state = %q, want %q", state, "the-state")
+	}
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange() unexpected error = %v", err)
+	}
+	if claims.Subject != "user-123" || claims.Email != "oidc.user@example.com" || !claims.EmailVerified {
+		t.Errorf("Exchange() claims = %+v, want the mock user", claims)
+	}
+
+	// codes are single use
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Error("Exchange() reusing a code expected error but got none")
+	}
+}
+
+func TestExchangeRejections(t *testing.T) {
+	srv := oidctest.NewServer("chirpstack", "s3cret")
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		clientSecret string
+		verifier     func(string) string
+		nonce        func(string) string
+	}{
+		{
+			name:         "wrong code verifier",
+			clientSecret: "s3cret",
+			verifier:     func(string) string { return "not-the-verifier" },
+			nonce:        func(n string) string { return n },
+		},
+		{
+			name:         "wrong nonce",
+			clientSecret: "s3cret",
+			verifier:     func(v string) string { return v },
+			nonce:        func(string) string { return "replayed-nonce" },
+		},
+		{
+			name:         "wrong client secret",
+			clientSecret: "guess",
+			verifier:     func(v string) string { return v },
+			nonce:        func(n string) string { return n },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newProvider(t, srv, tt.clientSecret)
+			verifier, _ := oidc.RandomString()
+			nonce, _ := oidc.RandomString()
+			code, _ := authorize(t, srv, provider.AuthCodeURL("state", nonce, verifier))
+
+			_, err := provider.Exchange(context.Background(), code, tt.verifier(verifier), tt.nonce(nonce))
+			if err == nil {
+				t.Error("Exchange() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestVerifyIDToken_RejectsForeignIssuer(t *testing.T) {
+	trusted := oidctest.NewServer("chirpstack", "s3cret")
+	defer trusted.Close()
+	rogue := oidctest.NewServer("chirpstack", "s3cret")
+	defer rogue.Close()
+
+	// get a genuine token from the rogue provider...
+	rogueProvider := newProvider(t, rogue, "s3cret")
+	verifier, _ := oidc.RandomString()
+	code, _ := authorize(t, rogue, rogueProvider.AuthCodeURL("state", "nonce", verifier))
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {"chirpstack"},
+		"client_secret": {"s3cret"},
+		"code_verifier": {verifier},
+	}
+	res, err := rogue.Client().PostForm(rogue.URL+"/token", form)
+	if err != nil {
+		t.Fatalf("POST token endpoint unexpected error = %v", err)
+	}
+	defer res.Body.Close()
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding token response: %v", err)
+	}
+
+	// ...and present it to a relying party that trusts another one
+	trustedProvider := newProvider(t, trusted, "s3cret")
+	if _, err := trustedProvider.VerifyIDToken(context.Background(), body.IDToken, "nonce"); err == nil {
+		t.Error("VerifyIDToken() accepted a token signed by another provider")
+	}
+}
+
+func TestCodeChallengeS256(t *testing.T) {
+	// test vector from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := oidc.CodeChallengeS256(verifier); got != want {
+		t.Errorf("CodeChallengeS256() = %q, want %q", got, want)
+	}
+}
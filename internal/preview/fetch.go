@@ -0,0 +1,198 @@
+// Package preview builds link previews for URLs in chirps from the
+// OpenGraph and Twitter card metadata of the pages they point to. Pages are
+// fetched by a pool of workers through a client that refuses to connect to
+// private, loopback and other non-public addresses, so chirps can't be used
+// to probe the network the server runs in.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+	// DefaultMaxBodySize is how much of a page is read, metadata is
+	// expected in its head
+	DefaultMaxBodySize = 512 << 10
+	// maxRedirects is how many redirects are followed
+	maxRedirects = 5
+	userAgent    = "ChirpstackBot/1.0 (link previews)"
+)
+
+var (
+	// ErrBlocked is returned for URLs whose host resolves to an address
+	// that isn't public
+	ErrBlocked = errors.New("address not allowed")
+	// ErrNotHTML is returned for pages that aren't HTML
+	ErrNotHTML = errors.New("not an HTML page")
+	// ErrNoMetadata is returned for pages with nothing to preview
+	ErrNoMetadata = errors.New("no preview metadata")
+)
+
+// blockedPrefixes are the special-purpose ranges of the IANA registries,
+// none of them reachable on the public internet
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	// NAT64 and 6to4 embed IPv4 addresses, private ones included
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// IsBlocked reports whether addr is outside the public internet
+func IsBlocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetcher fetches pages and extracts their preview
+type Fetcher struct {
+	Client      *http.Client
+	MaxBodySize int64
+}
+
+// NewFetcher returns a fetcher with the default limits whose client only
+// connects to public addresses
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client:      newClient(DefaultTimeout, IsBlocked),
+		MaxBodySize: DefaultMaxBodySize,
+	}
+}
+
+// NewDialer returns a dialer refusing to connect to the addresses blocked
+// reports. The check runs on the address actually dialed, after DNS
+// resolution, so a hostname can't be pointed at a private address between
+// a check and the connection. Clients using it must not use a proxy, which
+// would dial on their behalf.
+func NewDialer(timeout time.Duration, blocked func(netip.Addr) bool) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if blocked(addrPort.Addr()) {
+				return fmt.Errorf("dialing %s: %w", address, ErrBlocked)
+			}
+			return nil
+		},
+	}
+}
+
+// newClient returns a client that only connects where blocked allows and
+// only follows redirects to http and https URLs
+func newClient(timeout time.Duration, blocked func(netip.Addr) bool) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy from the environment, it would dial on our behalf
+			Proxy:                 nil,
+			DialContext:           NewDialer(timeout, blocked).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkURL(req.URL)
+		},
+	}
+}
+
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+// Fetch gets the page at rawURL and returns its preview
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Preview{}, err
+	}
+	if err := checkURL(u); err != nil {
+		return Preview{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Preview{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	res, err := f.Client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("status %d", res.StatusCode)
+	}
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return Preview{}, ErrNotHTML
+	}
+
+	maxBodySize := f.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return Preview{}, err
+	}
+
+	// relative image URLs are relative to where redirects ended up
+	preview := Parse(string(body), res.Request.URL)
+	if preview.Title == "" && preview.Description == "" {
+		return Preview{}, ErrNoMetadata
+	}
+	preview.URL = rawURL
+	return preview, nil
+}
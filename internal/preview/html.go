@@ -0,0 +1,201 @@
+package preview
+
+import (
+	"html"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// limits on what's kept of a page's metadata, in characters
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+	maxSiteNameLength    = 100
+	maxImageURLLength    = 2048
+)
+
+// Preview is what a page says about itself
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+// metadata keys in order of preference, the first one found wins
+var (
+	titleKeys       = []string{"og:title", "twitter:title"}
+	descriptionKeys = []string{"og:description", "twitter:description", "description"}
+	imageKeys       = []string{"og:image", "og:image:secure_url", "og:image:url", "twitter:image", "twitter:image:src"}
+	siteNameKeys    = []string{"og:site_name"}
+)
+
+// Parse extracts a preview from the <meta> tags and <title> of an HTML
+// document, resolving a relative image URL against base. It only scans
+// tags, which is all the metadata needs, and stops at the end of the head.
+func Parse(doc string, base *url.URL) Preview {
+	meta := make(map[string]string)
+	var title string
+	for i := 0; i < len(doc); {
+		start := strings.IndexByte(doc[i:], '<')
+		if start < 0 {
+			break
+		}
+		i += start
+		if strings.HasPrefix(doc[i:], "<!--") {
+			end := strings.Index(doc[i:], "-->")
+			if end < 0 {
+				break
+			}
+			i += end + len("-->")
+			continue
+		}
+
+		name, attrs, end := parseTag(doc[i:])
+		i += end
+		switch name {
+		case "meta":
+			key := strings.ToLower(attrs["property"])
+			if key == "" {
+				key = strings.ToLower(attrs["name"])
+			}
+			if _, ok := meta[key]; key != "" && !ok {
+				meta[key] = attrs["content"]
+			}
+		case "title":
+			text, after := textUntil(doc[i:], "title")
+			if title == "" {
+				title = text
+			}
+			i += after
+		case "script", "style":
+			// their text could hold anything that looks like a tag
+			_, after := textUntil(doc[i:], name)
+			i += after
+		case "/head", "body":
+			i = len(doc)
+		}
+	}
+
+	preview := Preview{
+		Title:       clean(first(meta, titleKeys), maxTitleLength),
+		Description: clean(first(meta, descriptionKeys), maxDescriptionLength),
+		SiteName:    clean(first(meta, siteNameKeys), maxSiteNameLength),
+	}
+	if preview.Title == "" {
+		preview.Title = clean(title, maxTitleLength)
+	}
+	if image := first(meta, imageKeys); image != "" && base != nil {
+		if u, err := base.Parse(strings.TrimSpace(html.UnescapeString(image))); err == nil &&
+			(u.Scheme == "http" || u.Scheme == "https") && len(u.String()) <= maxImageURLLength {
+			preview.ImageURL = u.String()
+		}
+	}
+	return preview
+}
+
+func first(meta map[string]string, keys []string) string {
+	for _, key := range keys {
+		if v := meta[key]; strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean unescapes entities, collapses whitespace and truncates to max
+// characters
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
+
+// parseTag reads the tag at the start of s, returning its lowercased name
+// (with a leading / for end tags), its attributes and where it ends
+func parseTag(s string) (string, map[string]string, int) {
+	i := 1
+	nameStart := i
+	for i < len(s) && !isSpace(s[i]) && s[i] != '>' && !(s[i] == '/' && i > nameStart) {
+		i++
+	}
+	name := strings.ToLower(s[nameStart:i])
+
+	attrs := make(map[string]string)
+	for i < len(s) {
+		for i < len(s) && (isSpace(s[i]) || s[i] == '/') {
+			i++
+		}
+		if i >= len(s) || s[i] == '>' {
+			break
+		}
+		keyStart := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		key := strings.ToLower(s[keyStart:i])
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) || s[i] != '=' {
+			attrs[key] = ""
+			continue
+		}
+		i++
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		var value string
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			quote := s[i]
+			end := strings.IndexByte(s[i+1:], quote)
+			if end < 0 {
+				return name, attrs, len(s)
+			}
+			value = s[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			valueStart := i
+			for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+				i++
+			}
+			value = s[valueStart:i]
+		}
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = value
+		}
+	}
+	if i < len(s) {
+		i++
+	}
+	return name, attrs, i
+}
+
+// textUntil returns the text before the end tag of name and where that tag
+// ends
+func textUntil(s, name string) (string, int) {
+	for end := 0; ; {
+		next := strings.Index(s[end:], "</")
+		if next < 0 {
+			return s, len(s)
+		}
+		end += next
+		if rest := s[end+2:]; len(rest) >= len(name) && strings.EqualFold(rest[:len(name)], name) {
+			after := strings.IndexByte(s[end:], '>')
+			if after < 0 {
+				return s[:end], len(s)
+			}
+			return s[:end], end + after + 1
+		}
+		end += 2
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,105 @@
+package preview
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWorkers   = 4
+	DefaultQueueSize = 100
+	// RefreshAfter is how long a preview is used before its page is
+	// fetched again
+	RefreshAfter = 7 * 24 * time.Hour
+	// RetryAfter is how long a page that couldn't be previewed waits
+	// before it's tried again
+	RetryAfter = time.Hour
+)
+
+// Store keeps fetched previews
+type Store interface {
+	// Save records the preview of url, or that it has none if preview is
+	// nil
+	Save(ctx context.Context, url string, preview *Preview) error
+}
+
+// Pool fetches previews in the background with a fixed number of workers.
+// Fetching is best effort: URLs are dropped when the queue is full, and
+// whatever is queued when the pool stops is lost.
+type Pool struct {
+	Fetcher *Fetcher
+	Store   Store
+	Workers int
+
+	jobs    chan string
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func NewPool(fetcher *Fetcher, store Store) *Pool {
+	return &Pool{
+		Fetcher: fetcher,
+		Store:   store,
+		Workers: DefaultWorkers,
+		jobs:    make(chan string, DefaultQueueSize),
+		pending: make(map[string]bool),
+	}
+}
+
+// Enqueue queues url to be fetched, unless it already is or the queue is
+// full. It never blocks.
+func (p *Pool) Enqueue(url string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending[url] {
+		return false
+	}
+	select {
+	case p.jobs <- url:
+		p.pending[url] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// Run fetches queued URLs until ctx is done
+func (p *Pool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range max(1, p.Workers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case url := <-p.jobs:
+					p.fetch(ctx, url)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Pool) fetch(ctx context.Context, url string) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, url)
+		p.mu.Unlock()
+	}()
+
+	var saved *Preview
+	preview, err := p.Fetcher.Fetch(ctx, url)
+	if err == nil {
+		saved = &preview
+	} else if ctx.Err() != nil {
+		return
+	}
+	if err := p.Store.Save(ctx, url, saved); err != nil {
+		log.Printf("link previews: saving %s: %v", url, err)
+	}
+}
@@ -0,0 +1,309 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFetcher can reach loopback test servers and nothing else that
+// IsBlocked refuses
+func testFetcher(timeout time.Duration) *Fetcher {
+	return &Fetcher{
+		Client: newClient(timeout, func(addr netip.Addr) bool {
+			return !addr.IsLoopback() && IsBlocked(addr)
+		}),
+		MaxBodySize: 4 << 10,
+	}
+}
+
+const ogPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>Fallback title</title>
+<!-- <meta property="og:title" content="commented out"> -->
+<meta property="og:title" content="Gophers &amp; friends">
+<meta name="twitter:title" content="Twitter title">
+<meta property="og:description" content="  All about
+  gophers. ">
+<meta property="og:image" content="/images/gopher.png">
+<meta property=og:site_name content=Gopherpedia>
+<script>var s = '<meta property="og:description" content="from a script">';</script>
+</head>
+<body><meta property="og:title" content="in the body"></body>
+</html>`
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/articles/gophers")
+	tests := []struct {
+		name string
+		doc  string
+		want Preview
+	}{
+		{
+			name: "opengraph",
+			doc:  ogPage,
+			want: Preview{
+				Title:       "Gophers & friends",
+				Description: "All about gophers.",
+				ImageURL:    "https://example.com/images/gopher.png",
+				SiteName:    "Gopherpedia",
+			},
+		},
+		{
+			name: "twitter card",
+			doc: `<head><META NAME="twitter:title" CONTENT="Card title"/>
+				<meta name='twitter:description' content='Card description'/>
+				<meta name="twitter:image" content="https://cdn.example.com/card.jpg"/></head>`,
+			want: Preview{
+				Title:       "Card title",
+				Description: "Card description",
+				ImageURL:    "https://cdn.example.com/card.jpg",
+			},
+		},
+		{
+			name: "plain page",
+			doc:  `<html><head><TITLE>Just a title</TITLE><meta name="description" content="A description"></head></html>`,
+			want: Preview{Title: "Just a title", Description: "A description"},
+		},
+		{
+			name: "unsafe image scheme",
+			doc:  `<meta property="og:title" content="t"><meta property="og:image" content="javascript:alert(1)">`,
+			want: Preview{Title: "t"},
+		},
+		{
+			name: "truncated",
+			doc:  `<meta property="og:title" content="` + strings.Repeat("a", 300) + `">`,
+			want: Preview{Title: strings.Repeat("a", 199) + "…"},
+		},
+		{
+			name: "unterminated",
+			doc:  `<head><meta property="og:title" content="never closed`,
+			want: Preview{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.doc, base); got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBlocked(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "127.0.0.1", want: true},
+		{addr: "10.1.2.3", want: true},
+		{addr: "172.31.255.255", want: true},
+		{addr: "192.168.1.1", want: true},
+		{addr: "169.254.169.254", want: true},
+		{addr: "100.64.0.1", want: true},
+		{addr: "0.0.0.0", want: true},
+		{addr: "::1", want: true},
+		{addr: "::ffff:127.0.0.1", want: true},
+		{addr: "fd00::1", want: true},
+		{addr: "fe80::1", want: true},
+		{addr: "64:ff9b::a00:1", want: true},
+		{addr: "93.184.216.34", want: false},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsBlocked(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsBlocked(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("User-Agent = %q, want %q", r.Header.Get("User-Agent"), userAgent)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(ogPage))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/private-redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://10.0.0.1/", http.StatusFound)
+	})
+	mux.HandleFunc("/file-redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		// the metadata is past the part that's read
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<head>" + strings.Repeat(" ", 8<<10) + `<meta property="og:title" content="too late">`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := testFetcher(500 * time.Millisecond)
+
+	t.Run("preview", func(t *testing.T) {
+		for _, path := range []string{"/page", "/moved"} {
+			got, err := fetcher.Fetch(t.Context(), server.URL+path)
+			if err != nil {
+				t.Fatalf("Fetch(%s) unexpected error = %v", path, err)
+			}
+			want := Preview{
+				URL:         server.URL + path,
+				Title:       "Gophers & friends",
+				Description: "All about gophers.",
+				ImageURL:    server.URL + "/images/gopher.png",
+				SiteName:    "Gopherpedia",
+			}
+			if got != want {
+				t.Errorf("Fetch(%s) = %+v, want %+v", path, got, want)
+			}
+		}
+	})
+
+	tests := []struct {
+		name string
+		url  string
+		want error
+	}{
+		{name: "redirect to a private address", url: server.URL + "/private-redirect", want: ErrBlocked},
+		{name: "not HTML", url: server.URL + "/image", want: ErrNotHTML},
+		{name: "metadata past the size cap", url: server.URL + "/huge", want: ErrNoMetadata},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := fetcher.Fetch(t.Context(), tt.url); !errors.Is(err, tt.want) {
+				t.Errorf("Fetch() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("other failures", func(t *testing.T) {
+		for _, path := range []string{"/file-redirect", "/missing"} {
+			if _, err := fetcher.Fetch(t.Context(), server.URL+path); err == nil {
+				t.Errorf("Fetch(%s) succeeded, want an error", path)
+			}
+		}
+		if _, err := fetcher.Fetch(t.Context(), "file:///etc/passwd"); err == nil {
+			t.Error("Fetch() of a file URL succeeded, want an error")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		if _, err := fetcher.Fetch(t.Context(), server.URL+"/slow"); err == nil {
+			t.Error("Fetch() of a slow page succeeded, want a timeout")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Fetch() took %v, want it to give up after 500ms", elapsed)
+		}
+	})
+
+	t.Run("loopback blocked by default", func(t *testing.T) {
+		if _, err := NewFetcher().Fetch(t.Context(), server.URL+"/page"); !errors.Is(err, ErrBlocked) {
+			t.Errorf("Fetch() error = %v, want %v", err, ErrBlocked)
+		}
+	})
+}
+
+type fakeStore struct {
+	mu    sync.Mutex
+	saved map[string]*Preview
+	done  chan string
+}
+
+func (s *fakeStore) Save(ctx context.Context, url string, preview *Preview) error {
+	s.mu.Lock()
+	s.saved[url] = preview
+	s.mu.Unlock()
+	s.done <- url
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/page" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(ogPage))
+	}))
+	defer server.Close()
+
+	store := &fakeStore{saved: make(map[string]*Preview), done: make(chan string, 10)}
+	pool := NewPool(testFetcher(time.Second), store)
+	ctx, cancel := context.WithCancel(t.Context())
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	if !pool.Enqueue(server.URL + "/page") {
+		t.Fatal("Enqueue() = false, want the URL queued")
+	}
+	pool.Enqueue(server.URL + "/missing")
+	for range 2 {
+		select {
+		case <-store.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the pool")
+		}
+	}
+
+	store.mu.Lock()
+	if got := store.saved[server.URL+"/page"]; got == nil || got.Title != "Gophers & friends" {
+		t.Errorf("saved preview = %+v, want the page's", got)
+	}
+	if got, ok := store.saved[server.URL+"/missing"]; !ok || got != nil {
+		t.Errorf("saved preview of a missing page = %+v, %v, want it recorded as failed", got, ok)
+	}
+	store.mu.Unlock()
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't return after ctx was done")
+	}
+}
+
+func TestPool_Enqueue(t *testing.T) {
+	// not running, so nothing leaves the queue
+	pool := NewPool(NewFetcher(), &fakeStore{})
+	if !pool.Enqueue("https://example.com/") {
+		t.Fatal("Enqueue() = false, want the URL queued")
+	}
+	if pool.Enqueue("https://example.com/") {
+		t.Error("Enqueue() of a queued URL = true, want it skipped")
+	}
+	for i := 1; i < DefaultQueueSize; i++ {
+		pool.Enqueue("https://example.com/" + strings.Repeat("a", i))
+	}
+	if pool.Enqueue("https://example.com/one-too-many") {
+		t.Error("Enqueue() on a full queue = true, want it dropped")
+	}
+}
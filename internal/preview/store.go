@@ -0,0 +1,24 @@
+package preview
+
+import (
+	"context"
+
+	"github.com/maniac-en/chirpstack/internal/database"
+)
+
+// DBStore is the Store backed by the link_previews table
+type DBStore struct {
+	DB *database.Queries
+}
+
+func (s DBStore) Save(ctx context.Context, url string, preview *Preview) error {
+	params := database.UpsertLinkPreviewParams{URL: url}
+	if preview != nil {
+		params.Succeeded = true
+		params.Title = preview.Title
+		params.Description = preview.Description
+		params.ImageUrl = preview.ImageURL
+		params.SiteName = preview.SiteName
+	}
+	return s.DB.UpsertLinkPreview(ctx, params)
+}
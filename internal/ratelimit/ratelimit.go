@@ -0,0 +1,83 @@
+// Package ratelimit provides an in-memory token bucket rate limiter keyed by
+// caller
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many calls to Allow go by between sweeps of idle buckets
+const sweepEvery = 1024
+
+// Limiter hands out requests per key at a rate of perMinute, with bursts of
+// up to perMinute. Each key may be checked against a different rate, which
+// lets callers give some keys more headroom than others. Limits are per
+// process, so they scale with the number of servers.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	// Now is used instead of time.Now when set
+	Now func() time.Time
+}
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	capacity float64
+}
+
+func New() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it returns
+// false and how long until a token is available.
+func (l *Limiter) Allow(key string, perMinute int) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return false, time.Minute
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.Now != nil {
+		now = l.Now()
+	}
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	capacity := float64(perMinute)
+	rate := capacity / time.Minute.Seconds()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	// the rate for a key changes when e.g. its plan does, keep what's left
+	// but never more than the new capacity
+	b.capacity = capacity
+	b.tokens = min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets buckets that have refilled completely, they behave the same
+// as a new bucket
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		refilled := b.tokens + now.Sub(b.last).Seconds()*b.capacity/time.Minute.Seconds()
+		if refilled >= b.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New()
+	l.Now = func() time.Time { return now }
+
+	for i := range 3 {
+		if ok, _ := l.Allow("alice", 3); !ok {
+			t.Fatalf("Allow() request %d denied, want a burst of 3 allowed", i+1)
+		}
+	}
+	ok, wait := l.Allow("alice", 3)
+	if ok {
+		t.Fatal("Allow() allowed a 4th request, want it denied")
+	}
+	if wait != 20*time.Second {
+		t.Errorf("Allow() wait = %v, want %v", wait, 20*time.Second)
+	}
+
+	if ok, _ := l.Allow("bob", 3); !ok {
+		t.Error("Allow() denied another key, want keys limited separately")
+	}
+
+	now = now.Add(20 * time.Second)
+	if ok, _ := l.Allow("alice", 3); !ok {
+		t.Error("Allow() denied after a token refilled, want it allowed")
+	}
+}
+
+func TestLimiter_Allow_RaisedLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New()
+	l.Now = func() time.Time { return now }
+
+	l.Allow("alice", 1)
+	if ok, _ := l.Allow("alice", 1); ok {
+		t.Fatal("Allow() allowed a 2nd request at 1/min, want it denied")
+	}
+	// a higher rate refills faster but doesn't hand out a fresh burst
+	now = now.Add(time.Second)
+	for range 2 {
+		if ok, _ := l.Allow("alice", 120); !ok {
+			t.Fatal("Allow() at 120/min denied after 1s, want 2 requests allowed")
+		}
+	}
+	if ok, _ := l.Allow("alice", 120); ok {
+		t.Error("Allow() at 120/min allowed a burst, want the bucket to start from what was left")
+	}
+}
+
+func TestLimiter_Allow_ZeroRate(t *testing.T) {
+	if ok, _ := New().Allow("alice", 0); ok {
+		t.Error("Allow() with a zero rate allowed the request")
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New()
+	l.Now = func() time.Time { return now }
+
+	l.Allow("alice", 60)
+	for range 60 {
+		l.Allow("bob", 60)
+	}
+	now = now.Add(time.Minute)
+	l.sweep(now)
+
+	if _, ok := l.buckets["alice"]; ok {
+		t.Error("sweep() kept a refilled bucket")
+	}
+	l.Allow("bob", 60)
+	for range 60 {
+		l.Allow("bob", 60)
+	}
+	now = now.Add(30 * time.Second)
+	l.sweep(now)
+	if _, ok := l.buckets["bob"]; !ok {
+		t.Error("sweep() dropped a bucket that is still refilling")
+	}
+}
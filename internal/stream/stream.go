@@ -0,0 +1,198 @@
+// Package stream fans messages out to the users connected to a
+// Server-Sent Events stream. Recent messages are kept, so a client that
+// reconnects with the last ID it saw gets what it missed.
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultBufferSize is how many messages a client may fall behind by
+	// before it's disconnected
+	DefaultBufferSize = 64
+	// DefaultHistorySize is how many messages, counted per recipient, are
+	// kept for resuming
+	DefaultHistorySize = 1024
+)
+
+// ErrClosed is returned when subscribing to a closed hub
+var ErrClosed = errors.New("stream hub closed")
+
+// Message is one SSE event
+type Message struct {
+	ID    uint64
+	Event string
+	Data  []byte
+}
+
+// WriteTo writes the message in the SSE wire format
+func (m Message) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %d\n", m.ID)
+	if m.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", m.Event)
+	}
+	for line := range strings.SplitSeq(string(m.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Client is one connection of a user. Its channel is closed when the client
+// falls too far behind or the hub closes.
+type Client struct {
+	UserID   uuid.UUID
+	messages chan Message
+}
+
+// Messages delivers the messages for the client
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+type entry struct {
+	userID  uuid.UUID
+	message Message
+}
+
+// Hub tracks the connected clients. Messages are per process, a client only
+// gets what is published on the server it's connected to, so servers
+// sharing clients need to publish everything on every one of them.
+type Hub struct {
+	BufferSize  int
+	HistorySize int
+
+	mu      sync.Mutex
+	clients map[uuid.UUID]map[*Client]struct{}
+	history []entry
+	closed  bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		BufferSize:  DefaultBufferSize,
+		HistorySize: DefaultHistorySize,
+		clients:     make(map[uuid.UUID]map[*Client]struct{}),
+	}
+}
+
+// Subscribe connects a client for userID. With resume set, the kept
+// messages for the user newer than lastEventID are queued first, as many as
+// fit in the buffer.
+func (h *Hub) Subscribe(userID uuid.UUID, lastEventID uint64, resume bool) (*Client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrClosed
+	}
+
+	client := &Client{
+		UserID:   userID,
+		messages: make(chan Message, h.bufferSize()),
+	}
+	if resume {
+		var missed []Message
+		for _, e := range h.history {
+			if e.userID == userID && e.message.ID > lastEventID {
+				missed = append(missed, e.message)
+			}
+		}
+		// the newest ones matter most
+		if len(missed) > cap(client.messages) {
+			missed = missed[len(missed)-cap(client.messages):]
+		}
+		for _, message := range missed {
+			client.messages <- message
+		}
+	}
+
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*Client]struct{})
+	}
+	h.clients[userID][client] = struct{}{}
+	return client, nil
+}
+
+// Unsubscribe disconnects a client, it's safe to call more than once
+func (h *Hub) Unsubscribe(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(client)
+}
+
+// PublishMessage sends a message to every connected client of the given
+// users and keeps it for resuming. Its ID is the ID of the message in the
+// log shared between servers, so clients can resume on any of them, and
+// must keep growing. Clients too far behind to take it are disconnected,
+// they can resume from the last message they got.
+func (h *Hub) PublishMessage(message Message, userIDs ...uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed || len(userIDs) == 0 {
+		return
+	}
+	for _, userID := range userIDs {
+		h.history = append(h.history, entry{userID: userID, message: message})
+		for client := range h.clients[userID] {
+			select {
+			case client.messages <- message:
+			default:
+				h.remove(client)
+			}
+		}
+	}
+	if over := len(h.history) - h.historySize(); over > 0 {
+		h.history = append(h.history[:0], h.history[over:]...)
+	}
+}
+
+// Close disconnects every client and refuses new ones
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, clients := range h.clients {
+		for client := range clients {
+			h.remove(client)
+		}
+	}
+}
+
+// remove must be called with mu held
+func (h *Hub) remove(client *Client) {
+	clients, ok := h.clients[client.UserID]
+	if !ok {
+		return
+	}
+	if _, ok := clients[client]; !ok {
+		return
+	}
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(h.clients, client.UserID)
+	}
+	close(client.messages)
+}
+
+func (h *Hub) bufferSize() int {
+	if h.BufferSize > 0 {
+		return h.BufferSize
+	}
+	return DefaultBufferSize
+}
+
+func (h *Hub) historySize() int {
+	if h.HistorySize > 0 {
+		return h.HistorySize
+	}
+	return DefaultHistorySize
+}
@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// drain returns the messages queued for the client and whether its channel
+// was closed
+func drain(client *Client) ([]Message, bool) {
+	var messages []Message
+	for {
+		select {
+		case message, ok := <-client.Messages():
+			if !ok {
+				return messages, true
+			}
+			messages = append(messages, message)
+		default:
+			return messages, false
+		}
+	}
+}
+
+func TestMessage_WriteTo(t *testing.T) {
+	var b strings.Builder
+	message := Message{ID: 42, Event: "chirp.created", Data: []byte("{\"a\":1}\n{\"b\":2}")}
+	if _, err := message.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() unexpected error = %v", err)
+	}
+	want := "id: 42\nevent: chirp.created\ndata: {\"a\":1}\ndata: {\"b\":2}\n\n"
+	if b.String() != want {
+		t.Errorf("WriteTo() wrote %q, want %q", b.String(), want)
+	}
+}
+
+func TestHub_PublishMessage(t *testing.T) {
+	hub := NewHub()
+	alice, bob := uuid.New(), uuid.New()
+	aliceClient, err := hub.Subscribe(alice, 0, false)
+	if err != nil {
+		t.Fatalf("Subscribe() unexpected error = %v", err)
+	}
+	bobClient, _ := hub.Subscribe(bob, 0, false)
+
+	hub.PublishMessage(Message{ID: 1, Event: "chirp.created", Data: []byte(`{}`)}, alice)
+	hub.PublishMessage(Message{ID: 2, Event: "notification", Data: []byte(`{}`)}, alice, bob)
+
+	got, _ := drain(aliceClient)
+	if len(got) != 2 || got[0].Event != "chirp.created" || got[1].Event != "notification" {
+		t.Fatalf("alice got %+v, want chirp.created then notification", got)
+	}
+	if got, _ := drain(bobClient); len(got) != 1 || got[0].Event != "notification" {
+		t.Errorf("bob got %+v, want only the notification", got)
+	}
+}
+
+func TestHub_SlowClientIsDisconnected(t *testing.T) {
+	hub := NewHub()
+	hub.BufferSize = 2
+	userID := uuid.New()
+	client, _ := hub.Subscribe(userID, 0, false)
+
+	for id := range uint64(3) {
+		hub.PublishMessage(Message{ID: id + 1, Event: "chirp.created", Data: []byte(`{}`)}, userID)
+	}
+	got, closed := drain(client)
+	if !closed || len(got) != 2 {
+		t.Errorf("got %d messages, closed %v, want 2 messages then closed", len(got), closed)
+	}
+	// unsubscribing after being dropped is fine
+	hub.Unsubscribe(client)
+}
+
+func TestHub_Resume(t *testing.T) {
+	hub := NewHub()
+	hub.BufferSize = 2
+	userID := uuid.New()
+	client, _ := hub.Subscribe(userID, 0, false)
+	hub.PublishMessage(Message{ID: 1, Event: "a"}, userID)
+	seen, _ := drain(client)
+	hub.Unsubscribe(client)
+
+	hub.PublishMessage(Message{ID: 2, Event: "b"}, userID)
+	hub.PublishMessage(Message{ID: 3, Event: "other user"}, uuid.New())
+	hub.PublishMessage(Message{ID: 4, Event: "c"}, userID)
+	hub.PublishMessage(Message{ID: 5, Event: "d"}, userID)
+
+	resumed, _ := hub.Subscribe(userID, seen[0].ID, true)
+	got, _ := drain(resumed)
+	if len(got) != 2 || got[0].Event != "c" || got[1].Event != "d" {
+		t.Errorf("resumed with %+v, want the newest missed messages c and d", got)
+	}
+
+	fresh, _ := hub.Subscribe(userID, 0, false)
+	if got, _ := drain(fresh); len(got) != 0 {
+		t.Errorf("fresh client got %+v, want nothing", got)
+	}
+}
+
+func TestHub_ResumeOnAnotherHub(t *testing.T) {
+	// two servers fed the same log
+	hubs := []*Hub{NewHub(), NewHub()}
+	userID := uuid.New()
+	for _, hub := range hubs {
+		hub.PublishMessage(Message{ID: 7, Event: "a"}, userID)
+		hub.PublishMessage(Message{ID: 8, Event: "b"}, userID)
+	}
+
+	// a client that saw 7 on one server resumes on the other
+	client, _ := hubs[1].Subscribe(userID, 7, true)
+	got, _ := drain(client)
+	if len(got) != 1 || got[0].ID != 8 || got[0].Event != "b" {
+		t.Errorf("resumed with %+v, want message 8", got)
+	}
+}
+
+func TestHub_HistoryIsBounded(t *testing.T) {
+	hub := NewHub()
+	hub.HistorySize = 3
+	userID := uuid.New()
+	for id := range uint64(5) {
+		hub.PublishMessage(Message{ID: id + 1, Event: "chirp.created"}, userID)
+	}
+	if len(hub.history) != 3 {
+		t.Errorf("history has %d entries, want 3", len(hub.history))
+	}
+}
+
+func TestHub_Close(t *testing.T) {
+	hub := NewHub()
+	client, _ := hub.Subscribe(uuid.New(), 0, false)
+	hub.Close()
+
+	if _, closed := drain(client); !closed {
+		t.Error("client channel still open after Close()")
+	}
+	if _, err := hub.Subscribe(uuid.New(), 0, false); err != ErrClosed {
+		t.Errorf("Subscribe() after Close() error = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// wordChar is what a phrase can't be next to, so muting "cat" leaves
+// "category" alone
+const wordChar = `\p{L}\p{N}\p{M}_`
+
+// PhraseMatcher finds any of a set of words or phrases in text, ignoring
+// case and how much whitespace separates their words. It's compiled once,
+// matching is a single pass however many phrases there are.
+type PhraseMatcher struct {
+	re *regexp.Regexp
+}
+
+// NewPhraseMatcher compiles a matcher of phrases, blank ones are ignored.
+// With none it matches nothing.
+func NewPhraseMatcher(phrases []string) *PhraseMatcher {
+	var alternatives []string
+	for _, phrase := range phrases {
+		words := strings.Fields(phrase)
+		if len(words) == 0 {
+			continue
+		}
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		alternatives = append(alternatives, strings.Join(words, `\s+`))
+	}
+	if len(alternatives) == 0 {
+		return &PhraseMatcher{}
+	}
+	return &PhraseMatcher{
+		re: regexp.MustCompile(`(?i)(?:^|[^` + wordChar + `])(?:` + strings.Join(alternatives, "|") + `)(?:[^` + wordChar + `]|$)`),
+	}
+}
+
+// Match reports whether text contains any of the phrases as whole words
+func (m *PhraseMatcher) Match(text string) bool {
+	return m != nil && m.re != nil && m.re.MatchString(text)
+}
+
+// Empty reports whether m has no phrases, so matches nothing
+func (m *PhraseMatcher) Empty() bool {
+	return m == nil || m.re == nil
+}
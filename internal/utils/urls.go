@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxURLLength is the longest URL picked out of a chirp
+const maxURLLength = 2048
+
+var urlRegexp = regexp.MustCompile("(?i)\\bhttps?://[^\\s<>\"'`]+")
+
+// ExtractURLs returns the http and https URLs in a chirp's body, in order.
+// Punctuation ending a sentence isn't part of a URL, and neither is a
+// closing parenthesis without an opening one in the URL.
+func ExtractURLs(body string) []string {
+	var urls []string
+	for _, span := range urlSpans(body) {
+		urls = append(urls, body[span[0]:span[1]])
+	}
+	return urls
+}
+
+// urlSpans returns the start and end of each URL in body
+func urlSpans(body string) [][2]int {
+	var spans [][2]int
+	for _, loc := range urlRegexp.FindAllStringIndex(body, -1) {
+		match := body[loc[0]:loc[1]]
+		for {
+			trimmed := strings.TrimRight(match, ".,:;!?")
+			if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, "(") < strings.Count(trimmed, ")") {
+				trimmed = trimmed[:len(trimmed)-1]
+			}
+			if trimmed == match {
+				break
+			}
+			match = trimmed
+		}
+		if len(match) > maxURLLength {
+			continue
+		}
+		if u, err := url.Parse(match); err != nil || u.Hostname() == "" {
+			continue
+		}
+		spans = append(spans, [2]int{loc[0], loc[0] + len(match)})
+	}
+	return spans
+}
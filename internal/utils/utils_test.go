@@ -3,6 +3,8 @@ package utils
 import (
 	"encoding/json"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -258,3 +260,108 @@ func TestRespondWithJSONAndError_Integration(t *testing.T) {
 		t.Errorf("Error response message = %v, want 'validation failed'", errorResponse["error"])
 	}
 }
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{body: "no links here", want: nil},
+		{body: "see https://example.com/a?b=c.", want: []string{"https://example.com/a?b=c"}},
+		{body: "(via http://example.com/x) and HTTPS://Example.com!", want: []string{"http://example.com/x", "HTTPS://Example.com"}},
+		{body: "https://en.wikipedia.org/wiki/Go_(programming_language)", want: []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{body: "ftp://example.com and https:// alone", want: nil},
+	}
+	for _, tt := range tests {
+		if got := ExtractURLs(tt.body); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExtractURLs(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{name: "empty", s: "", want: 0},
+		{name: "ascii", s: "hello", want: 5},
+		{name: "precomposed accent", s: "caf\u00e9", want: 4},
+		{name: "combining accent", s: "cafe\u0301", want: 4},
+		{name: "cjk", s: "こんにちは", want: 5},
+		{name: "emoji", s: "👍", want: 1},
+		{name: "skin tone", s: "👍🏽", want: 1},
+		{name: "zwj family", s: "👨\u200d👩\u200d👧\u200d👦", want: 1},
+		{name: "keycap", s: "1\ufe0f\u20e3", want: 1},
+		{name: "flags", s: "🇺🇸🇫🇷", want: 2},
+		{name: "odd regional indicators", s: "🇺🇸🇫", want: 2},
+		{name: "tag sequence", s: "🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", want: 1},
+		{name: "hangul jamo", s: "\u1100\u1161\u11a8", want: 1},
+		{name: "hangul syllables", s: "한국어", want: 3},
+		{name: "crlf", s: "a\r\nb", want: 3},
+		{name: "zwj between letters", s: "a\u200db", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Graphemes(tt.s); got != tt.want {
+				t.Errorf("Graphemes(%q) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChirpLength(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{body: "hello", want: 5},
+		{body: strings.Repeat("😀", 140), want: 140},
+		{body: "see https://example.com", want: 4 + URLLength},
+		{body: "https://example.com/" + strings.Repeat("a", 200) + " and http://a.co.", want: URLLength + 5 + URLLength + 1},
+	}
+	for _, tt := range tests {
+		if got := ChirpLength(tt.body); got != tt.want {
+			t.Errorf("ChirpLength(%q) = %d, want %d", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestPhraseMatcher(t *testing.T) {
+	matcher := NewPhraseMatcher([]string{"spoiler", "  Game   of  Thrones ", "#golang", "café", "a.b", ""})
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "no spoilers here", want: false},
+		{text: "Spoiler: it ends", want: true},
+		{text: "(spoiler)", want: true},
+		{text: "watching game of\nthrones tonight", want: true},
+		{text: "game of thronesque", want: false},
+		{text: "I love #GoLang", want: true},
+		{text: "golang", want: false},
+		{text: "CAFÉ au lait", want: true},
+		{text: "cafés", want: false},
+		{text: "café́", want: false},
+		{text: "axb", want: false},
+		{text: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := matcher.Match(tt.text); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	if matcher.Empty() {
+		t.Error("Empty() = true, want false")
+	}
+
+	for _, empty := range []*PhraseMatcher{nil, NewPhraseMatcher(nil), NewPhraseMatcher([]string{" "})} {
+		if empty.Match("anything") {
+			t.Errorf("%+v matched, want an empty matcher to match nothing", empty)
+		}
+		if !empty.Empty() {
+			t.Errorf("%+v.Empty() = false, want true", empty)
+		}
+	}
+}
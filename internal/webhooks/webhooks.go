@@ -0,0 +1,224 @@
+// Package webhooks verifies incoming webhooks from external providers and
+// turns them into provider-neutral events
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultSignatureHeader carries HMAC signatures unless a provider says
+	// otherwise
+	DefaultSignatureHeader = "Webhook-Signature"
+	// DefaultTolerance is how old a signed webhook may be before it is
+	// treated as a replay
+	DefaultTolerance = 5 * time.Minute
+)
+
+const (
+	EventUserUpgraded         = "user.upgraded"
+	EventUserDowngraded       = "user.downgraded"
+	EventSubscriptionRenewed  = "subscription.renewed"
+	EventSubscriptionCanceled = "subscription.canceled"
+)
+
+var (
+	ErrInvalidAPIKey    = errors.New("missing/invalid API key")
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrStaleTimestamp   = errors.New("timestamp outside tolerance")
+)
+
+// Verifier authenticates a webhook request. body is the raw request body,
+// verifiers must not assume it has been parsed.
+type Verifier interface {
+	Verify(header http.Header, body []byte) error
+}
+
+// SharedSecretVerifier checks for a static secret in a header, optionally
+// after an auth scheme, e.g. "Authorization: ApiKey <secret>". It offers no
+// replay protection and is only meant for providers that can't sign.
+type SharedSecretVerifier struct {
+	Header string
+	Scheme string
+	Secret string
+}
+
+func (v SharedSecretVerifier) Verify(header http.Header, body []byte) error {
+	value := header.Get(v.Header)
+	if v.Scheme != "" {
+		fields := strings.Fields(value)
+		if len(fields) != 2 || fields[0] != v.Scheme {
+			return ErrInvalidAPIKey
+		}
+		value = fields[1]
+	}
+	if v.Secret == "" || value == "" || subtle.ConstantTimeCompare([]byte(value), []byte(v.Secret)) != 1 {
+		return ErrInvalidAPIKey
+	}
+	return nil
+}
+
+// HMACVerifier checks a signature header of the form t=<unix>,v1=<hex>,
+// where the signature is HMAC-SHA256 over "<t>.<body>". Several v1 entries
+// are allowed so providers can rotate secrets.
+type HMACVerifier struct {
+	Header    string
+	Secret    string
+	Tolerance time.Duration
+	// Now is used instead of time.Now when set
+	Now func() time.Time
+}
+
+func (v HMACVerifier) Verify(header http.Header, body []byte) error {
+	headerName := v.Header
+	if headerName == "" {
+		headerName = DefaultSignatureHeader
+	}
+	value := header.Get(headerName)
+	if value == "" {
+		return ErrMissingSignature
+	}
+
+	var timestamp string
+	var signatures []string
+	for part := range strings.SplitSeq(value, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = val
+		case "v1":
+			signatures = append(signatures, val)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	tolerance := v.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	expected := signature(v.Secret, timestamp, body)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// Sign returns the signature header value HMACVerifier accepts for body
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Event is a webhook reduced to what chirpstack acts on. ID identifies the
+// delivery so retries can be recognised. Plan and CurrentPeriodEnd are only
+// set by subscription events, and only when the provider sends them.
+type Event struct {
+	ID               string
+	Type             string
+	UserID           uuid.UUID
+	Plan             string
+	CurrentPeriodEnd time.Time
+}
+
+// ParseJSONEvent parses the {"id": ..., "event": ..., "data": {"user_id": ...}}
+// payload Polka sends, which other providers are asked to follow too. Polka
+// doesn't send an id, so its deliveries can't be told apart from a repeat of
+// the same event and are never deduplicated.
+func ParseJSONEvent(body []byte) (Event, error) {
+	var payload struct {
+		ID    string `json:"id"`
+		Event string `json:"event"`
+		Data  struct {
+			UserID           uuid.UUID  `json:"user_id"`
+			Plan             string     `json:"plan"`
+			CurrentPeriodEnd *time.Time `json:"current_period_end"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Event{}, fmt.Errorf("malformed webhook payload: %w", err)
+	}
+	event := Event{
+		ID:     payload.ID,
+		Type:   payload.Event,
+		UserID: payload.Data.UserID,
+		Plan:   payload.Data.Plan,
+	}
+	if payload.Data.CurrentPeriodEnd != nil {
+		event.CurrentPeriodEnd = payload.Data.CurrentPeriodEnd.UTC()
+	}
+	return event, nil
+}
+
+// Provider is a source of webhooks
+type Provider struct {
+	Name     string
+	Verifier Verifier
+	// Parse turns a verified body into an event, ParseJSONEvent when nil
+	Parse func(body []byte) (Event, error)
+}
+
+func (p Provider) ParseEvent(body []byte) (Event, error) {
+	if p.Parse == nil {
+		return ParseJSONEvent(body)
+	}
+	return p.Parse(body)
+}
+
+// Registry holds the configured providers by name
+type Registry struct {
+	providers map[string]Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+func (r *Registry) Register(p Provider) {
+	r.providers[p.Name] = p
+}
+
+func (r *Registry) Lookup(name string) (Provider, bool) {
+	if r == nil {
+		return Provider{}, false
+	}
+	p, ok := r.providers[name]
+	return p, ok
+}
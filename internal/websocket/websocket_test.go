@@ -0,0 +1,212 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// the example from RFC 6455, section 1.3
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey() = %q", got)
+	}
+}
+
+// echoServer upgrades every request and echoes messages until the client
+// closes
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDialAndEcho(t *testing.T) {
+	server := echoServer(t)
+	conn, err := Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() unexpected error = %v", err)
+	}
+
+	for _, message := range []string{"hello", strings.Repeat("x", 300), strings.Repeat("y", 40000)} {
+		if err := conn.WriteMessage(TextMessage, []byte(message)); err != nil {
+			t.Fatalf("WriteMessage() unexpected error = %v", err)
+		}
+		messageType, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() unexpected error = %v", err)
+		}
+		if messageType != TextMessage || string(got) != message {
+			t.Errorf("echo of %d bytes came back as type %d with %d bytes", len(message), messageType, len(got))
+		}
+	}
+
+	// the server echoes the close
+	conn.Close(CloseNormal, "bye")
+}
+
+func TestUpgrade_Rejects(t *testing.T) {
+	server := echoServer(t)
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{name: "plain request", want: http.StatusBadRequest},
+		{
+			name:   "old version",
+			header: map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8"},
+			want:   http.StatusUpgradeRequired,
+		},
+		{
+			name:   "bad key",
+			header: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "short"},
+			want:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, res.StatusCode)
+			}
+		})
+	}
+}
+
+// pipe returns a server Conn and the raw client end of the connection
+func pipe(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	serverEnd, clientEnd := net.Pipe()
+	t.Cleanup(func() {
+		serverEnd.Close()
+		clientEnd.Close()
+	})
+	return newConn(serverEnd, bufio.NewReader(serverEnd), false), clientEnd
+}
+
+// maskedFrame builds a client frame with a zero mask, which leaves the
+// payload as is
+func maskedFrame(first byte, payload string) []byte {
+	frame := []byte{first, 0x80 | byte(len(payload)), 0, 0, 0, 0}
+	return append(frame, payload...)
+}
+
+// readServerFrame reads one unmasked frame with a short payload, returning
+// opcode 0xff if the connection ends first
+func readServerFrame(conn net.Conn) (byte, []byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0xff, nil
+	}
+	payload := make([]byte, header[1]&0x7f)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return 0xff, nil
+	}
+	return header[0] & 0x0f, payload
+}
+
+func TestReadMessage_FragmentsAndPing(t *testing.T) {
+	server, client := pipe(t)
+	go func() {
+		client.Write(maskedFrame(opText, "hel"))
+		// a ping in the middle of a fragmented message
+		client.Write(maskedFrame(0x80|opPing, "p"))
+		client.Write(maskedFrame(0x80|opContinuation, "lo"))
+	}()
+
+	pong := make(chan []byte, 1)
+	go func() {
+		opcode, payload := readServerFrame(client)
+		if opcode != opPong {
+			payload = nil
+		}
+		pong <- payload
+	}()
+
+	messageType, message, err := server.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() unexpected error = %v", err)
+	}
+	if messageType != TextMessage || string(message) != "hello" {
+		t.Errorf("ReadMessage() = %d %q, want the reassembled text", messageType, message)
+	}
+	if got := <-pong; string(got) != "p" {
+		t.Errorf("pong payload = %q, want a pong echoing the ping", got)
+	}
+}
+
+func TestReadMessage_ProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		frame    []byte
+		wantCode uint16
+	}{
+		{name: "unmasked frame", frame: []byte{0x80 | opText, 2, 'h', 'i'}, wantCode: CloseProtocolError},
+		{name: "unknown opcode", frame: maskedFrame(0x80|0x3, ""), wantCode: CloseProtocolError},
+		{name: "stray continuation", frame: maskedFrame(0x80|opContinuation, "x"), wantCode: CloseProtocolError},
+		{name: "invalid utf-8", frame: maskedFrame(0x80|opText, "\xff"), wantCode: CloseInvalidPayload},
+		{name: "too big", frame: maskedFrame(0x80|opText, strings.Repeat("x", 20)), wantCode: CloseMessageTooBig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := pipe(t)
+			server.MaxMessageSize = 10
+			go client.Write(tt.frame)
+
+			closed := make(chan []byte, 1)
+			go func() {
+				_, payload := readServerFrame(client)
+				closed <- payload
+			}()
+
+			if _, _, err := server.ReadMessage(); err == nil {
+				t.Fatal("ReadMessage() expected an error")
+			}
+			payload := <-closed
+			if len(payload) < 2 || uint16(payload[0])<<8|uint16(payload[1]) != tt.wantCode {
+				t.Errorf("close frame payload = %v, want code %d", payload, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestReadMessage_PeerClose(t *testing.T) {
+	server, client := pipe(t)
+	go client.Write(maskedFrame(0x80|opClose, "\x03\xe9gone"))
+	go readServerFrame(client)
+
+	_, _, err := server.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway || closeErr.Reason != "gone" {
+		t.Errorf("ReadMessage() error = %v, want a CloseError with 1001 gone", err)
+	}
+}
@@ -2,14 +2,31 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/maniac-en/chirpstack/internal/api"
 	"github.com/maniac-en/chirpstack/internal/database"
+	"github.com/maniac-en/chirpstack/internal/dispatch"
+	"github.com/maniac-en/chirpstack/internal/events"
+	"github.com/maniac-en/chirpstack/internal/fanout"
+	"github.com/maniac-en/chirpstack/internal/gateway"
+	"github.com/maniac-en/chirpstack/internal/media"
+	"github.com/maniac-en/chirpstack/internal/oidc"
+	"github.com/maniac-en/chirpstack/internal/preview"
+	"github.com/maniac-en/chirpstack/internal/ratelimit"
+	"github.com/maniac-en/chirpstack/internal/stream"
+	"github.com/maniac-en/chirpstack/internal/webhooks"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -33,14 +50,87 @@ func main() {
 		log.Fatal("empty secret found for JWT signing")
 	}
 
-	polkaAPIKey := os.Getenv("POLKA_KEY")
+	accountDeletionGracePeriod := api.DefaultAccountDeletionGracePeriod
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"); v != "" {
+		accountDeletionGracePeriod, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid ACCOUNT_DELETION_GRACE_PERIOD: %v", err)
+		}
+	}
+
+	var maxChirpLength int
+	if v := os.Getenv("MAX_CHIRP_LENGTH"); v != "" {
+		maxChirpLength, err = strconv.Atoi(v)
+		if err != nil || maxChirpLength <= 0 {
+			log.Fatalf("invalid MAX_CHIRP_LENGTH '%s'", v)
+		}
+	}
+
+	oidcProviders, err := loadOIDCProviders(platform)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	webhookProviders, err := loadWebhookProviders()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	blobStore, err := loadBlobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	apiCfg := api.APIConfig{
-		DB:             database.New(db),
-		Platform:       platform,
-		JWTTokenSecret: jwtTokenSecret,
-		PolkaAPIKey:    polkaAPIKey,
+		DB:                         database.New(db),
+		DBConn:                     db,
+		Platform:                   platform,
+		JWTTokenSecret:             jwtTokenSecret,
+		AdminAPIKey:                os.Getenv("ADMIN_KEY"),
+		Webhooks:                   webhookProviders,
+		AccountDeletionGracePeriod: accountDeletionGracePeriod,
+		OIDCProviders:              oidcProviders,
+		RateLimiter:                ratelimit.New(),
+		StreamHub:                  stream.NewHub(),
+		Gateway:                    gateway.New(),
+		Media:                      blobStore,
+		MaxChirpLength:             maxChirpLength,
+	}
+
+	// background jobs stop once shutdown begins
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// blocks are checked before subscribing to a user's chirps live
+	apiCfg.Gateway.AuthorizeUserTopic = apiCfg.AuthorizeGatewayUser
+
+	// domain events are relayed from the outbox to these subscribers
+	eventBus := events.NewBus()
+	apiCfg.SubscribeToEvents(eventBus)
+	apiCfg.EventRelay = events.NewRelay(events.DBStore{DB: apiCfg.DB}, eventBus)
+
+	// streams and WebSockets get their messages through a log every
+	// instance reads, woken by NOTIFY and polling in case a wake is missed
+	realtime := fanout.NewReceiver(fanout.DBStore{DB: apiCfg.DB}, apiCfg.DeliverRealtime)
+	listener, err := fanout.Listen(os.Getenv("DB_URL"), realtime)
+	if err != nil {
+		log.Fatalf("listening for realtime messages: %v", err)
 	}
+	defer listener.Close()
+
+	// link previews are fetched in the background, from public addresses only
+	apiCfg.LinkPreviews = preview.NewPool(preview.NewFetcher(), preview.DBStore{DB: apiCfg.DB})
+
+	// background jobs
+	go apiCfg.EventRelay.Run(ctx, time.Second)
+	go realtime.Run(ctx, 5*time.Second)
+	go apiCfg.RunAccountPurger(ctx, time.Hour)
+	go apiCfg.RunSubscriptionExpirer(ctx, time.Hour)
+	go apiCfg.RunMediaJanitor(ctx, time.Hour)
+	go apiCfg.RunChirpPublisher(ctx, 10*time.Second)
+	go apiCfg.LinkPreviews.Run(ctx)
+	go dispatch.New(dispatch.DBStore{DB: apiCfg.DB}).Run(ctx, 5*time.Second)
+
 	mux := http.NewServeMux()
 	fileserverHandler := http.StripPrefix("/app", http.FileServer(http.Dir('.')))
 
@@ -51,7 +141,32 @@ func main() {
 	mux.HandleFunc("GET /api/health", apiCfg.HealthHandler)
 
 	mux.HandleFunc("GET /api/chirps", apiCfg.GetChirps)
+	mux.HandleFunc("GET /api/chirps/scheduled", apiCfg.GetScheduledChirps)
 	mux.HandleFunc("GET /api/chirps/{id}", apiCfg.GetChirpByID)
+	mux.HandleFunc("GET /api/users/me", apiCfg.GetCurrentUser)
+	mux.HandleFunc("GET /api/users/me/export", apiCfg.ExportCurrentUser)
+	mux.HandleFunc("GET /api/users/me/blocks", apiCfg.GetBlocks)
+	mux.HandleFunc("GET /api/users/me/mutes", apiCfg.GetMutes)
+	mux.HandleFunc("GET /api/users/me/muted-words", apiCfg.GetMutedWords)
+	mux.HandleFunc("GET /api/users/{id}", apiCfg.GetUserProfile)
+	mux.HandleFunc("GET /api/users/handle/{handle}", apiCfg.GetUserProfileByHandle)
+	mux.HandleFunc("GET /api/auth/{provider}/login", apiCfg.OIDCLogin)
+	mux.HandleFunc("GET /api/auth/{provider}/callback", apiCfg.OIDCCallback)
+	mux.HandleFunc("GET /api/oauth/authorize", apiCfg.OAuthAuthorize)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.GetOAuthClients)
+	mux.HandleFunc("GET /api/keys", apiCfg.GetAPIKeys)
+	mux.HandleFunc("GET /api/webhook-subscriptions", apiCfg.GetWebhookSubscriptions)
+	mux.HandleFunc("GET /api/webhook-subscriptions/{id}/deliveries", apiCfg.GetWebhookDeliveries)
+	mux.HandleFunc("GET /api/notifications", apiCfg.GetNotifications)
+	mux.HandleFunc("GET /api/notifications/unread-count", apiCfg.GetUnreadNotificationCount)
+	mux.HandleFunc("GET /api/stream", apiCfg.Stream)
+	mux.HandleFunc("GET /api/ws", apiCfg.LiveGateway)
+	mux.HandleFunc("GET /api/media/{id}", apiCfg.GetMedia)
+	mux.HandleFunc("GET /api/media/{id}/thumbnail", apiCfg.GetMediaThumbnail)
+	mux.HandleFunc("GET /api/drafts", apiCfg.GetDrafts)
+	mux.HandleFunc("GET /api/drafts/{id}", apiCfg.GetDraft)
+	mux.HandleFunc("GET /api/bookmarks", apiCfg.GetBookmarks)
+	mux.HandleFunc("GET /api/bookmarks/collections", apiCfg.GetBookmarkCollections)
 
 	mux.HandleFunc("POST /api/chirps", apiCfg.CreateChirps)
 	mux.HandleFunc("POST /api/users", apiCfg.CreateUser)
@@ -59,15 +174,194 @@ func main() {
 	mux.HandleFunc("POST /api/refresh", apiCfg.RefreshUserToken)
 	mux.HandleFunc("POST /api/revoke", apiCfg.RevokeUserToken)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.UpgradeUser)
+	mux.HandleFunc("POST /api/webhooks/{provider}", apiCfg.HandleWebhook)
+	mux.HandleFunc("POST /api/users/{id}/follow", apiCfg.FollowUser)
+	mux.HandleFunc("POST /api/users/{id}/block", apiCfg.BlockUser)
+	mux.HandleFunc("POST /api/users/{id}/mute", apiCfg.MuteUser)
+	mux.HandleFunc("POST /api/users/me/muted-words", apiCfg.CreateMutedWord)
+	mux.HandleFunc("POST /api/oauth/authorize", apiCfg.OAuthConsent)
+	mux.HandleFunc("POST /api/oauth/token", apiCfg.OAuthToken)
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.CreateOAuthClient)
+	mux.HandleFunc("POST /api/keys", apiCfg.CreateAPIKey)
+	mux.HandleFunc("POST /api/webhook-subscriptions", apiCfg.CreateWebhookSubscription)
+	mux.HandleFunc("POST /api/webhook-subscriptions/{id}/deliveries/{delivery_id}/retry", apiCfg.RetryWebhookDelivery)
+	mux.HandleFunc("POST /api/chirps/{id}/like", apiCfg.LikeChirp)
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.MarkNotificationsRead)
+	mux.HandleFunc("POST /api/media", apiCfg.UploadMedia)
+	mux.HandleFunc("POST /api/drafts", apiCfg.CreateDraft)
+	mux.HandleFunc("POST /api/drafts/{id}/publish", apiCfg.PublishDraft)
+	mux.HandleFunc("POST /api/chirps/{id}/bookmark", apiCfg.BookmarkChirp)
+	mux.HandleFunc("POST /api/bookmarks/collections", apiCfg.CreateBookmarkCollection)
 
 	mux.HandleFunc("PUT /api/users", apiCfg.UpdateUser)
+	mux.HandleFunc("PATCH /api/users", apiCfg.UpdateUser)
+	mux.HandleFunc("PUT /api/chirps/{id}", apiCfg.UpdateChirp)
+	mux.HandleFunc("PUT /api/drafts/{id}", apiCfg.UpdateDraft)
+	mux.HandleFunc("PUT /api/bookmarks/collections/{id}", apiCfg.UpdateBookmarkCollection)
 
 	mux.HandleFunc("DELETE /api/chirps/{id}", apiCfg.DeleteChirp)
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.DeleteCurrentUser)
+	mux.HandleFunc("DELETE /api/users/{id}/follow", apiCfg.UnfollowUser)
+	mux.HandleFunc("DELETE /api/users/{id}/block", apiCfg.UnblockUser)
+	mux.HandleFunc("DELETE /api/users/{id}/mute", apiCfg.UnmuteUser)
+	mux.HandleFunc("DELETE /api/users/me/muted-words/{id}", apiCfg.DeleteMutedWord)
+	mux.HandleFunc("DELETE /api/oauth/clients/{id}", apiCfg.DeleteOAuthClient)
+	mux.HandleFunc("DELETE /api/keys/{id}", apiCfg.RevokeAPIKey)
+	mux.HandleFunc("DELETE /api/webhook-subscriptions/{id}", apiCfg.DeleteWebhookSubscription)
+	mux.HandleFunc("DELETE /api/chirps/{id}/like", apiCfg.UnlikeChirp)
+	mux.HandleFunc("DELETE /api/chirps/scheduled", apiCfg.DeleteScheduledChirp)
+	mux.HandleFunc("DELETE /api/drafts/{id}", apiCfg.DeleteDraft)
+	mux.HandleFunc("DELETE /api/chirps/{id}/bookmark", apiCfg.UnbookmarkChirp)
+	mux.HandleFunc("DELETE /api/bookmarks/collections/{id}", apiCfg.DeleteBookmarkCollection)
 
 	// admin
 	mux.HandleFunc("GET /admin/metrics", apiCfg.MetricsHandler)
 	mux.HandleFunc("POST /admin/reset", apiCfg.ResetHandler)
+	mux.HandleFunc("GET /admin/webhooks", apiCfg.GetWebhookEvents)
+	mux.HandleFunc("GET /admin/webhooks/{id}", apiCfg.GetWebhookEvent)
+	mux.HandleFunc("POST /admin/webhooks/{id}/replay", apiCfg.ReplayWebhookEvent)
+	mux.HandleFunc("GET /admin/webhook-subscriptions", apiCfg.AdminGetWebhookSubscriptions)
+	mux.HandleFunc("POST /admin/webhook-subscriptions", apiCfg.AdminCreateWebhookSubscription)
+	mux.HandleFunc("DELETE /admin/webhook-subscriptions/{id}", apiCfg.AdminDeleteWebhookSubscription)
+	mux.HandleFunc("GET /admin/webhook-subscriptions/{id}/deliveries", apiCfg.AdminGetWebhookDeliveries)
+	mux.HandleFunc("POST /admin/webhook-subscriptions/{id}/deliveries/{delivery_id}/retry", apiCfg.AdminRetryWebhookDelivery)
 
 	loggedMux := apiCfg.LogMiddleware(mux)
-	log.Fatal(http.ListenAndServe(":8080", loggedMux))
+	server := &http.Server{Addr: ":8080", Handler: loggedMux}
+	// streams never finish on their own, end them so Shutdown doesn't wait
+	// for them. WebSockets are hijacked, Shutdown doesn't track them at all.
+	server.RegisterOnShutdown(apiCfg.StreamHub.Close)
+	server.RegisterOnShutdown(apiCfg.Gateway.Close)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	log.Println("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
+
+// loadOIDCProviders discovers the providers listed in OIDC_PROVIDERS, each
+// one configured through OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_REDIRECT_URL. In dev,
+// OIDC_MOCK_PROVIDER=true adds an in-process "mock" provider to binaries
+// built with the oidcmock tag.
+func loadOIDCProviders(platform api.Platform) (map[string]*oidc.Provider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	providers := make(map[string]*oidc.Provider)
+	for name := range strings.SplitSeq(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider, err := oidc.Discover(ctx, name, oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		providers[name] = provider
+	}
+
+	if platform == api.PlatformDev && os.Getenv("OIDC_MOCK_PROVIDER") == "true" {
+		provider, err := startMockOIDCProvider(ctx)
+		if err != nil {
+			return nil, err
+		}
+		providers["mock"] = provider
+	}
+	return providers, nil
+}
+
+// loadWebhookProviders registers Polka, authenticated with POLKA_KEY, and
+// the HMAC-signing providers listed in WEBHOOK_PROVIDERS, each configured
+// through WEBHOOK_<NAME>_SECRET and optionally WEBHOOK_<NAME>_SIGNATURE_HEADER
+// and WEBHOOK_<NAME>_TOLERANCE.
+func loadWebhookProviders() (*webhooks.Registry, error) {
+	registry := webhooks.NewRegistry(webhooks.Provider{
+		Name: "polka",
+		Verifier: webhooks.SharedSecretVerifier{
+			Header: "Authorization",
+			Scheme: "ApiKey",
+			Secret: os.Getenv("POLKA_KEY"),
+		},
+	})
+
+	for name := range strings.SplitSeq(os.Getenv("WEBHOOK_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "WEBHOOK_" + strings.ToUpper(name) + "_"
+		secret := os.Getenv(prefix + "SECRET")
+		if secret == "" {
+			return nil, fmt.Errorf("empty %sSECRET for webhook provider %s", prefix, name)
+		}
+		tolerance := webhooks.DefaultTolerance
+		if v := os.Getenv(prefix + "TOLERANCE"); v != "" {
+			var err error
+			tolerance, err = time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %sTOLERANCE: %w", prefix, err)
+			}
+		}
+		registry.Register(webhooks.Provider{
+			Name: name,
+			Verifier: webhooks.HMACVerifier{
+				Header:    os.Getenv(prefix + "SIGNATURE_HEADER"),
+				Secret:    secret,
+				Tolerance: tolerance,
+			},
+		})
+	}
+	return registry, nil
+}
+
+// loadBlobStore picks where uploaded media is kept from MEDIA_STORE: "fs"
+// (the default) for files under MEDIA_DIR, or "s3" for a bucket configured
+// through S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID and
+// S3_SECRET_ACCESS_KEY.
+func loadBlobStore() (media.BlobStore, error) {
+	switch store := os.Getenv("MEDIA_STORE"); store {
+	case "", "fs":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "./media"
+		}
+		return media.FileStore{Dir: dir}, nil
+	case "s3":
+		s3 := &media.S3Store{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			Client:          &http.Client{Timeout: 30 * time.Second},
+		}
+		if s3.Endpoint == "" || s3.Bucket == "" {
+			return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required when MEDIA_STORE=s3")
+		}
+		if s3.Region == "" {
+			s3.Region = "us-east-1"
+		}
+		return s3, nil
+	default:
+		return nil, fmt.Errorf("invalid MEDIA_STORE '%s'", store)
+	}
 }
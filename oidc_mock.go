@@ -0,0 +1,30 @@
+//go:build oidcmock
+
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/maniac-en/chirpstack/internal/oidc"
+	"github.com/maniac-en/chirpstack/internal/oidc/oidctest"
+)
+
+// startMockOIDCProvider starts the in-process mock provider, it signs
+// everyone in as the same verified user so it's only ever built in with the
+// oidcmock tag
+func startMockOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
+	mock := oidctest.NewServer("chirpstack", "chirpstack-secret")
+	provider, err := oidc.Discover(ctx, "mock", oidc.Config{
+		Issuer:       mock.Issuer(),
+		ClientID:     mock.ClientID,
+		ClientSecret: mock.ClientSecret,
+		RedirectURL:  "http://localhost:8080/api/auth/mock/callback",
+	}, mock.Client())
+	if err != nil {
+		mock.Close()
+		return nil, err
+	}
+	log.Printf("mock OIDC provider listening on %s", mock.URL)
+	return provider, nil
+}
@@ -0,0 +1,16 @@
+//go:build !oidcmock
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/maniac-en/chirpstack/internal/oidc"
+)
+
+// startMockOIDCProvider refuses to start the mock provider, which isn't
+// part of binaries built without the oidcmock tag
+func startMockOIDCProvider(context.Context) (*oidc.Provider, error) {
+	return nil, errors.New("OIDC_MOCK_PROVIDER needs a binary built with -tags oidcmock")
+}
@@ -0,0 +1,49 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, created_at, updated_at, user_id, name, prefix, key_hash, scopes, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetAPIKeyByPrefix :one
+SELECT api_keys.*
+FROM api_keys
+JOIN users ON users.id = api_keys.user_id
+WHERE api_keys.prefix = $1
+AND api_keys.revoked_at IS NULL
+AND (api_keys.expires_at IS NULL OR api_keys.expires_at > NOW())
+AND users.deleted_at IS NULL;
+
+-- name: GetAPIKeysByUserID :many
+SELECT *
+FROM api_keys
+WHERE user_id = $1
+AND revoked_at IS NULL
+ORDER BY created_at ASC;
+
+-- name: CountAPIKeysByUserID :one
+SELECT COUNT(*)
+FROM api_keys
+WHERE user_id = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1
+AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
@@ -0,0 +1,36 @@
+-- name: BlockUser :one
+-- Returns no rows when the user is already blocked
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: IsBlockedEitherWay :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = sqlc.arg('user_id') AND blocked_id = sqlc.arg('other_id'))
+    OR (blocker_id = sqlc.arg('other_id') AND blocked_id = sqlc.arg('user_id'))
+);
+
+-- name: ListBlocksByUser :many
+SELECT *
+FROM blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: ListUserIDsBlockedEitherWay :many
+-- The users user_id blocked and those who blocked them
+SELECT blocked_id AS user_id FROM blocks
+WHERE blocker_id = sqlc.arg('user_id')
+UNION
+SELECT blocker_id FROM blocks
+WHERE blocked_id = sqlc.arg('user_id');
+
+-- name: UnblockUser :execrows
+DELETE FROM blocks
+WHERE blocker_id = $1
+AND blocked_id = $2;
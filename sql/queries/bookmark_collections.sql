@@ -0,0 +1,42 @@
+-- name: CreateBookmarkCollection :one
+INSERT INTO bookmark_collections (id, created_at, updated_at, user_id, name)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2
+)
+RETURNING *;
+
+-- name: ListBookmarkCollectionsByUser :many
+SELECT bookmark_collections.*, (
+    SELECT COUNT(*) FROM bookmarks
+    WHERE bookmarks.collection_id = bookmark_collections.id
+) AS bookmark_count
+FROM bookmark_collections
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetBookmarkCollection :one
+SELECT *
+FROM bookmark_collections
+WHERE id = $1
+AND user_id = $2;
+
+-- name: CountBookmarkCollectionsByUser :one
+SELECT COUNT(*)
+FROM bookmark_collections
+WHERE user_id = $1;
+
+-- name: RenameBookmarkCollection :one
+UPDATE bookmark_collections
+SET name = $1, updated_at = NOW()
+WHERE id = $2
+AND user_id = $3
+RETURNING *;
+
+-- name: DeleteBookmarkCollection :execrows
+DELETE FROM bookmark_collections
+WHERE id = $1
+AND user_id = $2;
@@ -0,0 +1,42 @@
+-- name: CreateBookmark :exec
+-- Bookmarking a chirp again files it in collection_id instead, keeping when
+-- it was first bookmarked
+INSERT INTO bookmarks (user_id, chirp_id, created_at, collection_id)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3
+)
+ON CONFLICT (user_id, chirp_id) DO UPDATE
+SET collection_id = EXCLUDED.collection_id;
+
+-- name: DeleteBookmark :execrows
+DELETE FROM bookmarks
+WHERE user_id = $1
+AND chirp_id = $2;
+
+-- name: GetBookmark :one
+SELECT * FROM bookmarks
+WHERE user_id = $1
+AND chirp_id = $2;
+
+-- name: ListBookmarks :many
+-- Pages backwards from the bookmark made at before_created_at of
+-- before_chirp_id, newest first, optionally only those in collection_id.
+-- The cursor is passed by value, so a page still follows it once that
+-- bookmark is deleted. Chirps the user can't see
+-- any more, by visibility or blocks as for GetChirpByID, are left out.
+SELECT sqlc.embed(chirps), bookmarks.created_at AS bookmarked_at, bookmarks.collection_id
+FROM bookmarks
+JOIN chirps ON chirps.id = bookmarks.chirp_id
+WHERE bookmarks.user_id = sqlc.arg('user_id')
+AND (sqlc.narg('collection_id')::uuid IS NULL OR bookmarks.collection_id = sqlc.narg('collection_id'))
+AND (
+    sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (bookmarks.created_at, bookmarks.chirp_id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_chirp_id')::uuid)
+)
+AND chirps.status = 'published'
+AND chirp_visible_to(chirps.user_id, chirps.visibility, chirps.mentioned_ids, sqlc.arg('user_id'))
+ORDER BY bookmarks.created_at DESC, bookmarks.chirp_id DESC
+LIMIT sqlc.arg('limit');
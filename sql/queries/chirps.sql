@@ -1,30 +1,96 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
 )
 RETURNING *;
 
 -- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+-- Only chirps viewer_id may see, as chirp_visible_to decides: public ones,
+-- their own, the ones mentioning them and followers-only ones of users they
+-- follow, none by users they blocked or who blocked them. Chirps by users they muted are
+-- left out too. Without a viewer_id only public chirps are returned.
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
 FROM chirps
+WHERE status = 'published'
+AND chirp_visible_to(chirps.user_id, chirps.visibility, chirps.mentioned_ids, sqlc.narg('viewer_id'))
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')
+    AND mutes.muted_id = chirps.user_id
+)
 ORDER BY created_at ASC;
 
 -- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id
+-- Visibility and blocks as for GetChirps, muted users' chirps are still
+-- shown when asked for
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
 FROM chirps
-WHERE id = $1;
+WHERE id = sqlc.arg('id')
+AND status = 'published'
+AND chirp_visible_to(chirps.user_id, chirps.visibility, chirps.mentioned_ids, sqlc.narg('viewer_id'));
 
 -- name: DeleteChirpByID :exec
 DELETE FROM chirps
 WHERE id = $1;
 
 -- name: GetChirpsByAuthorID :many
-SELECT id, created_at, updated_at, body, user_id
+-- Visibility and blocks as for GetChirps, muted users' chirps are still
+-- shown when asked for
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, status, publish_at, visibility, mentioned_ids
 FROM chirps
-WHERE user_id = $1
+WHERE user_id = sqlc.arg('user_id')
+AND status = 'published'
+AND chirp_visible_to(chirps.user_id, chirps.visibility, chirps.mentioned_ids, sqlc.narg('viewer_id'))
 ORDER BY created_at ASC;
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body = $1, mentioned_ids = $2, updated_at = NOW()
+WHERE id = $3
+RETURNING *;
+
+-- name: ListScheduledChirpsByAuthor :many
+SELECT * FROM chirps
+WHERE user_id = $1
+AND status = 'scheduled'
+ORDER BY publish_at ASC;
+
+-- name: DeleteScheduledChirp :one
+DELETE FROM chirps
+WHERE id = $1
+AND user_id = $2
+AND status = 'scheduled'
+RETURNING *;
+
+-- name: PublishDueChirps :many
+-- Locked rows are skipped, so instances running this at the same time each
+-- publish different chirps. Chirps of deleted accounts wait until the
+-- account is restored or purged.
+UPDATE chirps
+SET status = 'published',
+    created_at = publish_at,
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM chirps
+    WHERE status = 'scheduled'
+    AND publish_at <= NOW()
+    AND NOT EXISTS (
+        SELECT 1 FROM users
+        WHERE users.id = chirps.user_id
+        AND users.deleted_at IS NOT NULL
+    )
+    ORDER BY publish_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
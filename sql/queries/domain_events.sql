@@ -0,0 +1,49 @@
+-- name: CreateDomainEvent :one
+INSERT INTO domain_events (id, created_at, event_type, user_id, payload, status, available_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    'pending',
+    NOW()
+)
+RETURNING *;
+
+-- name: ClaimDomainEvents :many
+-- Leases due events for a minute, events of a relay that dies mid-batch are
+-- picked up again once the lease runs out
+UPDATE domain_events
+SET attempts = attempts + 1,
+    available_at = NOW() + INTERVAL '1 minute'
+WHERE id IN (
+    SELECT due.id
+    FROM domain_events due
+    WHERE due.status = 'pending'
+    AND due.available_at <= NOW()
+    ORDER BY due.created_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkDomainEventPublished :exec
+UPDATE domain_events
+SET status = 'published',
+    published_at = NOW(),
+    last_error = ''
+WHERE id = $1;
+
+-- name: FailDomainEvent :exec
+UPDATE domain_events
+SET status = $1,
+    last_error = $2,
+    available_at = $3,
+    handled_by = $4
+WHERE id = $5;
+
+-- name: DeletePublishedDomainEventsBefore :execrows
+DELETE FROM domain_events
+WHERE status = 'published'
+AND published_at < sqlc.arg('published_before')::timestamp;
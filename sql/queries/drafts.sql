@@ -0,0 +1,43 @@
+-- name: CreateDraft :one
+INSERT INTO drafts (id, created_at, updated_at, user_id, body, reply_to_id, media_ids, visibility)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetDraft :one
+SELECT * FROM drafts
+WHERE id = $1
+AND user_id = $2;
+
+-- name: ListDraftsByUser :many
+SELECT * FROM drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC;
+
+-- name: CountDraftsByUser :one
+SELECT COUNT(*) FROM drafts
+WHERE user_id = $1;
+
+-- name: UpdateDraft :one
+UPDATE drafts
+SET body = $1,
+    reply_to_id = $2,
+    media_ids = $3,
+    visibility = $4,
+    updated_at = NOW()
+WHERE id = $5
+AND user_id = $6
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM drafts
+WHERE id = $1
+AND user_id = $2;
@@ -0,0 +1,40 @@
+-- name: FollowUser :one
+-- Returns no rows when the user is already followed
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: GetTimelineFollowerIDs :many
+-- The followers whose timelines get the user's chirps, those who muted the
+-- user are left out
+SELECT follower_id
+FROM follows
+WHERE followee_id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = follows.follower_id
+    AND mutes.muted_id = follows.followee_id
+);
+
+-- name: IsFollowing :one
+SELECT EXISTS (
+    SELECT 1 FROM follows
+    WHERE follower_id = $1
+    AND followee_id = $2
+);
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows
+WHERE follower_id = $1
+AND followee_id = $2;
+
+-- name: DeleteFollowsBetween :exec
+-- Removes the follows either way between two users
+DELETE FROM follows
+WHERE (follower_id = sqlc.arg('user_id') AND followee_id = sqlc.arg('other_id'))
+OR (follower_id = sqlc.arg('other_id') AND followee_id = sqlc.arg('user_id'));
@@ -0,0 +1,19 @@
+-- name: CreateIdentity :one
+INSERT INTO identities (id, created_at, updated_at, user_id, provider, subject, email)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetUserByIdentity :one
+SELECT users.*
+FROM users
+JOIN identities ON identities.user_id = users.id
+WHERE identities.provider = $1
+AND identities.subject = $2;
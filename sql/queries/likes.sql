@@ -0,0 +1,15 @@
+-- name: LikeChirp :one
+-- Returns no rows when the user already likes the chirp
+INSERT INTO likes (user_id, chirp_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: UnlikeChirp :execrows
+DELETE FROM likes
+WHERE user_id = $1
+AND chirp_id = $2;
@@ -0,0 +1,27 @@
+-- name: UpsertLinkPreview :exec
+INSERT INTO link_previews (url, fetched_at, succeeded, title, description, image_url, site_name)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+ON CONFLICT (url) DO UPDATE
+SET fetched_at = NOW(),
+    succeeded = EXCLUDED.succeeded,
+    title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    image_url = EXCLUDED.image_url,
+    site_name = EXCLUDED.site_name;
+
+-- name: GetLinkPreview :one
+SELECT * FROM link_previews
+WHERE url = $1;
+
+-- name: ListLinkPreviews :many
+SELECT * FROM link_previews
+WHERE url = ANY(sqlc.arg('urls')::text[])
+AND succeeded;
@@ -0,0 +1,59 @@
+-- name: CreateMediaAttachment :one
+INSERT INTO media_attachments (id, created_at, user_id, content_type, size, width, height, blob_key, thumbnail_key, thumbnail_content_type)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+)
+RETURNING *;
+
+-- name: GetMediaAttachment :one
+SELECT * FROM media_attachments
+WHERE id = $1;
+
+-- name: AttachMediaToChirp :many
+-- Only the user's uploads that were never attached are taken, in the order
+-- of ids
+UPDATE media_attachments
+SET chirp_id = sqlc.arg('chirp_id'),
+    attached_at = NOW(),
+    position = array_position(sqlc.arg('ids')::uuid[], id)
+WHERE id = ANY(sqlc.arg('ids')::uuid[])
+AND user_id = sqlc.arg('user_id')
+AND attached_at IS NULL
+RETURNING *;
+
+-- name: ListMediaForChirps :many
+SELECT * FROM media_attachments
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: ListOrphanedMediaAttachments :many
+-- Uploads never attached by the cutoff, unless one of their owner's drafts
+-- still uses them, and attachments whose chirp is gone
+SELECT * FROM media_attachments
+WHERE chirp_id IS NULL
+AND (
+    attached_at IS NOT NULL
+    OR (
+        created_at < $1
+        AND NOT EXISTS (
+            SELECT 1 FROM drafts
+            WHERE drafts.user_id = media_attachments.user_id
+            AND media_attachments.id = ANY(drafts.media_ids)
+        )
+    )
+)
+ORDER BY created_at
+LIMIT $2;
+
+-- name: DeleteMediaAttachment :exec
+DELETE FROM media_attachments
+WHERE id = $1;
@@ -0,0 +1,44 @@
+-- name: CreateMutedWord :one
+-- Muting a phrase again, in any case, replaces its expiry
+INSERT INTO muted_words (id, created_at, user_id, phrase, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (user_id, lower(phrase)) DO UPDATE
+SET phrase = EXCLUDED.phrase,
+    expires_at = EXCLUDED.expires_at
+RETURNING *;
+
+-- name: ListActiveMutedWordsByUser :many
+SELECT *
+FROM muted_words
+WHERE user_id = $1
+AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at DESC;
+
+-- name: ListActiveMutedWordsByUsers :many
+-- The phrases of many users at once, to build their matchers in one query
+SELECT user_id, phrase, expires_at
+FROM muted_words
+WHERE user_id = ANY(sqlc.arg('user_ids')::uuid[])
+AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: CountActiveMutedWordsByUser :one
+SELECT COUNT(*)
+FROM muted_words
+WHERE user_id = $1
+AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: DeleteExpiredMutedWordsByUser :exec
+DELETE FROM muted_words
+WHERE user_id = $1
+AND expires_at <= NOW();
+
+-- name: DeleteMutedWord :execrows
+DELETE FROM muted_words
+WHERE id = $1
+AND user_id = $2;
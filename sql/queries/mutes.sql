@@ -0,0 +1,21 @@
+-- name: MuteUser :one
+-- Returns no rows when the user is already muted
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: ListMutesByUser :many
+SELECT *
+FROM mutes
+WHERE muter_id = $1
+ORDER BY created_at DESC;
+
+-- name: UnmuteUser :execrows
+DELETE FROM mutes
+WHERE muter_id = $1
+AND muted_id = $2;
@@ -0,0 +1,116 @@
+-- name: CreateNotification :one
+-- Returns no rows when the event already notified the user, events can be
+-- relayed more than once, or when the user muted the actor or either
+-- blocked the other
+INSERT INTO notifications (id, created_at, user_id, actor_id, type, chirp_id, event_id)
+SELECT
+    gen_random_uuid(),
+    NOW(),
+    sqlc.arg('user_id')::uuid,
+    sqlc.arg('actor_id')::uuid,
+    sqlc.arg('type')::text,
+    sqlc.narg('chirp_id')::uuid,
+    sqlc.arg('event_id')::uuid
+WHERE NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg('user_id')
+    AND mutes.muted_id = sqlc.arg('actor_id')
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.arg('user_id') AND blocks.blocked_id = sqlc.arg('actor_id'))
+    OR (blocks.blocker_id = sqlc.arg('actor_id') AND blocks.blocked_id = sqlc.arg('user_id'))
+)
+ON CONFLICT (event_id, user_id) DO NOTHING
+RETURNING *;
+
+-- name: ListNotifications :many
+-- Pages backwards from the notification passed as before, newest first,
+-- with the body of the chirp it's about to leave out words muted since.
+-- Notifications from users muted or blocked since are left out.
+SELECT notifications.*, chirps.body AS chirp_body
+FROM notifications
+LEFT JOIN chirps ON chirps.id = notifications.chirp_id
+WHERE notifications.user_id = sqlc.arg('user_id')
+AND (NOT sqlc.arg('unread_only')::boolean OR notifications.read_at IS NULL)
+AND (sqlc.narg('before')::uuid IS NULL OR (notifications.created_at, notifications.id) < (
+    SELECT cursor.created_at, cursor.id
+    FROM notifications cursor
+    WHERE cursor.id = sqlc.narg('before')
+))
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = notifications.actor_id
+    AND users.deleted_at IS NOT NULL
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = notifications.user_id
+    AND mutes.muted_id = notifications.actor_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = notifications.user_id AND blocks.blocked_id = notifications.actor_id)
+    OR (blocks.blocker_id = notifications.actor_id AND blocks.blocked_id = notifications.user_id)
+)
+ORDER BY notifications.created_at DESC, notifications.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: CountUnreadNotifications :one
+-- Counts what ListNotifications would list, muted words aside
+SELECT COUNT(*)
+FROM notifications
+WHERE user_id = $1
+AND read_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = notifications.actor_id
+    AND users.deleted_at IS NOT NULL
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = notifications.user_id
+    AND mutes.muted_id = notifications.actor_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = notifications.user_id AND blocks.blocked_id = notifications.actor_id)
+    OR (blocks.blocker_id = notifications.actor_id AND blocks.blocked_id = notifications.user_id)
+);
+
+-- name: ListUnreadNotificationChirps :many
+-- The type and chirp body of each notification CountUnreadNotifications
+-- counts, to count without those containing words muted since
+SELECT notifications.type, chirps.body AS chirp_body
+FROM notifications
+LEFT JOIN chirps ON chirps.id = notifications.chirp_id
+WHERE notifications.user_id = $1
+AND notifications.read_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = notifications.actor_id
+    AND users.deleted_at IS NOT NULL
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = notifications.user_id
+    AND mutes.muted_id = notifications.actor_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = notifications.user_id AND blocks.blocked_id = notifications.actor_id)
+    OR (blocks.blocker_id = notifications.actor_id AND blocks.blocked_id = notifications.user_id)
+);
+
+-- name: MarkNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = sqlc.arg('user_id')
+AND id = ANY(sqlc.arg('ids')::uuid[])
+AND read_at IS NULL;
+
+-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1
+AND read_at IS NULL;
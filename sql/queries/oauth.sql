@@ -0,0 +1,55 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, updated_at, user_id, name, secret_hash, redirect_uris, scopes)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: GetOAuthClientsByUserID :many
+SELECT *
+FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1
+AND user_id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, created_at, expires_at, client_id, user_id, redirect_uri, scopes, code_challenge)
+VALUES (
+    $1,
+    NOW(),
+    NOW() + INTERVAL '10 minutes',
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+-- Only the client, redirect URI and PKCE challenge the code was issued
+-- for can use it up, a wrong guess leaves it for the real client
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+AND client_id = $2
+AND redirect_uri = $3
+AND code_challenge = $4
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,24 @@
+-- name: CreateRealtimeMessage :exec
+INSERT INTO realtime_messages (created_at, event, data, user_ids, topics, excluded_user_ids)
+VALUES (
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: GetLatestRealtimeMessageID :one
+SELECT COALESCE(MAX(id), 0)::bigint AS latest_id
+FROM realtime_messages;
+
+-- name: ListRealtimeMessagesAfter :many
+SELECT * FROM realtime_messages
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: DeleteRealtimeMessagesBefore :execrows
+DELETE FROM realtime_messages
+WHERE created_at < $1;
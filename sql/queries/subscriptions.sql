@@ -0,0 +1,71 @@
+-- name: StartSubscription :one
+-- Returns no rows when the user doesn't exist or is deleted
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_end)
+SELECT gen_random_uuid(), NOW(), NOW(), users.id, sqlc.arg('plan'), 'active', sqlc.arg('current_period_end')
+FROM users
+WHERE users.id = sqlc.arg('user_id')
+AND users.deleted_at IS NULL
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+    status = 'active',
+    current_period_end = EXCLUDED.current_period_end,
+    canceled_at = NULL,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: GetSubscriptionByUserID :one
+SELECT *
+FROM subscriptions
+WHERE user_id = $1;
+
+-- name: RenewSubscription :one
+UPDATE subscriptions
+SET status = 'active',
+    current_period_end = $2,
+    canceled_at = NULL,
+    updated_at = NOW()
+WHERE user_id = $1
+RETURNING *;
+
+-- name: CancelSubscription :one
+-- Canceled subscriptions stay active until the end of the period, an
+-- open-ended one has no period paid for and ends now
+UPDATE subscriptions
+SET status = CASE WHEN status = 'active' THEN 'canceled' ELSE status END,
+    current_period_end = COALESCE(current_period_end, NOW()),
+    canceled_at = COALESCE(canceled_at, NOW()),
+    updated_at = NOW()
+WHERE user_id = $1
+RETURNING *;
+
+-- name: EndSubscription :one
+UPDATE subscriptions
+SET status = 'expired',
+    current_period_end = LEAST(current_period_end, NOW()),
+    updated_at = NOW()
+WHERE user_id = $1
+RETURNING *;
+
+-- name: ExpireSubscriptions :execrows
+UPDATE subscriptions
+SET status = 'expired',
+    updated_at = NOW()
+WHERE status IN ('active', 'canceled')
+AND current_period_end <= NOW();
+
+-- name: HasActiveSubscription :one
+SELECT EXISTS (
+    SELECT 1
+    FROM subscriptions
+    WHERE user_id = $1
+    AND status IN ('active', 'canceled')
+    AND (current_period_end IS NULL OR current_period_end > NOW())
+);
+
+-- name: GetActivePlanByUserID :one
+-- Returns no rows when the user isn't Chirpy Red
+SELECT plan
+FROM subscriptions
+WHERE user_id = $1
+AND status IN ('active', 'canceled')
+AND (current_period_end IS NULL OR current_period_end > NOW());
@@ -13,23 +13,107 @@ RETURNING *;
 TRUNCATE users CASCADE;
 
 -- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT *
 FROM users
 WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1
+AND deleted_at IS NULL;
+
+-- name: IsUserActive :one
+-- False once the account is deleted, its tokens stop working at once
+-- rather than when they expire
+SELECT EXISTS (
+    SELECT 1 FROM users
+    WHERE id = $1
+    AND deleted_at IS NULL
+);
+
+-- name: GetUserByHandle :one
+SELECT *
+FROM users
+WHERE handle <> ''
+AND lower(handle) = lower(sqlc.arg('handle'))
+AND deleted_at IS NULL;
+
+-- name: GetUserStats :one
+SELECT
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = sqlc.arg('user_id')::uuid AND chirps.status = 'published') AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = sqlc.arg('user_id')::uuid) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = sqlc.arg('user_id')::uuid) AS following_count,
+    EXISTS (
+        SELECT 1 FROM subscriptions
+        WHERE subscriptions.user_id = sqlc.arg('user_id')::uuid
+        AND subscriptions.status IN ('active', 'canceled')
+        AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > NOW())
+    ) AS is_chirpy_red;
+
 -- name: UpdateUser :one
 UPDATE users
 SET
-    email = $1,
-    hashed_password = $2,
+    email = COALESCE(sqlc.narg('email'), email),
+    hashed_password = COALESCE(sqlc.narg('hashed_password'), hashed_password),
+    display_name = COALESCE(sqlc.narg('display_name'), display_name),
+    handle = COALESCE(sqlc.narg('handle'), handle),
+    bio = COALESCE(sqlc.narg('bio'), bio),
+    avatar_url = COALESCE(sqlc.narg('avatar_url'), avatar_url),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+AND deleted_at IS NULL
+RETURNING *;
+
+-- name: SoftDeleteUser :one
+UPDATE users
+SET
+    deleted_at = NOW(),
     updated_at = NOW()
-WHERE id = $3
+WHERE id = $1
+AND deleted_at IS NULL
 RETURNING *;
 
--- name: UpgradeUser :one
+-- name: RestoreUser :one
 UPDATE users
 SET
-    is_chirpy_red = TRUE,
+    deleted_at = NULL,
     updated_at = NOW()
 WHERE id = $1
 RETURNING *;
+
+-- name: LockActiveUser :one
+-- Keeps the user from being deleted until the transaction ends, returns no
+-- rows once the account is deleted
+SELECT id
+FROM users
+WHERE id = $1
+AND deleted_at IS NULL
+FOR SHARE;
+
+-- name: LockUserForUpdate :exec
+-- Makes the user's transactions that count their rows before adding one
+-- take turns, so two of them can't both get under a limit
+SELECT id
+FROM users
+WHERE id = $1
+FOR NO KEY UPDATE;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL
+AND deleted_at < sqlc.arg('deleted_before')::timestamp;
+
+-- name: GetUserIDsByHandles :many
+-- The users author_id can mention, none who blocked them or whom they
+-- blocked
+SELECT id
+FROM users
+WHERE handle <> ''
+AND lower(handle) = ANY(sqlc.arg('handles')::text[])
+AND deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = users.id AND blocks.blocked_id = sqlc.arg('author_id'))
+    OR (blocks.blocker_id = sqlc.arg('author_id') AND blocks.blocked_id = users.id)
+);
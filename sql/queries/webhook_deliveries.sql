@@ -0,0 +1,62 @@
+-- name: EnqueueWebhookDeliveries :execrows
+-- Queues the event for every subscription that wants it: the user's own
+-- subscriptions and every admin subscription. Queueing an event twice is a
+-- no-op.
+INSERT INTO webhook_deliveries (id, created_at, updated_at, subscription_id, event_id, event_type, payload, status, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), NOW(), webhook_subscriptions.id, sqlc.arg('event_id'), sqlc.arg('event_type'), sqlc.arg('payload'), 'pending', NOW()
+FROM webhook_subscriptions
+WHERE sqlc.arg('event_type')::text = ANY(webhook_subscriptions.event_types)
+AND (webhook_subscriptions.user_id IS NULL OR webhook_subscriptions.user_id = sqlc.arg('user_id')::uuid)
+ON CONFLICT (subscription_id, event_id) DO NOTHING;
+
+-- name: ClaimWebhookDeliveries :many
+-- Leases due deliveries for five minutes, deliveries of a dispatcher that
+-- dies mid-batch are picked up again once the lease runs out
+UPDATE webhook_deliveries
+SET attempts = webhook_deliveries.attempts + 1,
+    next_attempt_at = NOW() + INTERVAL '5 minutes',
+    last_attempt_at = NOW(),
+    updated_at = NOW()
+FROM webhook_subscriptions
+WHERE webhook_subscriptions.id = webhook_deliveries.subscription_id
+AND webhook_deliveries.id IN (
+    SELECT due.id
+    FROM webhook_deliveries due
+    WHERE due.status = 'pending'
+    AND due.next_attempt_at <= NOW()
+    ORDER BY due.next_attempt_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING webhook_deliveries.id, webhook_deliveries.event_id, webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.attempts, webhook_subscriptions.url, webhook_subscriptions.secret;
+
+-- name: FinishWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = sqlc.arg('status'),
+    response_status = sqlc.narg('response_status'),
+    last_error = sqlc.arg('last_error'),
+    next_attempt_at = sqlc.arg('next_attempt_at'),
+    delivered_at = CASE WHEN sqlc.arg('status') = 'succeeded' THEN NOW() ELSE delivered_at END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id');
+
+-- name: ListWebhookDeliveries :many
+SELECT *
+FROM webhook_deliveries
+WHERE subscription_id = sqlc.arg('subscription_id')
+AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: RetryWebhookDelivery :one
+-- Only dead deliveries can be retried, they get a fresh set of attempts
+UPDATE webhook_deliveries
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = NOW(),
+    last_error = '',
+    updated_at = NOW()
+WHERE id = $1
+AND subscription_id = $2
+AND status = 'dead'
+RETURNING *;
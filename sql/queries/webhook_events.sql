@@ -0,0 +1,57 @@
+-- name: CreateWebhookEvent :one
+-- Returns no rows for a duplicate delivery, unless the earlier attempt
+-- failed or was left received by a crash, in which case it is claimed for
+-- another attempt. Events without an ID have a NULL event_id and are never
+-- duplicates.
+INSERT INTO webhook_events (id, created_at, updated_at, provider, event_id, event_type, payload, status)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    'received'
+)
+ON CONFLICT (provider, event_id) DO UPDATE
+SET status = 'received', updated_at = NOW()
+WHERE webhook_events.status = 'failed'
+OR (webhook_events.status = 'received' AND webhook_events.updated_at < NOW() - INTERVAL '5 minutes')
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT *
+FROM webhook_events
+WHERE id = $1;
+
+-- name: GetWebhookEventStatus :one
+SELECT status
+FROM webhook_events
+WHERE provider = $1
+AND event_id = $2;
+
+-- name: ListWebhookEvents :many
+SELECT *
+FROM webhook_events
+WHERE (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+AND (sqlc.narg('provider')::text IS NULL OR provider = sqlc.narg('provider'))
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ClaimWebhookEventForReplay :one
+UPDATE webhook_events
+SET status = 'received', updated_at = NOW()
+WHERE id = $1
+AND (status = 'failed' OR (status = 'received' AND updated_at < NOW() - INTERVAL '5 minutes'))
+RETURNING *;
+
+-- name: FinishWebhookEvent :one
+UPDATE webhook_events
+SET status = sqlc.arg('status'),
+    error = sqlc.arg('error'),
+    attempts = attempts + 1,
+    processed_at = CASE WHEN sqlc.arg('status') = 'processed' THEN NOW() ELSE processed_at END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING *;
@@ -0,0 +1,35 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (id, created_at, updated_at, user_id, url, secret, event_types)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetWebhookSubscription :one
+-- A NULL user_id matches admin subscriptions
+SELECT *
+FROM webhook_subscriptions
+WHERE id = $1
+AND user_id IS NOT DISTINCT FROM $2;
+
+-- name: GetWebhookSubscriptions :many
+SELECT *
+FROM webhook_subscriptions
+WHERE user_id IS NOT DISTINCT FROM $1
+ORDER BY created_at ASC;
+
+-- name: CountWebhookSubscriptionsByUserID :one
+SELECT COUNT(*)
+FROM webhook_subscriptions
+WHERE user_id = $1;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = $1
+AND user_id IS NOT DISTINCT FROM $2;
@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN display_name text NOT NULL DEFAULT '',
+ADD COLUMN handle text NOT NULL DEFAULT '',
+ADD COLUMN bio text NOT NULL DEFAULT '',
+ADD COLUMN avatar_url text NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX users_handle_key ON users (lower(handle)) WHERE handle <> '';
+
+-- +goose Down
+DROP INDEX users_handle_key;
+ALTER TABLE users
+DROP COLUMN display_name,
+DROP COLUMN handle,
+DROP COLUMN bio,
+DROP COLUMN avatar_url;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE identities (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email text NOT NULL DEFAULT '',
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX identities_user_id_idx ON identities (user_id);
+
+-- +goose Down
+DROP TABLE identities;
@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name text NOT NULL,
+    secret_hash text NOT NULL DEFAULT '',
+    redirect_uris text[] NOT NULL,
+    scopes text[] NOT NULL
+);
+
+CREATE INDEX oauth_clients_user_id_idx ON oauth_clients (user_id);
+
+CREATE TABLE oauth_authorization_codes (
+    code_hash text PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    client_id uuid NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri text NOT NULL,
+    scopes text[] NOT NULL,
+    code_challenge text NOT NULL,
+    used_at timestamp
+);
+
+-- +goose Down
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
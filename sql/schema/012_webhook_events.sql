@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    provider text NOT NULL,
+    event_id text,
+    event_type text NOT NULL,
+    payload text NOT NULL,
+    status text NOT NULL,
+    error text NOT NULL DEFAULT '',
+    attempts integer NOT NULL DEFAULT 0,
+    processed_at timestamp,
+    UNIQUE (provider, event_id)
+);
+
+CREATE INDEX webhook_events_status_idx ON webhook_events (status, created_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
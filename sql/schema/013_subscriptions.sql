@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    user_id uuid NOT NULL UNIQUE REFERENCES users (id) ON DELETE CASCADE,
+    plan text NOT NULL,
+    status text NOT NULL,
+    current_period_end timestamp,
+    canceled_at timestamp
+);
+
+CREATE INDEX subscriptions_expiry_idx ON subscriptions (current_period_end)
+WHERE status IN ('active', 'canceled');
+
+-- existing Chirpy Red members never had a billing period and Polka never
+-- renews, so they keep Chirpy Red until they are downgraded
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_end)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'red', 'active', NULL
+FROM users
+WHERE is_chirpy_red;
+
+ALTER TABLE users DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users ADD COLUMN
+is_chirpy_red boolean NOT NULL DEFAULT FALSE;
+
+UPDATE users
+SET is_chirpy_red = TRUE
+FROM subscriptions
+WHERE subscriptions.user_id = users.id
+AND subscriptions.status IN ('active', 'canceled')
+AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > NOW());
+
+DROP TABLE subscriptions;
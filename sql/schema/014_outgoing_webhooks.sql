@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE webhook_subscriptions (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    -- NULL for subscriptions registered by an admin, which get every event
+    user_id uuid REFERENCES users (id) ON DELETE CASCADE,
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL
+);
+
+CREATE INDEX webhook_subscriptions_user_id_idx ON webhook_subscriptions (user_id);
+
+CREATE TABLE webhook_deliveries (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    subscription_id uuid NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id text NOT NULL,
+    event_type text NOT NULL,
+    payload text NOT NULL,
+    status text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp NOT NULL,
+    last_attempt_at timestamp,
+    response_status integer,
+    last_error text NOT NULL DEFAULT '',
+    delivered_at timestamp
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at)
+WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id, created_at);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_subscriptions;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE domain_events (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    event_type text NOT NULL,
+    -- no foreign key, events about a user outlive the user
+    user_id uuid NOT NULL,
+    payload text NOT NULL,
+    status text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    available_at timestamp NOT NULL,
+    last_error text NOT NULL DEFAULT '',
+    published_at timestamp
+);
+
+CREATE INDEX domain_events_pending_idx ON domain_events (available_at)
+WHERE status = 'pending';
+
+-- events can be relayed more than once, a delivery per event is enough
+CREATE UNIQUE INDEX webhook_deliveries_event_idx ON webhook_deliveries (subscription_id, event_id);
+
+-- +goose Down
+DROP INDEX webhook_deliveries_event_idx;
+DROP TABLE domain_events;
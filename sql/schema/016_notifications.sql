@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN reply_to_id uuid REFERENCES chirps (id) ON DELETE SET NULL;
+
+CREATE TABLE likes (
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    chirp_id uuid NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX likes_chirp_id_idx ON likes (chirp_id);
+
+CREATE TABLE notifications (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type text NOT NULL,
+    chirp_id uuid REFERENCES chirps (id) ON DELETE CASCADE,
+    event_id uuid NOT NULL,
+    read_at timestamp
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at DESC);
+
+-- events can be relayed more than once, one notification per event is enough
+CREATE UNIQUE INDEX notifications_event_idx ON notifications (event_id, user_id);
+
+-- +goose Down
+DROP TABLE notifications;
+DROP TABLE likes;
+ALTER TABLE chirps
+DROP COLUMN reply_to_id;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- a short log of what's pushed to streams and WebSockets, every server
+-- instance reads it so clients get events wherever they're connected
+CREATE TABLE realtime_messages (
+    id bigserial PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    event text NOT NULL,
+    data text NOT NULL,
+    -- recipients on the event stream
+    user_ids uuid[] NOT NULL DEFAULT '{}',
+    -- recipients on the WebSocket gateway
+    topics text[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX realtime_messages_created_at_idx ON realtime_messages (created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION notify_realtime_message() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('realtime_messages', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER realtime_messages_notify
+AFTER INSERT ON realtime_messages
+FOR EACH ROW EXECUTE FUNCTION notify_realtime_message();
+
+-- +goose Down
+DROP TRIGGER realtime_messages_notify ON realtime_messages;
+DROP FUNCTION notify_realtime_message();
+DROP TABLE realtime_messages;
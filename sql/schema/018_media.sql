@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE media_attachments (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    -- not cascading, rows left without a chirp are deleted along with their
+    -- blobs by the media janitor
+    user_id uuid REFERENCES users (id) ON DELETE SET NULL,
+    chirp_id uuid REFERENCES chirps (id) ON DELETE SET NULL,
+    attached_at timestamp,
+    position integer NOT NULL DEFAULT 0,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    blob_key text NOT NULL,
+    thumbnail_key text NOT NULL,
+    thumbnail_content_type text NOT NULL
+);
+
+CREATE INDEX media_attachments_chirp_id_idx ON media_attachments (chirp_id);
+
+CREATE INDEX media_attachments_orphaned_idx ON media_attachments (created_at)
+WHERE chirp_id IS NULL;
+
+-- +goose Down
+DROP TABLE media_attachments;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE link_previews (
+    url text PRIMARY KEY,
+    fetched_at timestamp NOT NULL,
+    -- false if the page couldn't be fetched or had nothing to preview, kept
+    -- so it isn't fetched again for every chirp linking to it
+    succeeded boolean NOT NULL,
+    title text NOT NULL DEFAULT '',
+    description text NOT NULL DEFAULT '',
+    image_url text NOT NULL DEFAULT '',
+    site_name text NOT NULL DEFAULT ''
+);
+
+-- +goose Down
+DROP TABLE link_previews;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN status text NOT NULL DEFAULT 'published',
+ADD COLUMN publish_at timestamp;
+
+CREATE INDEX chirps_scheduled_idx ON chirps (publish_at)
+WHERE status = 'scheduled';
+
+-- +goose Down
+DROP INDEX chirps_scheduled_idx;
+ALTER TABLE chirps
+DROP COLUMN publish_at,
+DROP COLUMN status;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE drafts (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    body text NOT NULL,
+    -- not foreign keys, drafts are only checked when they're published
+    reply_to_id uuid,
+    media_ids uuid[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX drafts_user_id_idx ON drafts (user_id, updated_at);
+
+-- +goose Down
+DROP TABLE drafts;
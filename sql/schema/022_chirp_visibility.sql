@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN visibility text NOT NULL DEFAULT 'public',
+-- users @mentioned when the chirp was written, who can always see it
+ADD COLUMN mentioned_ids uuid[] NOT NULL DEFAULT '{}';
+
+-- the visibility the draft will be published with
+ALTER TABLE drafts
+ADD COLUMN visibility text NOT NULL DEFAULT 'public';
+
+-- +goose Down
+ALTER TABLE drafts
+DROP COLUMN visibility;
+
+ALTER TABLE chirps
+DROP COLUMN mentioned_ids,
+DROP COLUMN visibility;
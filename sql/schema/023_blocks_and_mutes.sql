@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE blocks (
+    blocker_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    blocked_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX blocks_blocked_id_idx ON blocks (blocked_id);
+
+CREATE TABLE mutes (
+    muter_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    muted_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (muter_id, muted_id),
+    CHECK (muter_id <> muted_id)
+);
+
+-- gateway sessions of these users don't get the message whatever they're
+-- subscribed to: those blocked either way by the author of a chirp
+ALTER TABLE realtime_messages
+ADD COLUMN excluded_user_ids uuid[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE realtime_messages
+DROP COLUMN excluded_user_ids;
+
+DROP TABLE mutes;
+DROP TABLE blocks;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE muted_words (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    phrase text NOT NULL,
+    -- muted for good when NULL
+    expires_at timestamp
+);
+
+CREATE UNIQUE INDEX muted_words_user_id_phrase_idx ON muted_words (user_id, lower(phrase));
+
+-- +goose Down
+DROP TABLE muted_words;
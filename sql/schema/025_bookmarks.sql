@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE bookmark_collections (
+    id uuid PRIMARY KEY,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name text NOT NULL
+);
+
+CREATE UNIQUE INDEX bookmark_collections_user_id_name_idx ON bookmark_collections (user_id, lower(name));
+
+CREATE TABLE bookmarks (
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    chirp_id uuid NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL,
+    -- unfiled when NULL, deleting a collection keeps its bookmarks
+    collection_id uuid REFERENCES bookmark_collections (id) ON DELETE SET NULL,
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+CREATE INDEX bookmarks_user_id_idx ON bookmarks (user_id, created_at DESC);
+CREATE INDEX bookmarks_collection_id_idx ON bookmarks (collection_id);
+
+-- +goose Down
+DROP TABLE bookmarks;
+DROP TABLE bookmark_collections;
@@ -0,0 +1,39 @@
+-- +goose Up
+-- Whether viewer_id may see a chirp by author_id: public chirps, their own,
+-- those mentioning them and followers-only ones of users they follow, none
+-- by deleted users or by users blocked either way. A NULL viewer_id is an
+-- anonymous reader, who only sees public chirps. Every query reading chirps
+-- for someone checks this, so the rule is written once.
+-- +goose StatementBegin
+CREATE FUNCTION chirp_visible_to(author_id uuid, chirp_visibility text, chirp_mentioned_ids uuid[], viewer_id uuid) RETURNS boolean AS $$
+    SELECT COALESCE(
+        (
+            chirp_visibility = 'public'
+            OR author_id = viewer_id
+            OR viewer_id = ANY(chirp_mentioned_ids)
+            OR (
+                chirp_visibility = 'followers'
+                AND EXISTS (
+                    SELECT 1 FROM follows
+                    WHERE follows.follower_id = viewer_id
+                    AND follows.followee_id = author_id
+                )
+            )
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM users
+            WHERE users.id = author_id
+            AND users.deleted_at IS NOT NULL
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM blocks
+            WHERE (blocks.blocker_id = author_id AND blocks.blocked_id = viewer_id)
+            OR (blocks.blocker_id = viewer_id AND blocks.blocked_id = author_id)
+        ),
+        false
+    );
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION chirp_visible_to(uuid, text, uuid[], uuid);
@@ -0,0 +1,15 @@
+-- +goose Up
+-- the subscribers that handled the event, a retry after a failure only
+-- runs the others
+ALTER TABLE domain_events
+ADD COLUMN handled_by text[] NOT NULL DEFAULT '{}';
+
+-- published events are deleted once they're past the retention period
+CREATE INDEX domain_events_published_at_idx ON domain_events (published_at)
+WHERE status = 'published';
+
+-- +goose Down
+DROP INDEX domain_events_published_at_idx;
+
+ALTER TABLE domain_events
+DROP COLUMN handled_by;